@@ -0,0 +1,114 @@
+package gpt3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// DefaultAzureAPIVersion is the api-version used by WithAzure when AzureConfig.APIVersion is empty.
+const DefaultAzureAPIVersion = "2024-02-01"
+
+// AzureConfig configures a client to call an Azure OpenAI resource instead of the OpenAI API.
+type AzureConfig struct {
+	// Endpoint is the url of the Azure OpenAI resource, e.g. "https://my-resource.openai.azure.com".
+	Endpoint string `json:"endpoint"`
+
+	// APIVersion is sent as the api-version query parameter. Defaults to DefaultAzureAPIVersion.
+	APIVersion string `json:"api_version,omitempty"`
+
+	// Deployments maps model names, e.g. GPT3Dot5Turbo, to the names of the deployments serving
+	// them. Models without an entry are sent to a deployment of the same name.
+	Deployments map[string]string `json:"deployments,omitempty"`
+
+	// TokenProvider returns an Azure Active Directory token, which is sent as a bearer token. If
+	// it is nil the client's api key is sent in the api-key header instead. It is called once per
+	// call, so it should cache tokens until they expire.
+	TokenProvider func(ctx context.Context) (string, error) `json:"-"`
+}
+
+// azurePaths are the paths, below a deployment, of the operations Azure OpenAI supports.
+var azurePaths = map[string]string{
+	OperationChatCompletion:       "/chat/completions",
+	OperationChatCompletionStream: "/chat/completions",
+	OperationCompletion:           "/completions",
+	OperationCompletionStream:     "/completions",
+	OperationEmbeddings:           "/embeddings",
+}
+
+// WithAzure is a client option that sends chat, completion and embeddings calls, including
+// streams, to an Azure OpenAI resource. Each model is mapped to its deployment, the api-version
+// is added to the query, and the api key is sent in the api-key header unless a TokenProvider is
+// configured. Other operations are not supported by Azure OpenAI and return an error.
+func WithAzure(config AzureConfig) ClientOption {
+	return func(c *client) error {
+		u, err := url.Parse(config.Endpoint)
+		if err != nil {
+			return fmt.Errorf("invalid azure endpoint %q: %w", config.Endpoint, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid azure endpoint %q: must be an absolute http or https url", config.Endpoint)
+		}
+		config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+		if config.APIVersion == "" {
+			config.APIVersion = DefaultAzureAPIVersion
+		}
+		// copy the deployments so that later changes by the caller don't affect the client
+		deployments := make(map[string]string, len(config.Deployments))
+		for model, deployment := range config.Deployments {
+			if deployment == "" {
+				return fmt.Errorf("azure deployment for model %q must not be empty", model)
+			}
+			deployments[model] = deployment
+		}
+		config.Deployments = deployments
+		c.azure = &config
+		return nil
+	}
+}
+
+// applyAzure rewrites the HTTP request of the call, built for the OpenAI API, into a request to
+// the deployment serving the call's model, authenticated the way the AzureConfig asks for.
+func (c *client) applyAzure(ctx context.Context, call *Call) error {
+	suffix, ok := azurePaths[call.Operation]
+	if !ok {
+		return fmt.Errorf("operation %s is not supported by Azure OpenAI", call.Operation)
+	}
+	model := call.Model()
+	if model == "" {
+		return errors.New("a model is required to choose an Azure OpenAI deployment")
+	}
+	deployment, ok := c.azure.Deployments[model]
+	if !ok {
+		deployment = model
+	}
+
+	req := call.HTTPRequest
+	// keep any base path of a per-request base url, and drop the OpenAI path of the operation
+	basePath := strings.TrimSuffix(req.URL.Path, call.path)
+	req.URL.Path = basePath + "/openai/deployments/" + deployment + suffix
+	req.URL.RawPath = basePath + "/openai/deployments/" + url.PathEscape(deployment) + suffix
+	query := req.URL.Query()
+	if query.Get("api-version") == "" {
+		query.Set("api-version", c.azure.APIVersion)
+	}
+	req.URL.RawQuery = query.Encode()
+
+	req.Header.Del("Authorization")
+	if c.azure.TokenProvider != nil {
+		token, err := c.azure.TokenProvider(ctx)
+		if err != nil {
+			return fmt.Errorf("azure token provider: %w", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	}
+	apiKey := c.apiKey
+	if call.options.apiKey != "" {
+		apiKey = call.options.apiKey
+	}
+	req.Header.Set("api-key", apiKey)
+	return nil
+}
@@ -0,0 +1,107 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAzureAPIKey(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))}, nil
+	}
+	client, err := gpt3.NewClientWithOptions("azure-key",
+		gpt3.WithHTTPClient(httpClient),
+		gpt3.WithAzure(gpt3.AzureConfig{
+			Endpoint:    "https://my-resource.openai.azure.com/",
+			Deployments: map[string]string{gpt3.GPT3Dot5Turbo: "chat-prod", gpt3.TextEmbeddingAda002: "embed"},
+		}),
+	)
+	assert.NoError(t, err)
+
+	_, err = client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{})
+	assert.NoError(t, err)
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "https://my-resource.openai.azure.com/openai/deployments/chat-prod/chat/completions?api-version="+
+		gpt3.DefaultAzureAPIVersion, req.URL.String())
+	assert.Equal(t, "azure-key", req.Header.Get("api-key"))
+	assert.Empty(t, req.Header.Get("Authorization"))
+
+	_, err = client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: gpt3.TextEmbeddingAda002},
+		gpt3.WithQueryParam("api-version", "2023-05-15"), gpt3.WithRequestAPIKey("other-key"))
+	assert.NoError(t, err)
+	req = rt.RoundTripArgsForCall(1)
+	assert.Equal(t, "https://my-resource.openai.azure.com/openai/deployments/embed/embeddings?api-version=2023-05-15", req.URL.String())
+	assert.Equal(t, "other-key", req.Header.Get("api-key"))
+
+	// models without a mapping use a deployment of the same name
+	_, err = client.CompletionWithEngine(context.Background(), "davinci-002", gpt3.CompletionRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "/openai/deployments/davinci-002/completions", rt.RoundTripArgsForCall(2).URL.Path)
+}
+
+func TestAzureTokenProviderStream(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(
+			"data: {\"choices\": [{\"delta\": {\"content\": \"hi\"}}]}\n\ndata: [DONE]\n\n"))}, nil
+	}
+	client := gpt3.NewClient("",
+		gpt3.WithHTTPClient(httpClient),
+		gpt3.WithAzure(gpt3.AzureConfig{
+			Endpoint:   "https://my-resource.openai.azure.com",
+			APIVersion: "2024-06-01",
+			TokenProvider: func(ctx context.Context) (string, error) {
+				return "aad-token", nil
+			},
+		}),
+	)
+
+	var content string
+	err := client.ChatCompletionStream(context.Background(), gpt3.ChatCompletionRequest{Model: "gpt-4"},
+		func(rsp *gpt3.ChatCompletionStreamResponse) error {
+			content += rsp.Choices[0].Delta.Content
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", content)
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "https://my-resource.openai.azure.com/openai/deployments/gpt-4/chat/completions?api-version=2024-06-01", req.URL.String())
+	assert.Equal(t, "Bearer aad-token", req.Header.Get("Authorization"))
+	assert.Empty(t, req.Header.Get("api-key"))
+}
+
+func TestAzureErrors(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	client := gpt3.NewClient("",
+		gpt3.WithHTTPClient(httpClient),
+		gpt3.WithAzure(gpt3.AzureConfig{
+			Endpoint: "https://my-resource.openai.azure.com",
+			TokenProvider: func(ctx context.Context) (string, error) {
+				return "", errors.New("expired")
+			},
+		}),
+	)
+
+	_, err := client.Moderation(context.Background(), gpt3.ModerationRequest{})
+	assert.EqualError(t, err, "operation Moderation is not supported by Azure OpenAI")
+	_, err = client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{})
+	assert.EqualError(t, err, "azure token provider: expired")
+	assert.Equal(t, 0, rt.RoundTripCallCount())
+
+	_, err = gpt3.NewClientWithOptions("key",
+		gpt3.WithAzure(gpt3.AzureConfig{Endpoint: "my-resource"}),
+		gpt3.WithBaseURL("https://example.com"),
+		gpt3.WithAzure(gpt3.AzureConfig{Endpoint: "https://my-resource.openai.azure.com"}),
+	)
+	assert.EqualError(t, err, "invalid client options: "+
+		"invalid azure endpoint \"my-resource\": must be an absolute http or https url; "+
+		"WithBaseURL conflicts with WithAzure, set the endpoint in the AzureConfig instead")
+}
@@ -0,0 +1,432 @@
+package gpt3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Defaults of the circuit breaker of WithBackends, see WithCircuitBreaker.
+const (
+	DefaultCircuitBreakerFailures = 5
+	DefaultCircuitBreakerCooldown = 30 * time.Second
+)
+
+// Backend is an OpenAI compatible API that a client configured with WithBackends sends requests to.
+type Backend struct {
+	// Name identifies the backend in errors. Defaults to the BaseURL.
+	Name string
+
+	// BaseURL is the base url of the API, e.g. "https://api.openai.com/v1".
+	BaseURL string
+
+	// APIKey is the api key of the backend. If it is empty, Credentials are used, or else the api
+	// key of the client.
+	APIKey string
+
+	// Credentials supply the api key of the backend when APIKey is empty.
+	Credentials CredentialProvider
+
+	// Models maps the models requested by calls to the names this backend serves them under.
+	// Models without an entry are requested as is.
+	Models map[string]string
+
+	// Weight is the share of requests the backend receives with RouteByWeight. Defaults to 1.
+	Weight int
+}
+
+// RoutingStrategy chooses which of several backends a call is sent to first.
+type RoutingStrategy int
+
+const (
+	// RouteByWeight picks backends at random in proportion to their weights.
+	RouteByWeight RoutingStrategy = iota
+	// RouteByLatency picks the backend with the lowest recent latency, trying backends that have
+	// no latency measured yet first.
+	RouteByLatency
+	// RouteInOrder picks the first healthy backend, so the others are only used for failover.
+	RouteInOrder
+)
+
+// WithBackends is a client option that spreads calls over several OpenAI compatible backends,
+// replacing the base url of the client. Calls go to a healthy backend chosen by strategy, and
+// non-streaming calls that fail with a network error, a timeout, a 429 or a 5xx response are
+// sent to the next backend. A backend whose requests keep failing is ejected by a circuit
+// breaker, see WithCircuitBreaker. Once the breaker's cooldown has passed, the next call is sent
+// to it as a probe to check whether it has recovered, so a backend that is still down costs that
+// call a failed attempt; WithHealthCheck checks ejected backends with requests of their own
+// instead. If every backend is ejected, the one whose cooldown ends first is still tried. Calls
+// with WithRequestBaseURL go to that url rather than to the backends.
+func WithBackends(strategy RoutingStrategy, backends ...Backend) ClientOption {
+	return func(c *client) error {
+		if len(backends) == 0 {
+			return errors.New("at least one backend is required")
+		}
+		b := &balancer{
+			strategy:         strategy,
+			failureThreshold: DefaultCircuitBreakerFailures,
+			cooldown:         DefaultCircuitBreakerCooldown,
+		}
+		if c.balancer != nil {
+			b.failureThreshold, b.cooldown = c.balancer.failureThreshold, c.balancer.cooldown
+			b.healthPath, b.healthInterval = c.balancer.healthPath, c.balancer.healthInterval
+		}
+		for _, backend := range backends {
+			u, err := url.Parse(backend.BaseURL)
+			if err != nil {
+				return fmt.Errorf("invalid backend url %q: %w", backend.BaseURL, err)
+			}
+			if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("invalid backend url %q: must be an absolute http or https url", backend.BaseURL)
+			}
+			backend.BaseURL = strings.TrimSuffix(backend.BaseURL, "/")
+			if backend.Name == "" {
+				backend.Name = backend.BaseURL
+			}
+			if backend.Weight < 0 {
+				return fmt.Errorf("weight of backend %s must not be negative", backend.Name)
+			}
+			if backend.Weight == 0 {
+				backend.Weight = 1
+			}
+			if err := validateHeaderValue("api key of backend "+backend.Name, backend.APIKey); err != nil {
+				return err
+			}
+			b.backends = append(b.backends, &backendState{Backend: backend})
+		}
+		c.balancer = b
+		return nil
+	}
+}
+
+// WithCircuitBreaker is a client option that configures when WithBackends ejects a backend: after
+// the given number of consecutive failed requests, for the duration of cooldown.
+func WithCircuitBreaker(failures int, cooldown time.Duration) ClientOption {
+	return func(c *client) error {
+		if failures <= 0 {
+			return errors.New("circuit breaker failures must be positive")
+		}
+		if cooldown <= 0 {
+			return errors.New("circuit breaker cooldown must be positive")
+		}
+		if c.balancer == nil {
+			c.balancer = &balancer{}
+		}
+		c.balancer.failureThreshold, c.balancer.cooldown = failures, cooldown
+		return nil
+	}
+}
+
+// WithHealthCheck is a client option that makes WithBackends check whether an ejected backend has
+// recovered with a GET request to path, e.g. "/models", relative to the backend's base url, rather
+// than by sending it a call. A backend is checked once its circuit breaker's cooldown has passed,
+// and again every interval until a check succeeds, which closes the breaker. Checks run in the
+// background but are started by calls, so a client that makes no calls makes no checks.
+func WithHealthCheck(path string, interval time.Duration) ClientOption {
+	return func(c *client) error {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("health check path %q must start with /", path)
+		}
+		if interval <= 0 {
+			return errors.New("health check interval must be positive")
+		}
+		if c.balancer == nil {
+			c.balancer = &balancer{
+				failureThreshold: DefaultCircuitBreakerFailures,
+				cooldown:         DefaultCircuitBreakerCooldown,
+			}
+		}
+		c.balancer.healthPath, c.balancer.healthInterval = path, interval
+		return nil
+	}
+}
+
+type balancer struct {
+	strategy         RoutingStrategy
+	failureThreshold int
+	cooldown         time.Duration
+	healthPath       string
+	healthInterval   time.Duration
+	// client sends the health checks
+	client *client
+
+	mu       sync.Mutex
+	backends []*backendState
+}
+
+type backendState struct {
+	Backend
+
+	// latency is a moving average of the latency of successful non-streaming requests
+	latency   time.Duration
+	failures  int
+	openUntil time.Time
+	probing   bool
+	checking  bool
+}
+
+// candidates returns the backends in the order a call should try them: at most one ejected
+// backend whose cooldown has passed, as a probe, then the healthy ones in the order of the
+// routing strategy. With health checks, ejected backends are checked rather than probed. If no
+// backend is available, the one that becomes available first is tried anyway.
+func (b *balancer) candidates() []*backendState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	var healthy []*backendState
+	var probe, soonest *backendState
+	for _, s := range b.backends {
+		if s.failures < b.failureThreshold {
+			healthy = append(healthy, s)
+			continue
+		}
+		if !now.Before(s.openUntil) {
+			if b.healthPath != "" {
+				if !s.checking {
+					s.checking = true
+					go b.checkHealth(s)
+				}
+			} else if !s.probing && probe == nil {
+				probe = s
+				continue
+			}
+		}
+		if soonest == nil || s.openUntil.Before(soonest.openUntil) {
+			soonest = s
+		}
+	}
+
+	switch b.strategy {
+	case RouteByWeight:
+		healthy = shuffleByWeight(healthy)
+	case RouteByLatency:
+		sort.SliceStable(healthy, func(i, j int) bool { return healthy[i].latency < healthy[j].latency })
+	}
+	if probe != nil {
+		// probe first, as the healthy backends are still there to fail over to
+		probe.probing = true
+		healthy = append([]*backendState{probe}, healthy...)
+	}
+	if len(healthy) == 0 && soonest != nil {
+		healthy = append(healthy, soonest)
+	}
+	return healthy
+}
+
+// shuffleByWeight orders backends by picking them at random, without replacement, with a
+// probability proportional to their weight.
+func shuffleByWeight(backends []*backendState) []*backendState {
+	remaining := append([]*backendState(nil), backends...)
+	ordered := make([]*backendState, 0, len(backends))
+	for len(remaining) > 0 {
+		total := 0
+		for _, s := range remaining {
+			total += s.Weight
+		}
+		n := rand.Intn(total)
+		for i, s := range remaining {
+			if n < s.Weight {
+				ordered = append(ordered, s)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+			n -= s.Weight
+		}
+	}
+	return ordered
+}
+
+// record updates the health of a backend after a request, with failed reporting whether the
+// backend itself failed rather than the call being invalid, and measured whether the latency of
+// the request should count towards the backend's latency.
+func (b *balancer) record(s *backendState, latency time.Duration, failed, measured bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if failed {
+		s.failures++
+		if s.failures >= b.failureThreshold {
+			s.openUntil = time.Now().Add(b.cooldown)
+		}
+		return
+	}
+	s.failures = 0
+	if measured {
+		if s.latency == 0 {
+			s.latency = latency
+		} else {
+			s.latency = (s.latency*4 + latency) / 5
+		}
+	}
+}
+
+// checkHealth checks an ejected backend, closing its circuit breaker if it is healthy, or else
+// scheduling the next check after the health check interval.
+func (b *balancer) checkHealth(s *backendState) {
+	ctx, cancel := context.WithTimeout(context.Background(), b.healthInterval)
+	defer cancel()
+	err := s.check(ctx, b.client, b.healthPath)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s.checking = false
+	if err == nil {
+		s.failures = 0
+	} else {
+		s.openUntil = time.Now().Add(b.healthInterval)
+	}
+}
+
+// check sends a health check request to the backend, authorized like the calls sent to it.
+func (s *backendState) check(ctx context.Context, c *client, path string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.BaseURL+path, nil)
+	if err != nil {
+		return err
+	}
+	apiKey := s.APIKey
+	switch {
+	case apiKey != "":
+	case s.Credentials != nil:
+		apiKey, err = s.Credentials.APIKey(ctx)
+	case c.credentials != nil:
+		apiKey, err = c.credentials.APIKey(ctx)
+	default:
+		apiKey = c.apiKey
+	}
+	if err != nil {
+		return err
+	}
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	req.Header.Set("User-Agent", strings.Join(append([]string{c.userAgent}, c.appInfo...), " "))
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("health check of backend %s failed with status %d", s.Name, resp.StatusCode)
+	}
+	return nil
+}
+
+// release ends the probes of a call, whether or not the call got to the probed backend.
+func (b *balancer) release(candidates []*backendState) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, s := range candidates {
+		s.probing = false
+	}
+}
+
+// middleware is the innermost middleware of a client with backends. It points the call at each
+// candidate backend in turn until one succeeds or the error isn't worth failing over for.
+func (b *balancer) middleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		if call.options.baseURL != "" {
+			// the request is already pointed at the url of the request option
+			return next(ctx, call)
+		}
+		model, engine, path := call.Model(), call.engine, call.path
+		query, apiKey := call.HTTPRequest.URL.RawQuery, call.options.apiKey
+		authorization := call.HTTPRequest.Header.Get("Authorization")
+		candidates := b.candidates()
+		defer b.release(candidates)
+		var err error
+		for _, s := range candidates {
+			// undo the key of the previous backend, so it is never sent to this one
+			call.options.apiKey = apiKey
+			call.HTTPRequest.Header.Set("Authorization", authorization)
+			if err = s.prepare(ctx, call, model, engine, path, query); err != nil {
+				return err
+			}
+			start := time.Now()
+			err = next(ctx, call)
+			failover := isFailover(ctx, err)
+			// rate limits and cancelled calls say nothing about the health of the backend
+			if ctx.Err() == nil && !isRateLimited(err) {
+				b.record(s, time.Since(start), failover, err == nil && !call.Stream())
+			}
+			if err == nil || !failover || call.Stream() {
+				return err
+			}
+		}
+		return err
+	}
+}
+
+// prepare points the HTTP request of the call at the backend, with the model mapped to the
+// backend's name for it. Without a key of the backend, the request keeps the key of the request
+// options or the client, or gets one from the client's credential provider when it is sent.
+func (s *backendState) prepare(ctx context.Context, call *Call, model, engine, path, query string) error {
+	if mapped, ok := s.Models[model]; ok {
+		setModel(call, mapped)
+		if engine != "" {
+			path = strings.Replace(path, "/engines/"+engine+"/", "/engines/"+mapped+"/", 1)
+		}
+	} else {
+		setModel(call, model)
+	}
+	u, err := url.Parse(s.BaseURL + path)
+	if err != nil {
+		return err
+	}
+	u.RawQuery = query
+	call.HTTPRequest.URL, call.HTTPRequest.Host = u, u.Host
+
+	apiKey := s.APIKey
+	if apiKey == "" && s.Credentials != nil {
+		if apiKey, err = s.Credentials.APIKey(ctx); err != nil {
+			return fmt.Errorf("credential provider of backend %s: %w", s.Name, err)
+		}
+	}
+	if apiKey != "" {
+		// the request api key takes precedence over the credential provider of the client
+		call.options.apiKey = apiKey
+		call.HTTPRequest.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return nil
+}
+
+// setModel sets the model of the call's request, or its engine for the engine based endpoints.
+func setModel(call *Call, model string) {
+	switch r := call.Request.(type) {
+	case *ChatCompletionRequest:
+		r.Model = model
+	case *EditsRequest:
+		r.Model = model
+	case *EmbeddingsRequest:
+		r.Model = model
+	case *ModerationRequest:
+		r.Model = model
+	default:
+		if call.engine != "" {
+			call.engine = model
+		}
+	}
+}
+
+// isFailover reports whether a call that failed with err may succeed on another backend.
+func isFailover(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		// no response was received, e.g. the connection failed or the request timed out
+		return true
+	}
+	var apiErr APIError
+	return errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500)
+}
+
+func isRateLimited(err error) bool {
+	var apiErr APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests
+}
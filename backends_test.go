@@ -0,0 +1,247 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+// backendRoundTripper answers requests by host with the configured status and delay, recording
+// the host, api key and model of every request.
+type backendRoundTripper struct {
+	mu       sync.Mutex
+	statuses map[string]int
+	delays   map[string]time.Duration
+	requests []backendRequest
+}
+
+type backendRequest struct {
+	host, auth, model, path string
+}
+
+func (b *backendRoundTripper) roundTrip(req *http.Request) (*http.Response, error) {
+	var body struct {
+		Model string `json:"model"`
+	}
+	if req.Body != nil {
+		_ = json.NewDecoder(req.Body).Decode(&body)
+	}
+	b.mu.Lock()
+	b.requests = append(b.requests, backendRequest{req.URL.Host, req.Header.Get("Authorization"), body.Model, req.URL.Path})
+	status, delay := b.statuses[req.URL.Host], b.delays[req.URL.Host]
+	b.mu.Unlock()
+	time.Sleep(delay)
+	if status == 0 {
+		status = 200
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error": {"message": "backend error", "type": "server_error"}}`)),
+	}, nil
+}
+
+func (b *backendRoundTripper) hosts() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var hosts []string
+	for _, r := range b.requests {
+		hosts = append(hosts, r.host)
+	}
+	return hosts
+}
+
+func newBackendClient(t *testing.T, b *backendRoundTripper, strategy gpt3.RoutingStrategy, options ...gpt3.ClientOption) gpt3.Client {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripStub = b.roundTrip
+	options = append([]gpt3.ClientOption{
+		gpt3.WithHTTPClient(httpClient),
+		gpt3.WithBackends(strategy,
+			gpt3.Backend{Name: "public", BaseURL: "https://public.example.com/v1", APIKey: "public-key"},
+			gpt3.Backend{
+				BaseURL: "https://regional.example.com/openai/v1/",
+				APIKey:  "regional-key",
+				Models:  map[string]string{gpt3.GPT3Dot5Turbo: "gpt-35-turbo", "davinci": "davinci-regional"},
+			},
+		),
+	}, options...)
+	client, err := gpt3.NewClientWithOptions("client-key", options...)
+	assert.NoError(t, err)
+	return client
+}
+
+func TestBackendFailover(t *testing.T) {
+	b := &backendRoundTripper{statuses: map[string]int{"public.example.com": 503}}
+	client := newBackendClient(t, b, gpt3.RouteInOrder)
+
+	_, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{})
+	assert.NoError(t, err)
+	_, err = client.CompletionWithEngine(context.Background(), "davinci", gpt3.CompletionRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, []backendRequest{
+		{"public.example.com", "Bearer public-key", gpt3.GPT3Dot5Turbo, "/v1/chat/completions"},
+		{"regional.example.com", "Bearer regional-key", "gpt-35-turbo", "/openai/v1/chat/completions"},
+		{"public.example.com", "Bearer public-key", "", "/v1/engines/davinci/completions"},
+		{"regional.example.com", "Bearer regional-key", "", "/openai/v1/engines/davinci-regional/completions"},
+	}, b.requests)
+}
+
+func TestBackendStreamsDoNotFailOver(t *testing.T) {
+	b := &backendRoundTripper{statuses: map[string]int{"public.example.com": 503}}
+	client := newBackendClient(t, b, gpt3.RouteInOrder)
+
+	err := client.ChatCompletionStream(context.Background(), gpt3.ChatCompletionRequest{},
+		func(*gpt3.ChatCompletionStreamResponse) error { return nil })
+	assert.Error(t, err)
+	assert.Equal(t, []string{"public.example.com"}, b.hosts())
+}
+
+func TestBackendCircuitBreaker(t *testing.T) {
+	b := &backendRoundTripper{statuses: map[string]int{"public.example.com": 500}}
+	client := newBackendClient(t, b, gpt3.RouteInOrder, gpt3.WithCircuitBreaker(2, 50*time.Millisecond))
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: "model"})
+		assert.NoError(t, err)
+	}
+	// the public backend is ejected after two failures
+	assert.Equal(t, []string{
+		"public.example.com", "regional.example.com",
+		"public.example.com", "regional.example.com",
+		"regional.example.com",
+	}, b.hosts())
+
+	// once the cooldown has passed it is probed, and used again once it recovered
+	time.Sleep(60 * time.Millisecond)
+	b.mu.Lock()
+	b.statuses, b.requests = nil, nil
+	b.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: "model"})
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"public.example.com", "public.example.com"}, b.hosts())
+}
+
+func TestBackendHealthCheck(t *testing.T) {
+	b := &backendRoundTripper{statuses: map[string]int{"public.example.com": 500}}
+	client := newBackendClient(t, b, gpt3.RouteInOrder,
+		gpt3.WithCircuitBreaker(1, 20*time.Millisecond), gpt3.WithHealthCheck("/models", 20*time.Millisecond))
+	embed := func() {
+		_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: "model"})
+		assert.NoError(t, err)
+	}
+	requestsTo := func(host, path string) int {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		n := 0
+		for _, r := range b.requests {
+			if r.host == host && r.path == path {
+				n++
+			}
+		}
+		return n
+	}
+
+	// the public backend is ejected, and once its cooldown has passed it is checked rather than
+	// sent the next call
+	embed()
+	time.Sleep(30 * time.Millisecond)
+	embed()
+	assert.Eventually(t, func() bool { return requestsTo("public.example.com", "/v1/models") == 1 },
+		time.Second, 5*time.Millisecond)
+	assert.Equal(t, 1, requestsTo("public.example.com", "/v1/embeddings"))
+	assert.Equal(t, 2, requestsTo("regional.example.com", "/openai/v1/embeddings"))
+
+	// the failed check keeps it ejected until the next check succeeds
+	b.mu.Lock()
+	b.statuses = nil
+	b.mu.Unlock()
+	embed()
+	assert.Equal(t, 1, requestsTo("public.example.com", "/v1/models"))
+	time.Sleep(30 * time.Millisecond)
+	embed()
+	assert.Eventually(t, func() bool { return requestsTo("public.example.com", "/v1/models") == 2 },
+		time.Second, 5*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	embed()
+	assert.Equal(t, 2, requestsTo("public.example.com", "/v1/embeddings"))
+}
+
+func TestBackendRequestBaseURL(t *testing.T) {
+	b := &backendRoundTripper{}
+	client := newBackendClient(t, b, gpt3.RouteInOrder)
+
+	_, err := client.Engines(context.Background(), gpt3.WithRequestBaseURL("https://other.example.com/v1"))
+	assert.NoError(t, err)
+	assert.Equal(t, []backendRequest{{"other.example.com", "Bearer client-key", "", "/v1/engines"}}, b.requests)
+}
+
+func TestBackendRouteByLatency(t *testing.T) {
+	b := &backendRoundTripper{delays: map[string]time.Duration{"public.example.com": 20 * time.Millisecond}}
+	client := newBackendClient(t, b, gpt3.RouteByLatency)
+
+	for i := 0; i < 4; i++ {
+		_, err := client.Engines(context.Background())
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, []string{"public.example.com", "regional.example.com", "regional.example.com", "regional.example.com"}, b.hosts())
+}
+
+func TestBackendOptionErrors(t *testing.T) {
+	_, err := gpt3.NewClientWithOptions("key", gpt3.WithCircuitBreaker(3, time.Second))
+	assert.EqualError(t, err, "invalid client options: WithCircuitBreaker requires WithBackends")
+	_, err = gpt3.NewClientWithOptions("key", gpt3.WithHealthCheck("/models", time.Second))
+	assert.EqualError(t, err, "invalid client options: WithHealthCheck requires WithBackends")
+	_, err = gpt3.NewClientWithOptions("key", gpt3.WithHealthCheck("models", 0))
+	assert.EqualError(t, err, "invalid client options: health check path \"models\" must start with /")
+
+	_, err = gpt3.NewClientWithOptions("key",
+		gpt3.WithBaseURL("https://example.com"),
+		gpt3.WithBackends(gpt3.RouteByWeight, gpt3.Backend{BaseURL: "https://a.example.com", Weight: 2}),
+	)
+	assert.EqualError(t, err, "invalid client options: WithBaseURL conflicts with WithBackends, set the url of each Backend instead")
+
+	_, err = gpt3.NewClientWithOptions("key", gpt3.WithBackends(gpt3.RouteByWeight, gpt3.Backend{BaseURL: "a.example.com"}))
+	assert.EqualError(t, err, "invalid client options: invalid backend url \"a.example.com\": must be an absolute http or https url")
+}
+
+func TestBackendFailoverToBackendWithoutKey(t *testing.T) {
+	b := &backendRoundTripper{statuses: map[string]int{"keyed.example.com": 503}}
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripStub = b.roundTrip
+	backends := gpt3.WithBackends(gpt3.RouteInOrder,
+		gpt3.Backend{BaseURL: "https://keyed.example.com/v1", APIKey: "keyed-secret"},
+		gpt3.Backend{BaseURL: "https://unkeyed.example.com/v1"},
+	)
+
+	client, err := gpt3.NewClientWithOptions("client-key", gpt3.WithHTTPClient(httpClient), backends)
+	assert.NoError(t, err)
+	_, err = client.Engines(context.Background())
+	assert.NoError(t, err)
+	_, err = client.Engines(context.Background(), gpt3.WithRequestAPIKey("request-key"))
+	assert.NoError(t, err)
+
+	client, err = gpt3.NewClientWithOptions("", gpt3.WithHTTPClient(httpClient), backends,
+		gpt3.WithCredentialProvider(gpt3.NewRotatingCredentials("provided-key")))
+	assert.NoError(t, err)
+	_, err = client.Engines(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []backendRequest{
+		{"keyed.example.com", "Bearer keyed-secret", "", "/v1/engines"},
+		{"unkeyed.example.com", "Bearer client-key", "", "/v1/engines"},
+		{"keyed.example.com", "Bearer keyed-secret", "", "/v1/engines"},
+		{"unkeyed.example.com", "Bearer request-key", "", "/v1/engines"},
+		{"keyed.example.com", "Bearer keyed-secret", "", "/v1/engines"},
+		{"unkeyed.example.com", "Bearer provided-key", "", "/v1/engines"},
+	}, b.requests)
+}
@@ -0,0 +1,475 @@
+// Package chunker splits long documents into chunks of a limited number of tokens, so that each
+// chunk fits the input limit of an embedding model and can be cited back to the source text.
+//
+// Chunks end at the strongest boundary that keeps them under the limit: between paragraphs,
+// Markdown headings and fenced code blocks first, then between sentences or lines, then between
+// words, and only within a word that is longer than the limit by itself. Consecutive chunks can
+// overlap by a number of tokens, so that text near a boundary keeps its context in both chunks:
+//
+//	splitter, err := chunker.New(chunker.WithMaxTokens(256), chunker.WithOverlap(32))
+//	chunks := splitter.Split(document)
+//	embeddings, err := gpt3.EmbedAll(ctx, client, gpt3.TextEmbedding3Small, chunker.Texts(chunks))
+package chunker
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PullRequestInc/go-gpt3"
+)
+
+// Defaults of a Splitter, see the Option functions.
+const (
+	DefaultMaxTokens = 512
+	DefaultOverlap   = 0
+)
+
+// Chunk is a part of a source text.
+type Chunk struct {
+	// Index is the position of the chunk among the chunks of the source text.
+	Index int
+	// Text is the text of the chunk, which is always Source[Start:End].
+	Text string
+	// Start and End are the byte offsets of the chunk in the source text.
+	Start, End int
+	// Tokens is the number of tokens of Text, as counted by the Splitter's token counter.
+	Tokens int
+}
+
+// Texts returns the text of each chunk, e.g. to embed the chunks.
+func Texts(chunks []Chunk) []string {
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Text
+	}
+	return texts
+}
+
+// Option are options that can be passed to New.
+type Option func(*Splitter) error
+
+// WithMaxTokens sets the maximum number of tokens of a chunk, which must be positive. Defaults to
+// DefaultMaxTokens.
+func WithMaxTokens(tokens int) Option {
+	return func(s *Splitter) error {
+		if tokens <= 0 {
+			return fmt.Errorf("max tokens must be positive, got %d", tokens)
+		}
+		s.maxTokens = tokens
+		return nil
+	}
+}
+
+// WithOverlap sets how many tokens at the end of a chunk are repeated at the start of the next
+// one, in whole sentences or words. It is capped at half of the maximum tokens of a chunk.
+// Defaults to DefaultOverlap.
+func WithOverlap(tokens int) Option {
+	return func(s *Splitter) error {
+		if tokens < 0 {
+			return fmt.Errorf("overlap must not be negative, got %d", tokens)
+		}
+		s.overlap = tokens
+		return nil
+	}
+}
+
+// WithTokenCounter sets the function that counts the tokens of a text, which should be the
+// tokenizer of the model the chunks are for. Defaults to gpt3.EstimateTokens.
+func WithTokenCounter(countTokens func(text string) int) Option {
+	return func(s *Splitter) error {
+		if countTokens == nil {
+			return errors.New("token counter must not be nil")
+		}
+		s.countTokens = countTokens
+		return nil
+	}
+}
+
+// Splitter splits texts into chunks. It is safe for concurrent use if its token counter is.
+type Splitter struct {
+	maxTokens   int
+	overlap     int
+	countTokens func(text string) int
+}
+
+// New returns a Splitter configured by options. It fails if an option is invalid.
+func New(options ...Option) (*Splitter, error) {
+	s := &Splitter{
+		maxTokens:   DefaultMaxTokens,
+		overlap:     DefaultOverlap,
+		countTokens: gpt3.EstimateTokens,
+	}
+	for _, o := range options {
+		if err := o(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Split splits text into chunks of at most the maximum number of tokens, in the order of the
+// text. Whitespace between chunks is left out, and text of only whitespace has no chunks. A
+// chunk only exceeds the maximum if it is a single character that does.
+func (s *Splitter) Split(text string) []Chunk {
+	overlap := s.overlap
+	if overlap > s.maxTokens/2 {
+		overlap = s.maxTokens / 2
+	}
+	p := &packer{splitter: s, text: text, overlap: overlap}
+	for _, u := range s.units(text, span{0, len(text)}, levelBlock, levelBlock) {
+		p.add(u)
+	}
+	p.flush(len(p.units))
+	return p.chunks
+}
+
+// span is a range of bytes of the source text.
+type span struct {
+	start, end int
+}
+
+// The boundaries a text is split at, from the strongest to the weakest.
+const (
+	levelBlock = iota
+	levelSentence
+	levelWord
+	levelRune
+)
+
+// unit is a part of the text that is never split, with the level of the boundary before it.
+type unit struct {
+	span
+	boundary int
+}
+
+// units splits a span of text at the boundaries of level, and splits the parts that are still
+// longer than the maximum at weaker boundaries, so that every unit fits in a chunk by itself. The
+// first unit has the boundary before the span.
+func (s *Splitter) units(text string, sp span, level, boundary int) []unit {
+	var parts []span
+	switch level {
+	case levelBlock:
+		parts = blocks(text, sp)
+	case levelSentence:
+		parts = sentences(text, sp)
+	case levelWord:
+		parts = words(text, sp)
+	default:
+		parts = s.runes(text, sp)
+	}
+	var units []unit
+	for i, part := range parts {
+		if i > 0 {
+			boundary = level
+		}
+		switch {
+		case level == levelRune || s.countTokens(text[part.start:part.end]) <= s.maxTokens:
+			units = append(units, unit{part, boundary})
+		case level == levelBlock && isFence(text, part):
+			// code is split at lines rather than sentences
+			for j, line := range lines(text, part) {
+				if j > 0 {
+					boundary = levelSentence
+				}
+				if s.countTokens(text[line.start:line.end]) <= s.maxTokens {
+					units = append(units, unit{line, boundary})
+				} else {
+					units = append(units, s.units(text, line, levelWord, boundary)...)
+				}
+			}
+		default:
+			units = append(units, s.units(text, part, level+1, boundary)...)
+		}
+	}
+	return units
+}
+
+// runes splits a span into the longest runs of characters that fit in a chunk.
+func (s *Splitter) runes(text string, sp span) []span {
+	var ends []int
+	for i := range text[sp.start:sp.end] {
+		if i > 0 {
+			ends = append(ends, sp.start+i)
+		}
+	}
+	ends = append(ends, sp.end)
+
+	var parts []span
+	for start := sp.start; len(ends) > 0; {
+		// the longest run that fits, but at least one character
+		n := sort.Search(len(ends), func(i int) bool {
+			return s.countTokens(text[start:ends[i]]) > s.maxTokens
+		})
+		if n == 0 {
+			n = 1
+		}
+		parts = append(parts, span{start, ends[n-1]})
+		start, ends = ends[n-1], ends[n:]
+	}
+	return parts
+}
+
+// packer merges consecutive units into chunks.
+type packer struct {
+	splitter *Splitter
+	text     string
+	overlap  int
+
+	// units are the units of the next chunk, starting with carried units of overlap
+	units   []unit
+	carried int
+	chunks  []Chunk
+}
+
+// tokens counts the tokens of the text from the first to the last of units.
+func (p *packer) tokens(units ...unit) int {
+	return p.splitter.countTokens(p.text[units[0].start:units[len(units)-1].end])
+}
+
+// add appends a unit to the next chunk. If it doesn't fit, a chunk is made of the units before
+// it first, or of fewer units if that ends the chunk at a stronger boundary.
+func (p *packer) add(u unit) {
+	if len(p.units) > 0 && p.tokens(p.units[0], u) > p.splitter.maxTokens {
+		n := p.cut(u)
+		p.flush(n)
+		// keep the last units of the chunk as the overlap, as long as the next chunk still fits
+		keep := n
+		for keep > 0 && p.tokens(p.units[keep-1], p.units[n-1]) <= p.overlap &&
+			p.tokens(p.units[keep-1], u) <= p.splitter.maxTokens {
+			keep--
+		}
+		// the units after the chunk haven't been in a chunk yet, so they aren't carried
+		p.units, p.carried = p.units[keep:], n-keep
+	}
+	p.units = append(p.units, u)
+}
+
+// cut returns how many of the units to make a chunk of when u doesn't fit: all of them, unless
+// the units end with a weaker boundary than an earlier one that leaves the chunk at least half
+// full and the units after it room for u.
+func (p *packer) cut(u unit) int {
+	best, bestBoundary := len(p.units), u.boundary
+	for k := len(p.units) - 1; k > p.carried; k-- {
+		boundary := p.units[k].boundary
+		if boundary >= bestBoundary {
+			continue
+		}
+		if p.tokens(p.units[0], p.units[k-1]) < p.splitter.maxTokens/2 {
+			break
+		}
+		if p.tokens(p.units[k], u) <= p.splitter.maxTokens {
+			best, bestBoundary = k, boundary
+		}
+	}
+	return best
+}
+
+// flush makes a chunk of the first n units.
+func (p *packer) flush(n int) {
+	if n <= p.carried {
+		// the units are all overlap of the previous chunk
+		return
+	}
+	start, end := p.units[0].start, p.units[n-1].end
+	p.chunks = append(p.chunks, Chunk{
+		Index:  len(p.chunks),
+		Text:   p.text[start:end],
+		Start:  start,
+		End:    end,
+		Tokens: p.splitter.countTokens(p.text[start:end]),
+	})
+}
+
+// blocks splits a span into paragraphs, Markdown headings and fenced code blocks. Paragraphs are
+// separated by blank lines, headings are blocks of their own and code blocks are kept whole, even
+// with blank lines inside.
+func blocks(text string, sp span) []span {
+	var parts []span
+	blockStart := -1
+	end := func(at int) {
+		if blockStart >= 0 {
+			parts = append(parts, trim(text, span{blockStart, at}))
+			blockStart = -1
+		}
+	}
+	fence := ""
+	for lineStart := sp.start; lineStart < sp.end; {
+		lineEnd := strings.IndexByte(text[lineStart:sp.end], '\n')
+		if lineEnd < 0 {
+			lineEnd = sp.end
+		} else {
+			lineEnd += lineStart
+		}
+		line := text[lineStart:lineEnd]
+		next := lineEnd + 1
+		if next > sp.end {
+			next = sp.end
+		}
+
+		switch {
+		case fence != "":
+			if isFenceLine(line, fence) {
+				fence = ""
+				end(lineEnd)
+			}
+		case fenceMarker(line) != "":
+			end(lineStart)
+			fence = fenceMarker(line)
+			blockStart = lineStart
+		case strings.TrimSpace(line) == "":
+			end(lineStart)
+		case isHeading(line):
+			end(lineStart)
+			parts = append(parts, trim(text, span{lineStart, lineEnd}))
+		default:
+			if blockStart < 0 {
+				blockStart = lineStart
+			}
+		}
+		lineStart = next
+	}
+	end(sp.end)
+	return nonEmpty(parts)
+}
+
+// sentences splits a span into sentences and lines.
+func sentences(text string, sp span) []span {
+	var parts []span
+	start := sp.start
+	for i := sp.start; i < sp.end; i++ {
+		c := text[i]
+		if c == '\n' {
+			parts = append(parts, trim(text, span{start, i}))
+			start = i + 1
+			continue
+		}
+		if c != '.' && c != '!' && c != '?' {
+			continue
+		}
+		// a sentence ends after its punctuation and any closing quotes or brackets, if followed by space
+		j := i + 1
+		for j < sp.end && strings.IndexByte(`"')]`, text[j]) >= 0 {
+			j++
+		}
+		if j == sp.end || text[j] == ' ' || text[j] == '\t' || text[j] == '\n' || text[j] == '\r' {
+			parts = append(parts, trim(text, span{start, j}))
+			start = j
+			i = j - 1
+		}
+	}
+	parts = append(parts, trim(text, span{start, sp.end}))
+	return nonEmpty(parts)
+}
+
+// lines splits a span into its non-blank lines, keeping their indentation.
+func lines(text string, sp span) []span {
+	var parts []span
+	for start := sp.start; start < sp.end; {
+		end := strings.IndexByte(text[start:sp.end], '\n')
+		if end < 0 {
+			end = sp.end
+		} else {
+			end += start
+		}
+		if trimmed := trim(text, span{start, end}); trimmed.end > trimmed.start {
+			parts = append(parts, span{start, trimmed.end})
+		}
+		start = end + 1
+	}
+	return parts
+}
+
+// words splits a span at whitespace.
+func words(text string, sp span) []span {
+	var parts []span
+	start := -1
+	for i, r := range text[sp.start:sp.end] {
+		i += sp.start
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				parts = append(parts, span{start, i})
+				start = -1
+			}
+		} else if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, span{start, sp.end})
+	}
+	return parts
+}
+
+// trim shrinks a span to exclude leading and trailing whitespace.
+func trim(text string, sp span) span {
+	for sp.start < sp.end {
+		r, size := utf8.DecodeRuneInString(text[sp.start:sp.end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		sp.start += size
+	}
+	for sp.end > sp.start {
+		r, size := utf8.DecodeLastRuneInString(text[sp.start:sp.end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		sp.end -= size
+	}
+	return sp
+}
+
+func nonEmpty(parts []span) []span {
+	out := parts[:0]
+	for _, part := range parts {
+		if part.end > part.start {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// fenceMarker returns the backticks or tildes that open a fenced code block on line, if any.
+func fenceMarker(line string) string {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return ""
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	if n < 3 {
+		return ""
+	}
+	return trimmed[:n]
+}
+
+// isFenceLine reports whether line closes a code block opened with fence.
+func isFenceLine(line, fence string) bool {
+	marker := fenceMarker(line)
+	return marker != "" && marker[0] == fence[0] && len(marker) >= len(fence) &&
+		strings.TrimSpace(strings.TrimLeft(line, " ")[len(marker):]) == ""
+}
+
+// isFence reports whether a block is a fenced code block.
+func isFence(text string, sp span) bool {
+	return fenceMarker(text[sp.start:sp.end]) != ""
+}
+
+// isHeading reports whether line is a Markdown ATX heading, e.g. "## Usage".
+func isHeading(line string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == '#' {
+		n++
+	}
+	return n >= 1 && n <= 6 && (n == len(trimmed) || trimmed[n] == ' ' || trimmed[n] == '\t')
+}
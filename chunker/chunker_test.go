@@ -0,0 +1,129 @@
+package chunker_test
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3/chunker"
+	"github.com/stretchr/testify/assert"
+)
+
+// countWords counts every word as a token, which makes the expected chunks easy to work out.
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+func assertChunks(t *testing.T, text string, chunks []chunker.Chunk, max int) {
+	t.Helper()
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Index)
+		assert.Equal(t, text[chunk.Start:chunk.End], chunk.Text)
+		assert.Equal(t, countWords(chunk.Text), chunk.Tokens)
+		assert.LessOrEqual(t, chunk.Tokens, max, chunk.Text)
+	}
+}
+
+func newSplitter(t *testing.T, options ...chunker.Option) *chunker.Splitter {
+	splitter, err := chunker.New(options...)
+	assert.NoError(t, err)
+	return splitter
+}
+
+func TestOptionErrors(t *testing.T) {
+	_, err := chunker.New(chunker.WithMaxTokens(0))
+	assert.EqualError(t, err, "max tokens must be positive, got 0")
+	_, err = chunker.New(chunker.WithOverlap(-1))
+	assert.EqualError(t, err, "overlap must not be negative, got -1")
+	_, err = chunker.New(chunker.WithTokenCounter(nil))
+	assert.EqualError(t, err, "token counter must not be nil")
+}
+
+func TestSplitParagraphsAndSentences(t *testing.T) {
+	text := "One two three. Four five six.\n\nSeven eight. Nine ten eleven twelve thirteen.\n\nFourteen."
+	splitter := newSplitter(t, chunker.WithMaxTokens(6), chunker.WithTokenCounter(countWords))
+	chunks := splitter.Split(text)
+	assertChunks(t, text, chunks, 6)
+	assert.Equal(t, []string{
+		"One two three. Four five six.",
+		"Seven eight.",
+		"Nine ten eleven twelve thirteen.\n\nFourteen.",
+	}, chunker.Texts(chunks))
+}
+
+func TestSplitLongWords(t *testing.T) {
+	text := strings.Repeat("a", 10) + " " + strings.Repeat("b", 3)
+	chunks := newSplitter(t, chunker.WithMaxTokens(1)).Split(text)
+	assert.Equal(t, []string{"aaaa", "aaaa", "aa", "bbb"}, chunker.Texts(chunks))
+	assert.Equal(t, 11, chunks[3].Start)
+}
+
+func TestSplitMarkdown(t *testing.T) {
+	text := "# Title\nIntro text here.\n\n```go\nfunc main() {\n\n\tfmt.Println(\"hi. there\")\n}\n```\n## Next\nMore text."
+	chunks := newSplitter(t, chunker.WithMaxTokens(4), chunker.WithTokenCounter(countWords)).Split(text)
+	assertChunks(t, text, chunks, 4)
+	assert.Equal(t, []string{
+		"# Title",
+		"Intro text here.",
+		"```go\nfunc main() {",
+		"\tfmt.Println(\"hi. there\")\n}\n```",
+		"## Next\nMore text.",
+	}, chunker.Texts(chunks))
+
+	// a code block that fits is kept whole, blank lines and all
+	chunks = newSplitter(t, chunker.WithMaxTokens(20), chunker.WithTokenCounter(countWords)).Split(text)
+	assert.Equal(t, []string{
+		"# Title\nIntro text here.\n\n```go\nfunc main() {\n\n\tfmt.Println(\"hi. there\")\n}\n```\n## Next\nMore text.",
+	}, chunker.Texts(chunks))
+}
+
+func TestSplitOverlap(t *testing.T) {
+	text := "A b. C d. E f. G h. I j."
+	chunks := newSplitter(t, chunker.WithMaxTokens(4), chunker.WithOverlap(2), chunker.WithTokenCounter(countWords)).Split(text)
+	assertChunks(t, text, chunks, 4)
+	assert.Equal(t, []string{"A b. C d.", "C d. E f.", "E f. G h.", "G h. I j."}, chunker.Texts(chunks))
+}
+
+func TestSplitEmpty(t *testing.T) {
+	assert.Empty(t, newSplitter(t).Split(" \n\n\t "))
+}
+
+func TestSplitDefaults(t *testing.T) {
+	text := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 200)
+	chunks := newSplitter(t).Split(text)
+	assert.Len(t, chunks, 5)
+	for _, chunk := range chunks {
+		assert.LessOrEqual(t, chunk.Tokens, chunker.DefaultMaxTokens)
+		assert.True(t, strings.HasSuffix(chunk.Text, "."), chunk.Text)
+	}
+	// the chunks cover the text without gaps other than whitespace
+	for i := 1; i < len(chunks); i++ {
+		assert.Equal(t, " ", text[chunks[i-1].End:chunks[i].Start])
+	}
+}
+
+func TestSplitCoversText(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	pieces := []string{"word", "longerword", ". ", "! ", "\n", "\n\n", "# Heading\n", "\n```\ncode line\n\n", "\n```\n", " ", "é"}
+	for n := 0; n < 200; n++ {
+		var b strings.Builder
+		for i := rng.Intn(200); i > 0; i-- {
+			b.WriteString(pieces[rng.Intn(len(pieces))])
+		}
+		text := b.String()
+		max := 1 + rng.Intn(20)
+		chunks := newSplitter(t, chunker.WithMaxTokens(max), chunker.WithOverlap(rng.Intn(max))).Split(text)
+
+		covered := 0
+		for i, chunk := range chunks {
+			assert.Equal(t, text[chunk.Start:chunk.End], chunk.Text)
+			assert.LessOrEqual(t, chunk.Tokens, max, chunk.Text)
+			if chunk.Start > covered {
+				assert.Equal(t, "", strings.TrimSpace(text[covered:chunk.Start]), "gap before chunk %d", i)
+			}
+			assert.Greater(t, chunk.End, covered)
+			covered = chunk.End
+		}
+		assert.Equal(t, "", strings.TrimSpace(text[covered:]))
+	}
+}
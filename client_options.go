@@ -1,24 +1,64 @@
 package gpt3
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
 // ClientOption are options that can be passed when creating a new client
 type ClientOption func(*client) error
 
+// OptionsError is returned by NewClientWithOptions when the api key or any of the options are invalid.
+type OptionsError struct {
+	Errors []error
+}
+
+func (e *OptionsError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+	return "invalid client options: " + strings.Join(messages, "; ")
+}
+
+// Unwrap returns the individual option errors.
+func (e *OptionsError) Unwrap() []error {
+	return e.Errors
+}
+
 // WithOrg is a client option that allows you to override the organization ID
 func WithOrg(id string) ClientOption {
 	return func(c *client) error {
+		if err := validateHeaderValue("organization", id); err != nil {
+			return err
+		}
 		c.idOrg = id
 		return nil
 	}
 }
 
+// WithProject is a client option that sets the OpenAI-Project header, so that usage is attributed
+// to the given project.
+func WithProject(id string) ClientOption {
+	return func(c *client) error {
+		if err := validateHeaderValue("project", id); err != nil {
+			return err
+		}
+		c.project = id
+		return nil
+	}
+}
+
 // WithDefaultEngine is a client option that allows you to override the default engine of the client
 func WithDefaultEngine(engine string) ClientOption {
 	return func(c *client) error {
+		if engine == "" {
+			return errors.New("default engine must not be empty")
+		}
 		c.defaultEngine = engine
 		return nil
 	}
@@ -27,16 +67,49 @@ func WithDefaultEngine(engine string) ClientOption {
 // WithUserAgent is a client option that allows you to override the default user agent of the client
 func WithUserAgent(userAgent string) ClientOption {
 	return func(c *client) error {
+		if err := validateHeaderValue("user agent", userAgent); err != nil {
+			return err
+		}
 		c.userAgent = userAgent
 		return nil
 	}
 }
 
+// WithAppInfo is a client option that appends "name/version" to the User-Agent header, so that your
+// application can be identified in the API logs. It can be given more than once, and composes with
+// WithUserAgent.
+func WithAppInfo(name, version string) ClientOption {
+	return func(c *client) error {
+		if name == "" || strings.ContainsAny(name, " /") {
+			return fmt.Errorf("invalid app name %q: must be non-empty and contain no spaces or slashes", name)
+		}
+		if strings.ContainsAny(version, " /") {
+			return fmt.Errorf("invalid app version %q: must contain no spaces or slashes", version)
+		}
+		product := name
+		if version != "" {
+			product += "/" + version
+		}
+		if err := validateHeaderValue("app info", product); err != nil {
+			return err
+		}
+		c.appInfo = append(c.appInfo, product)
+		return nil
+	}
+}
+
 // WithBaseURL is a client option that allows you to override the default base url of the client.
 // The default base url is "https://api.openai.com/v1"
 func WithBaseURL(baseURL string) ClientOption {
 	return func(c *client) error {
-		c.baseURL = baseURL
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return fmt.Errorf("invalid base url %q: %w", baseURL, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid base url %q: must be an absolute http or https url", baseURL)
+		}
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
 		return nil
 	}
 }
@@ -44,6 +117,9 @@ func WithBaseURL(baseURL string) ClientOption {
 // WithHTTPClient allows you to override the internal http.Client used
 func WithHTTPClient(httpClient *http.Client) ClientOption {
 	return func(c *client) error {
+		if httpClient == nil {
+			return errors.New("http client must not be nil")
+		}
 		c.httpClient = httpClient
 		return nil
 	}
@@ -51,10 +127,39 @@ func WithHTTPClient(httpClient *http.Client) ClientOption {
 
 // WithTimeout is a client option that allows you to override the default timeout duration of requests
 // for the client. The default is 30 seconds. If you are overriding the http client as well, just include
-// the timeout there.
+// the timeout there; the client passed to WithHTTPClient is never modified.
 func WithTimeout(timeout time.Duration) ClientOption {
 	return func(c *client) error {
-		c.httpClient.Timeout = timeout
+		if timeout < 0 {
+			return fmt.Errorf("timeout must not be negative, got %s", timeout)
+		}
+		c.timeout = &timeout
+		return nil
+	}
+}
+
+// WithMiddleware is a client option that wraps every API call with the given middlewares. Middlewares
+// see the operation name, the typed request, the HTTP request and the response or error of each call,
+// and can modify, short-circuit or retry it. They run in the order given, with the first middleware
+// being the outermost, and can be passed multiple times to append more.
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(c *client) error {
+		for _, m := range middlewares {
+			if m == nil {
+				return errors.New("middleware must not be nil")
+			}
+		}
+		c.middlewares = append(c.middlewares, middlewares...)
 		return nil
 	}
 }
+
+// validateHeaderValue returns an error if value can't be sent as an HTTP header value.
+func validateHeaderValue(name, value string) error {
+	for _, r := range value {
+		if (r < ' ' && r != '\t') || r == 0x7f {
+			return fmt.Errorf("invalid %s %q: contains control characters", name, value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientWithOptions(t *testing.T) {
+	client, err := gpt3.NewClientWithOptions("test-key",
+		gpt3.WithBaseURL("http://localhost:8080/v1/"),
+		gpt3.WithOrg("org-123"),
+		gpt3.WithTimeout(time.Second),
+	)
+	assert.NoError(t, err)
+	assert.NotNil(t, client)
+}
+
+func TestNewClientWithOptionsReportsAllErrors(t *testing.T) {
+	client, err := gpt3.NewClientWithOptions("",
+		gpt3.WithBaseURL("localhost:8080"),
+		gpt3.WithOrg("org\n123"),
+		gpt3.WithHTTPClient(nil),
+		gpt3.WithTimeout(-time.Second),
+	)
+	assert.Nil(t, client)
+
+	var optionsErr *gpt3.OptionsError
+	assert.True(t, errors.As(err, &optionsErr))
+	assert.Len(t, optionsErr.Errors, 5)
+	assert.EqualError(t, err, "invalid client options: "+
+		"invalid base url \"localhost:8080\": must be an absolute http or https url; "+
+		"invalid organization \"org\\n123\": contains control characters; "+
+		"http client must not be nil; "+
+		"timeout must not be negative, got -1s; "+
+		"an api key is required")
+}
+
+func TestTimeoutConflictsWithHTTPClient(t *testing.T) {
+	httpClient := &http.Client{Timeout: time.Minute}
+
+	_, err := gpt3.NewClientWithOptions("test-key", gpt3.WithTimeout(time.Second), gpt3.WithHTTPClient(httpClient))
+	assert.EqualError(t, err, "invalid client options: WithTimeout conflicts with WithHTTPClient, "+
+		"set the timeout on the http.Client instead")
+
+	// NewClient still applies the timeout, but never to the caller's http client
+	gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient), gpt3.WithTimeout(time.Second))
+	assert.Equal(t, time.Minute, httpClient.Timeout)
+}
+
+func TestOptionsAreOrderIndependent(t *testing.T) {
+	for _, options := range [][]gpt3.ClientOption{
+		{gpt3.WithHTTPClient(nil), gpt3.WithBaseURL("http://localhost/v1")},
+		{gpt3.WithBaseURL("http://localhost/v1"), gpt3.WithHTTPClient(nil)},
+	} {
+		rt, httpClient := fakeHttpClient()
+		rt.RoundTripReturns(&http.Response{
+			StatusCode: 200,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{}`)),
+		}, nil)
+		options = append(options, gpt3.WithHTTPClient(httpClient))
+
+		_, err := gpt3.NewClient("test-key", options...).Engines(context.Background())
+		assert.NoError(t, err)
+		assert.Equal(t, "http://localhost/v1/engines", rt.RoundTripArgsForCall(0).URL.String())
+	}
+}
+
+func TestIdentificationHeaders(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))}, nil
+	}
+	client := gpt3.NewClient("test-key",
+		gpt3.WithHTTPClient(httpClient),
+		gpt3.WithAppInfo("my-app", "1.2.3"),
+		gpt3.WithUserAgent("custom-agent"),
+		gpt3.WithAppInfo("plugin", ""),
+		gpt3.WithOrg("org-default"),
+		gpt3.WithProject("proj-default"),
+	)
+
+	_, err := client.Engines(context.Background())
+	assert.NoError(t, err)
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "custom-agent my-app/1.2.3 plugin", req.Header.Get("User-Agent"))
+	assert.Equal(t, "org-default", req.Header.Get("OpenAI-Organization"))
+	assert.Equal(t, "proj-default", req.Header.Get("OpenAI-Project"))
+
+	_, err = client.Engines(context.Background(), gpt3.WithRequestOrg("org-tenant"), gpt3.WithRequestProject("proj-tenant"))
+	assert.NoError(t, err)
+	req = rt.RoundTripArgsForCall(1)
+	assert.Equal(t, "org-tenant", req.Header.Get("OpenAI-Organization"))
+	assert.Equal(t, "proj-tenant", req.Header.Get("OpenAI-Project"))
+}
+
+func TestDefaultUserAgent(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))}, nil)
+
+	_, err := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient)).Engines(context.Background())
+	assert.NoError(t, err)
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "go-gpt3", req.Header.Get("User-Agent"))
+	assert.Empty(t, req.Header.Get("OpenAI-Project"))
+}
+
+func TestInvalidAppInfo(t *testing.T) {
+	_, err := gpt3.NewClientWithOptions("test-key", gpt3.WithAppInfo("my app", "1"), gpt3.WithAppInfo("app", "1/2"))
+	assert.EqualError(t, err, "invalid client options: "+
+		"invalid app name \"my app\": must be non-empty and contain no spaces or slashes; "+
+		"invalid app version \"1/2\": must contain no spaces or slashes")
+}
@@ -0,0 +1,231 @@
+package gpt3
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Environment variables read by NewClientFromEnv.
+const (
+	EnvAPIKey     = "OPENAI_API_KEY"
+	EnvBaseURL    = "OPENAI_BASE_URL"
+	EnvOrgID      = "OPENAI_ORG_ID"
+	EnvProjectID  = "OPENAI_PROJECT_ID"
+	EnvTimeout    = "OPENAI_TIMEOUT"
+	EnvMaxRetries = "OPENAI_MAX_RETRIES"
+	EnvProfile    = "OPENAI_PROFILE"
+	EnvConfigFile = "OPENAI_CONFIG_FILE"
+)
+
+// Config is the format of a config file with named profiles, for example:
+//
+//	{
+//	  "default_profile": "dev",
+//	  "profiles": {
+//	    "dev": {"api_key_env": "OPENAI_API_KEY", "max_retries": 2},
+//	    "local": {"api_key": "unused", "base_url": "http://localhost:8080/v1"},
+//	    "azure": {
+//	      "api_key_file": "/run/secrets/azure-openai-key",
+//	      "azure": {"endpoint": "https://my-resource.openai.azure.com", "deployments": {"gpt-4": "gpt4-prod"}}
+//	    }
+//	  }
+//	}
+type Config struct {
+	DefaultProfile string              `json:"default_profile,omitempty"`
+	Profiles       map[string]*Profile `json:"profiles"`
+}
+
+// Profile is a named client configuration in a Config.
+type Profile struct {
+	// APIKey is the api key. To keep keys out of config files, use APIKeyEnv or APIKeyFile instead.
+	APIKey string `json:"api_key,omitempty"`
+	// APIKeyEnv is the name of an environment variable holding the api key.
+	APIKeyEnv string `json:"api_key_env,omitempty"`
+	// APIKeyFile is the path of a file holding the api key, which is read on every request.
+	APIKeyFile string `json:"api_key_file,omitempty"`
+
+	BaseURL      string `json:"base_url,omitempty"`
+	Organization string `json:"organization,omitempty"`
+	Project      string `json:"project,omitempty"`
+	// Timeout is a duration such as "30s".
+	Timeout    string       `json:"timeout,omitempty"`
+	MaxRetries int          `json:"max_retries,omitempty"`
+	Azure      *AzureConfig `json:"azure,omitempty"`
+}
+
+// ClientOptions returns the client options configured by the profile, and the api key if it is
+// given directly or through an environment variable.
+func (p *Profile) ClientOptions() (string, []ClientOption, error) {
+	var apiKey string
+	var options []ClientOption
+	switch {
+	case p.APIKey != "":
+		apiKey = p.APIKey
+	case p.APIKeyEnv != "":
+		apiKey = os.Getenv(p.APIKeyEnv)
+		if apiKey == "" {
+			return "", nil, fmt.Errorf("environment variable %s is not set", p.APIKeyEnv)
+		}
+	case p.APIKeyFile != "":
+		options = append(options, WithCredentialProvider(FileCredential(p.APIKeyFile)))
+	}
+	if p.BaseURL != "" {
+		options = append(options, WithBaseURL(p.BaseURL))
+	}
+	if p.Organization != "" {
+		options = append(options, WithOrg(p.Organization))
+	}
+	if p.Project != "" {
+		options = append(options, WithProject(p.Project))
+	}
+	if p.Timeout != "" {
+		timeout, err := time.ParseDuration(p.Timeout)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid timeout %q: %w", p.Timeout, err)
+		}
+		options = append(options, WithTimeout(timeout))
+	}
+	if p.MaxRetries != 0 {
+		options = append(options, WithMaxRetries(p.MaxRetries))
+	}
+	if p.Azure != nil {
+		options = append(options, WithAzure(*p.Azure))
+	}
+	return apiKey, options, nil
+}
+
+// DefaultConfigPath returns the path of the config file used when OPENAI_CONFIG_FILE is not set,
+// "gpt3/config.json" in the user's config directory.
+func DefaultConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "gpt3", "config.json"), nil
+}
+
+// LoadProfile reads the config file at path and returns the named profile, or the default
+// profile of the file if name is empty.
+func LoadProfile(path, name string) (*Profile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	if name == "" {
+		name = config.DefaultProfile
+	}
+	if name == "" {
+		return nil, fmt.Errorf("config file %s has no default profile", path)
+	}
+	profile, ok := config.Profiles[name]
+	if !ok || profile == nil {
+		return nil, fmt.Errorf("config file %s has no profile %q", path, name)
+	}
+	return profile, nil
+}
+
+// NewClientFromProfile returns a client configured by the named profile of the config file at
+// path. Options override the settings of the profile.
+func NewClientFromProfile(path, name string, options ...ClientOption) (Client, error) {
+	profile, err := LoadProfile(path, name)
+	if err != nil {
+		return nil, err
+	}
+	apiKey, profileOptions, err := profile.ClientOptions()
+	if err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+	return NewClientWithOptions(apiKey, append(profileOptions, options...)...)
+}
+
+// NewClientFromEnv returns a client configured by the standard environment variables:
+// OPENAI_API_KEY, OPENAI_BASE_URL, OPENAI_ORG_ID, OPENAI_PROJECT_ID, OPENAI_TIMEOUT (a duration
+// such as "30s", or seconds) and OPENAI_MAX_RETRIES. If OPENAI_PROFILE is set, the named profile
+// of the config file at OPENAI_CONFIG_FILE, or DefaultConfigPath, is applied first, so the
+// variables and then the options override its settings. Programs that keep variables in a .env
+// file should load it, e.g. with godotenv, before calling NewClientFromEnv.
+func NewClientFromEnv(options ...ClientOption) (Client, error) {
+	var apiKey string
+	var envOptions []ClientOption
+	if name := os.Getenv(EnvProfile); name != "" {
+		path := os.Getenv(EnvConfigFile)
+		if path == "" {
+			var err error
+			if path, err = DefaultConfigPath(); err != nil {
+				return nil, err
+			}
+		}
+		profile, err := LoadProfile(path, name)
+		if err != nil {
+			return nil, err
+		}
+		if os.Getenv(EnvAPIKey) != "" {
+			// the variable overrides however the profile gets its key, including a key file
+			// whose credential provider would otherwise replace it on every request
+			keyless := *profile
+			keyless.APIKey, keyless.APIKeyEnv, keyless.APIKeyFile = "", "", ""
+			profile = &keyless
+		}
+		if apiKey, envOptions, err = profile.ClientOptions(); err != nil {
+			return nil, fmt.Errorf("profile %q: %w", name, err)
+		}
+	}
+
+	var errs []error
+	if key := os.Getenv(EnvAPIKey); key != "" {
+		apiKey = key
+	}
+	if baseURL := os.Getenv(EnvBaseURL); baseURL != "" {
+		envOptions = append(envOptions, WithBaseURL(baseURL))
+	}
+	if org := os.Getenv(EnvOrgID); org != "" {
+		envOptions = append(envOptions, WithOrg(org))
+	}
+	if project := os.Getenv(EnvProjectID); project != "" {
+		envOptions = append(envOptions, WithProject(project))
+	}
+	if value := os.Getenv(EnvTimeout); value != "" {
+		timeout, err := parseTimeout(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: %w", EnvTimeout, value, err))
+		} else {
+			envOptions = append(envOptions, WithTimeout(timeout))
+		}
+	}
+	if value := os.Getenv(EnvMaxRetries); value != "" {
+		maxRetries, err := strconv.Atoi(value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s %q: must be an integer", EnvMaxRetries, value))
+		} else {
+			envOptions = append(envOptions, WithMaxRetries(maxRetries))
+		}
+	}
+
+	client, err := NewClientWithOptions(apiKey, append(envOptions, options...)...)
+	if len(errs) > 0 {
+		var optionsErr *OptionsError
+		if errors.As(err, &optionsErr) {
+			errs = append(errs, optionsErr.Errors...)
+		}
+		return nil, &OptionsError{Errors: errs}
+	}
+	return client, err
+}
+
+// parseTimeout parses a duration such as "1m30s", or a number of seconds.
+func parseTimeout(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
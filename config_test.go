@@ -0,0 +1,167 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+const testConfig = `{
+  "default_profile": "dev",
+  "profiles": {
+    "dev": {"api_key_env": "GPT3_TEST_DEV_KEY", "base_url": "https://dev.example.com/v1", "organization": "org-dev"},
+    "local": {"api_key": "local-key", "base_url": "http://localhost:8080/v1", "timeout": "5s", "max_retries": 1},
+    "azure": {"api_key": "azure-key", "azure": {"endpoint": "https://res.openai.azure.com", "deployments": {"gpt-4": "gpt4-prod"}}}
+  }
+}`
+
+func writeTestConfig(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(testConfig), 0600))
+	return path
+}
+
+func TestNewClientFromEnv(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))}, nil)
+	t.Setenv("OPENAI_API_KEY", "env-key")
+	t.Setenv("OPENAI_BASE_URL", "http://localhost:9090/v1")
+	t.Setenv("OPENAI_ORG_ID", "org-env")
+	t.Setenv("OPENAI_PROJECT_ID", "proj-env")
+	t.Setenv("OPENAI_MAX_RETRIES", "3")
+
+	client, err := gpt3.NewClientFromEnv(gpt3.WithHTTPClient(httpClient))
+	assert.NoError(t, err)
+	_, err = client.Engines(context.Background())
+	assert.NoError(t, err)
+
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "http://localhost:9090/v1/engines", req.URL.String())
+	assert.Equal(t, "Bearer env-key", req.Header.Get("Authorization"))
+	assert.Equal(t, "org-env", req.Header.Get("OpenAI-Organization"))
+	assert.Equal(t, "proj-env", req.Header.Get("OpenAI-Project"))
+}
+
+func TestNewClientFromEnvErrors(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_TIMEOUT", "soon")
+	t.Setenv("OPENAI_MAX_RETRIES", "many")
+
+	_, err := gpt3.NewClientFromEnv()
+	var optionsErr *gpt3.OptionsError
+	assert.True(t, errors.As(err, &optionsErr))
+	assert.EqualError(t, err, "invalid client options: "+
+		"invalid OPENAI_TIMEOUT \"soon\": time: invalid duration \"soon\"; "+
+		"invalid OPENAI_MAX_RETRIES \"many\": must be an integer; "+
+		"an api key is required")
+}
+
+func TestNewClientFromEnvProfile(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))}, nil)
+	t.Setenv("OPENAI_CONFIG_FILE", writeTestConfig(t))
+	t.Setenv("OPENAI_PROFILE", "azure")
+	t.Setenv("OPENAI_API_KEY", "")
+
+	client, err := gpt3.NewClientFromEnv(gpt3.WithHTTPClient(httpClient))
+	assert.NoError(t, err)
+	_, err = client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{Model: "gpt-4"})
+	assert.NoError(t, err)
+
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "https://res.openai.azure.com/openai/deployments/gpt4-prod/chat/completions?api-version="+
+		gpt3.DefaultAzureAPIVersion, req.URL.String())
+	assert.Equal(t, "azure-key", req.Header.Get("api-key"))
+}
+
+func TestNewClientFromEnvOverridesProfileKey(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripStub = func(*http.Request) (*http.Response, error) {
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))}, nil
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte("file-key"), 0600))
+	config := filepath.Join(dir, "config.json")
+	assert.NoError(t, os.WriteFile(config, []byte(`{"profiles": {
+		"secrets": {"api_key_file": "`+keyFile+`", "organization": "org-secrets"},
+		"dev": {"api_key_env": "GPT3_TEST_UNSET_KEY"}
+	}}`), 0600))
+	t.Setenv("OPENAI_CONFIG_FILE", config)
+	t.Setenv("OPENAI_API_KEY", "env-key")
+
+	for _, profile := range []string{"secrets", "dev"} {
+		t.Setenv("OPENAI_PROFILE", profile)
+		client, err := gpt3.NewClientFromEnv(gpt3.WithHTTPClient(httpClient))
+		assert.NoError(t, err, profile)
+		_, err = client.Engines(context.Background())
+		assert.NoError(t, err, profile)
+	}
+	// the key from the environment replaces the profile's key, but not its other settings
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "Bearer env-key", req.Header.Get("Authorization"))
+	assert.Equal(t, "org-secrets", req.Header.Get("OpenAI-Organization"))
+	assert.Equal(t, "Bearer env-key", rt.RoundTripArgsForCall(1).Header.Get("Authorization"))
+}
+
+func TestNewClientFromProfile(t *testing.T) {
+	path := writeTestConfig(t)
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))}, nil)
+	t.Setenv("GPT3_TEST_DEV_KEY", "dev-key")
+
+	// the default profile, with options overriding it
+	client, err := gpt3.NewClientFromProfile(path, "", gpt3.WithHTTPClient(httpClient), gpt3.WithOrg("org-override"))
+	assert.NoError(t, err)
+	_, err = client.Engines(context.Background())
+	assert.NoError(t, err)
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "https://dev.example.com/v1/engines", req.URL.String())
+	assert.Equal(t, "Bearer dev-key", req.Header.Get("Authorization"))
+	assert.Equal(t, "org-override", req.Header.Get("OpenAI-Organization"))
+
+	profile, err := gpt3.LoadProfile(path, "local")
+	assert.NoError(t, err)
+	assert.Equal(t, "5s", profile.Timeout)
+	assert.Equal(t, 1, profile.MaxRetries)
+
+	_, err = gpt3.LoadProfile(path, "prod")
+	assert.EqualError(t, err, "config file "+path+" has no profile \"prod\"")
+	t.Setenv("GPT3_TEST_DEV_KEY", "")
+	_, err = gpt3.NewClientFromProfile(path, "dev")
+	assert.EqualError(t, err, "profile \"dev\": environment variable GPT3_TEST_DEV_KEY is not set")
+}
+
+func TestMaxRetries(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	statuses := []int{503, 429, 200}
+	rt.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+		status := statuses[0]
+		statuses = statuses[1:]
+		body, _ := ioutil.ReadAll(req.Body)
+		if status != 200 {
+			body = []byte(`{"error": {"message": "try again", "type": "server_error"}}`)
+		}
+		return &http.Response{StatusCode: status, Header: http.Header{}, Body: ioutil.NopCloser(bytes.NewBuffer(body))}, nil
+	}
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient), gpt3.WithMaxRetries(2))
+
+	_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: "model"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, rt.RoundTripCallCount())
+
+	// client errors are not retried
+	rt.RoundTripReturns(&http.Response{StatusCode: 400, Body: ioutil.NopCloser(bytes.NewBufferString(`{}`))}, nil)
+	rt.RoundTripStub = nil
+	_, err = client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{})
+	assert.Error(t, err)
+	assert.Equal(t, 4, rt.RoundTripCallCount())
+}
@@ -0,0 +1,271 @@
+package gpt3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxCredentialAttempts limits how many keys a single call tries when keys are rejected.
+const maxCredentialAttempts = 10
+
+// DefaultRateLimitCooldown is how long RotatingCredentials skips a rate limited key when the
+// response doesn't say when the rate limit resets.
+const DefaultRateLimitCooldown = time.Minute
+
+// CredentialProvider supplies the api key of every request made by a client configured with
+// WithCredentialProvider. It is called once per request, so it should cache keys that are
+// expensive to load.
+type CredentialProvider interface {
+	APIKey(ctx context.Context) (string, error)
+}
+
+// CredentialFailover is implemented by CredentialProviders that can fail over to another key.
+// Failover is called when a request made with apiKey was rejected with a 401 or 429 response, and
+// reports whether the request should be retried with the key returned by the next APIKey call.
+type CredentialFailover interface {
+	Failover(apiKey string, err APIError) bool
+}
+
+// CredentialFunc adapts a function to a CredentialProvider.
+type CredentialFunc func(ctx context.Context) (string, error)
+
+// APIKey calls f.
+func (f CredentialFunc) APIKey(ctx context.Context) (string, error) {
+	return f(ctx)
+}
+
+// WithCredentialProvider is a client option that gets the api key of every request from provider
+// instead of using the fixed api key given to NewClient. The WithRequestAPIKey request option
+// still takes precedence.
+func WithCredentialProvider(provider CredentialProvider) ClientOption {
+	return func(c *client) error {
+		if provider == nil {
+			return errors.New("credential provider must not be nil")
+		}
+		c.credentials = provider
+		return nil
+	}
+}
+
+// EnvCredential returns a CredentialProvider that reads the api key from the environment
+// variable name on every request, so changes to the variable are picked up.
+func EnvCredential(name string) CredentialProvider {
+	return CredentialFunc(func(ctx context.Context) (string, error) {
+		key := os.Getenv(name)
+		if key == "" {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return key, nil
+	})
+}
+
+// FileCredential returns a CredentialProvider that reads the api key from the file at path on
+// every request, so keys rotated by a secret store that mounts files are picked up. Surrounding
+// whitespace is ignored.
+func FileCredential(path string) CredentialProvider {
+	return CredentialFunc(func(ctx context.Context) (string, error) {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read api key: %w", err)
+		}
+		key := strings.TrimSpace(string(data))
+		if key == "" {
+			return "", fmt.Errorf("api key file %s is empty", path)
+		}
+		return key, nil
+	})
+}
+
+// RefreshingCredentials is a CredentialProvider that caches a key loaded by a fetch function,
+// for example from a secret store, until it expires or is rejected.
+type RefreshingCredentials struct {
+	fetch func(ctx context.Context) (key string, expiresAt time.Time, err error)
+
+	mu        sync.Mutex
+	key       string
+	expiresAt time.Time
+	rejected  string
+}
+
+// NewRefreshingCredentials returns RefreshingCredentials loading keys with fetch. A zero
+// expiresAt means the key doesn't expire.
+func NewRefreshingCredentials(fetch func(ctx context.Context) (key string, expiresAt time.Time, err error)) *RefreshingCredentials {
+	return &RefreshingCredentials{fetch: fetch}
+}
+
+// APIKey returns the cached key, fetching a new one if there is none or it has expired.
+func (r *RefreshingCredentials) APIKey(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.key != "" && (r.expiresAt.IsZero() || time.Now().Before(r.expiresAt)) {
+		return r.key, nil
+	}
+	key, expiresAt, err := r.fetch(ctx)
+	if err != nil {
+		return "", err
+	}
+	r.key, r.expiresAt = key, expiresAt
+	if key != r.rejected {
+		r.rejected = ""
+	}
+	return key, nil
+}
+
+// Failover drops the cached key after a 401 so the next request fetches a new one. It only asks
+// for a retry the first time a key is rejected, so a fetch that keeps returning a revoked key
+// doesn't loop. Rate limited requests are left to the retries of the client, as another fetch
+// would most likely return the same key.
+func (r *RefreshingCredentials) Failover(apiKey string, err APIError) bool {
+	if err.StatusCode != http.StatusUnauthorized {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.key == apiKey {
+		r.key = ""
+	}
+	if r.rejected == apiKey {
+		return false
+	}
+	r.rejected = apiKey
+	return true
+}
+
+// RotatingCredentials is a CredentialProvider that round-robins requests across several keys.
+// A key rejected with a 401 is no longer used, and a key rejected with a 429 is skipped until
+// its rate limit resets. Keys can be replaced at any time with SetKeys.
+type RotatingCredentials struct {
+	mu   sync.Mutex
+	keys []*rotatingKey
+	next int
+}
+
+type rotatingKey struct {
+	key          string
+	revoked      bool
+	limitedUntil time.Time
+}
+
+// NewRotatingCredentials returns RotatingCredentials using keys in order.
+func NewRotatingCredentials(keys ...string) *RotatingCredentials {
+	r := &RotatingCredentials{}
+	r.SetKeys(keys...)
+	return r
+}
+
+// SetKeys replaces the keys, keeping the state of keys that were already in use.
+func (r *RotatingCredentials) SetKeys(keys ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	previous := make(map[string]*rotatingKey, len(r.keys))
+	for _, k := range r.keys {
+		previous[k.key] = k
+	}
+	r.keys = make([]*rotatingKey, 0, len(keys))
+	for _, key := range keys {
+		if k, ok := previous[key]; ok {
+			r.keys = append(r.keys, k)
+		} else {
+			r.keys = append(r.keys, &rotatingKey{key: key})
+		}
+	}
+	r.next = 0
+}
+
+// APIKey returns the next usable key. If every key is rate limited it returns the one whose
+// rate limit resets first.
+func (r *RotatingCredentials) APIKey(ctx context.Context) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	var soonest *rotatingKey
+	for i := 0; i < len(r.keys); i++ {
+		k := r.keys[(r.next+i)%len(r.keys)]
+		if k.revoked {
+			continue
+		}
+		if !now.Before(k.limitedUntil) {
+			r.next = (r.next + i + 1) % len(r.keys)
+			return k.key, nil
+		}
+		if soonest == nil || k.limitedUntil.Before(soonest.limitedUntil) {
+			soonest = k
+		}
+	}
+	if soonest != nil {
+		return soonest.key, nil
+	}
+	if len(r.keys) == 0 {
+		return "", errors.New("no api keys configured")
+	}
+	return "", errors.New("every api key was rejected")
+}
+
+// Failover marks apiKey as revoked or rate limited, and asks for a retry if another key is usable.
+func (r *RotatingCredentials) Failover(apiKey string, err APIError) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	for _, k := range r.keys {
+		if k.key != apiKey {
+			continue
+		}
+		if err.StatusCode == http.StatusUnauthorized {
+			k.revoked = true
+		} else {
+			cooldown := err.RateLimitHeaders.ResetRequests
+			if err.RateLimitHeaders.ResetTokens > cooldown {
+				cooldown = err.RateLimitHeaders.ResetTokens
+			}
+			if cooldown <= 0 {
+				cooldown = DefaultRateLimitCooldown
+			}
+			k.limitedUntil = now.Add(cooldown)
+		}
+	}
+	for _, k := range r.keys {
+		if !k.revoked && !now.Before(k.limitedUntil) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize sets the api key of the credential provider on the request, unless the call
+// overrides the api key or Azure AD tokens are used. It returns the key it set, if any.
+func (c *client) authorize(ctx context.Context, call *Call) (string, error) {
+	if c.credentials == nil || call.options.apiKey != "" || (c.azure != nil && c.azure.TokenProvider != nil) {
+		return "", nil
+	}
+	apiKey, err := c.credentials.APIKey(ctx)
+	if err != nil {
+		return "", fmt.Errorf("credential provider: %w", err)
+	}
+	if c.azure != nil {
+		call.HTTPRequest.Header.Set("api-key", apiKey)
+	} else {
+		call.HTTPRequest.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return apiKey, nil
+}
+
+// failover reports whether a request made with apiKey that failed with err should be retried
+// with another key from the credential provider.
+func (c *client) failover(apiKey string, err error, attempt int) bool {
+	var apiErr APIError
+	if apiKey == "" || attempt >= maxCredentialAttempts || !errors.As(err, &apiErr) {
+		return false
+	}
+	if apiErr.StatusCode != http.StatusUnauthorized && apiErr.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	f, ok := c.credentials.(CredentialFailover)
+	return ok && f.Failover(apiKey, apiErr)
+}
@@ -0,0 +1,164 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+// keyedRoundTripper answers each request with the status configured for its bearer key, or 200,
+// and records the keys in order.
+func keyedRoundTripper(statuses map[string]int, keys *[]string) func(req *http.Request) (*http.Response, error) {
+	return func(req *http.Request) (*http.Response, error) {
+		key := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		*keys = append(*keys, key)
+		body := []byte(`{}`)
+		if req.Body != nil {
+			body, _ = ioutil.ReadAll(req.Body)
+		}
+		if status, ok := statuses[key]; ok {
+			return &http.Response{
+				StatusCode: status,
+				Header:     http.Header{},
+				Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error": {"message": "rejected", "type": "error"}}`)),
+			}, nil
+		}
+		return &http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBuffer(body))}, nil
+	}
+}
+
+func TestRotatingCredentials(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	var keys []string
+	rt.RoundTripStub = keyedRoundTripper(map[string]int{"revoked": 401, "limited": 429}, &keys)
+	credentials := gpt3.NewRotatingCredentials("key-a", "revoked", "key-b", "limited")
+	client, err := gpt3.NewClientWithOptions("", gpt3.WithHTTPClient(httpClient), gpt3.WithCredentialProvider(credentials))
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		rsp, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: "model"})
+		assert.NoError(t, err)
+		assert.NotNil(t, rsp)
+	}
+	// rejected keys fail over to the next key with the body sent again, and are then skipped
+	assert.Equal(t, []string{"key-a", "revoked", "key-b", "limited", "key-a", "key-b"}, keys)
+
+	credentials.SetKeys("revoked")
+	_, err = client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{})
+	assert.EqualError(t, err, "credential provider: every api key was rejected")
+}
+
+func TestCredentialFailoverGivesUp(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	var keys []string
+	rt.RoundTripStub = keyedRoundTripper(map[string]int{"key-a": 429, "key-b": 429}, &keys)
+	client := gpt3.NewClient("", gpt3.WithHTTPClient(httpClient),
+		gpt3.WithCredentialProvider(gpt3.NewRotatingCredentials("key-a", "key-b")))
+
+	_, err := client.Engines(context.Background())
+	var apiErr gpt3.APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 429, apiErr.StatusCode)
+	assert.Equal(t, []string{"key-a", "key-b"}, keys)
+}
+
+func TestRefreshingCredentials(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	var keys []string
+	rt.RoundTripStub = keyedRoundTripper(map[string]int{"key-1": 401}, &keys)
+	fetches := 0
+	credentials := gpt3.NewRefreshingCredentials(func(ctx context.Context) (string, time.Time, error) {
+		fetches++
+		return []string{"key-1", "key-2", "key-3"}[fetches-1], time.Now().Add(time.Hour), nil
+	})
+	client := gpt3.NewClient("", gpt3.WithHTTPClient(httpClient), gpt3.WithCredentialProvider(credentials))
+
+	_, err := client.Engines(context.Background())
+	assert.NoError(t, err)
+	_, err = client.Engines(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 2, fetches)
+	assert.Equal(t, []string{"key-1", "key-2", "key-2"}, keys)
+
+	// the request api key option takes precedence over the provider
+	_, err = client.Engines(context.Background(), gpt3.WithRequestAPIKey("override"))
+	assert.NoError(t, err)
+	assert.Equal(t, "override", keys[3])
+}
+
+func TestRefreshingCredentialsRejectedAgain(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	var keys []string
+	rt.RoundTripStub = keyedRoundTripper(map[string]int{"key-1": 401, "key-2": 401, "revoked": 401}, &keys)
+	fetched := []string{"key-1", "key-2", "key-3", "revoked", "revoked"}
+	credentials := gpt3.NewRefreshingCredentials(func(ctx context.Context) (string, time.Time, error) {
+		key := fetched[0]
+		fetched = fetched[1:]
+		return key, time.Time{}, nil
+	})
+	client := gpt3.NewClient("", gpt3.WithHTTPClient(httpClient), gpt3.WithCredentialProvider(credentials))
+
+	// a newly fetched key that is rejected as well is refreshed again
+	_, err := client.Engines(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"key-1", "key-2", "key-3"}, keys)
+
+	// a fetch returning the key that was just rejected gives up
+	credentials.Failover("key-3", gpt3.APIError{StatusCode: 401})
+	_, err = client.Engines(context.Background())
+	assert.Error(t, err)
+	assert.Equal(t, []string{"key-1", "key-2", "key-3", "revoked", "revoked"}, keys)
+}
+
+func TestRefreshingCredentialsRateLimited(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	var keys []string
+	rt.RoundTripStub = keyedRoundTripper(map[string]int{"key-1": 429}, &keys)
+	fetches := 0
+	credentials := gpt3.NewRefreshingCredentials(func(ctx context.Context) (string, time.Time, error) {
+		fetches++
+		return "key-1", time.Time{}, nil
+	})
+	client := gpt3.NewClient("", gpt3.WithHTTPClient(httpClient), gpt3.WithCredentialProvider(credentials),
+		gpt3.WithMaxRetries(0))
+
+	// a rate limit doesn't refresh the key, it is left to the retries of the client
+	_, err := client.Engines(context.Background())
+	var apiErr gpt3.APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 429, apiErr.StatusCode)
+	assert.Equal(t, []string{"key-1"}, keys)
+	assert.Equal(t, 1, fetches)
+}
+
+func TestEnvAndFileCredentials(t *testing.T) {
+	t.Setenv("GPT3_TEST_KEY", "env-key")
+	key, err := gpt3.EnvCredential("GPT3_TEST_KEY").APIKey(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "env-key", key)
+	_, err = gpt3.EnvCredential("GPT3_TEST_MISSING").APIKey(context.Background())
+	assert.EqualError(t, err, "environment variable GPT3_TEST_MISSING is not set")
+
+	path := filepath.Join(t.TempDir(), "key")
+	assert.NoError(t, os.WriteFile(path, []byte("file-key\n"), 0600))
+	provider := gpt3.FileCredential(path)
+	key, err = provider.APIKey(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "file-key", key)
+
+	// a rotated file is picked up by the next request
+	assert.NoError(t, os.WriteFile(path, []byte("rotated-key"), 0600))
+	key, err = provider.APIKey(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated-key", key)
+}
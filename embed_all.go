@@ -0,0 +1,317 @@
+package gpt3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limits of a single embeddings request, used as the defaults of EmbedAll.
+const (
+	MaxEmbeddingInputs         = 2048
+	MaxEmbeddingTokensPerBatch = 300000
+)
+
+// EstimateTokens estimates the number of tokens of text as one per four bytes, rounded up, which
+// is about right for English text. It is the token counter used when no tokenizer is configured,
+// here and in the packages of the client that budget tokens.
+func EstimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
+
+// EmbedAllOption are options that can be passed to EmbedAll.
+type EmbedAllOption func(*embedAllConfig) error
+
+type embedAllConfig struct {
+	batchSize      int
+	batchTokens    int
+	concurrency    int
+	retries        int
+	dimensions     int
+	countTokens    func(text string) int
+	progress       func(done, total int)
+	requestOptions []RequestOption
+}
+
+// WithEmbedBatchSize limits the number of inputs sent in each request. Defaults to MaxEmbeddingInputs.
+func WithEmbedBatchSize(size int) EmbedAllOption {
+	return func(c *embedAllConfig) error {
+		if size <= 0 {
+			return errors.New("batch size must be positive")
+		}
+		c.batchSize = size
+		return nil
+	}
+}
+
+// WithEmbedBatchTokens limits the number of tokens sent in each request. Defaults to
+// MaxEmbeddingTokensPerBatch.
+func WithEmbedBatchTokens(tokens int) EmbedAllOption {
+	return func(c *embedAllConfig) error {
+		if tokens <= 0 {
+			return errors.New("batch tokens must be positive")
+		}
+		c.batchTokens = tokens
+		return nil
+	}
+}
+
+// WithEmbedConcurrency sets how many requests EmbedAll runs at the same time. Defaults to 4.
+func WithEmbedConcurrency(concurrency int) EmbedAllOption {
+	return func(c *embedAllConfig) error {
+		if concurrency <= 0 {
+			return errors.New("concurrency must be positive")
+		}
+		c.concurrency = concurrency
+		return nil
+	}
+}
+
+// WithEmbedRetries sets how many times a failed request is retried before EmbedAll gives up.
+// Defaults to 3.
+func WithEmbedRetries(retries int) EmbedAllOption {
+	return func(c *embedAllConfig) error {
+		if retries < 0 {
+			return errors.New("retries must not be negative")
+		}
+		c.retries = retries
+		return nil
+	}
+}
+
+// WithEmbedDimensions sets the number of dimensions of the embeddings, see EmbeddingsRequest.Dimensions.
+func WithEmbedDimensions(dimensions int) EmbedAllOption {
+	return func(c *embedAllConfig) error {
+		if dimensions <= 0 {
+			return errors.New("dimensions must be positive")
+		}
+		c.dimensions = dimensions
+		return nil
+	}
+}
+
+// WithEmbedTokenCounter sets the function used to count the tokens of each input when packing
+// requests. Defaults to EstimateTokens.
+func WithEmbedTokenCounter(countTokens func(text string) int) EmbedAllOption {
+	return func(c *embedAllConfig) error {
+		if countTokens == nil {
+			return errors.New("token counter must not be nil")
+		}
+		c.countTokens = countTokens
+		return nil
+	}
+}
+
+// WithEmbedProgress sets a function that is called after each request completes with the number
+// of inputs embedded so far and the total. Calls are not concurrent.
+func WithEmbedProgress(progress func(done, total int)) EmbedAllOption {
+	return func(c *embedAllConfig) error {
+		c.progress = progress
+		return nil
+	}
+}
+
+// WithEmbedRequestOptions sets request options passed to every embeddings request. A
+// WithRawResponse option has no effect, as EmbedAll captures the responses of its requests itself.
+func WithEmbedRequestOptions(opts ...RequestOption) EmbedAllOption {
+	return func(c *embedAllConfig) error {
+		c.requestOptions = append(c.requestOptions, opts...)
+		return nil
+	}
+}
+
+// EmbedAll embeds any number of texts with model and returns their embeddings in the order of the
+// texts. The texts are packed into as few requests as the input count and token limits allow,
+// which run concurrently. When the rate limit headers of a response show that the requests or
+// tokens are used up, new requests wait until the limit resets. Failed requests are retried with
+// backoff, and if one still fails EmbedAll cancels the others and returns its error.
+func EmbedAll(ctx context.Context, client Client, model string, texts []string, options ...EmbedAllOption) ([][]float32, error) {
+	config := embedAllConfig{
+		batchSize:   MaxEmbeddingInputs,
+		batchTokens: MaxEmbeddingTokensPerBatch,
+		concurrency: 4,
+		retries:     3,
+		countTokens: EstimateTokens,
+	}
+	for _, o := range options {
+		if err := o(&config); err != nil {
+			return nil, err
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e := &embedder{
+		client:     client,
+		model:      model,
+		config:     config,
+		embeddings: make([][]float32, len(texts)),
+		total:      len(texts),
+	}
+	batches := make(chan embedBatch)
+	var wg sync.WaitGroup
+	for i := 0; i < config.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				if err := e.embed(ctx, batch); err != nil {
+					e.fail(err)
+					cancel()
+				}
+			}
+		}()
+	}
+
+	e.pack(ctx, texts, batches)
+	close(batches)
+	wg.Wait()
+	if e.err != nil {
+		return nil, e.err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.embeddings, nil
+}
+
+// embedBatch is a range of the texts sent in a single request.
+type embedBatch struct {
+	offset int
+	texts  []string
+	tokens int
+}
+
+type embedder struct {
+	client Client
+	model  string
+	config embedAllConfig
+
+	mu         sync.Mutex
+	embeddings [][]float32
+	done       int
+	total      int
+	err        error
+	// pauseUntil holds back new requests until the rate limit resets
+	pauseUntil time.Time
+}
+
+// pack splits the texts into batches under the input count and token limits.
+func (e *embedder) pack(ctx context.Context, texts []string, batches chan<- embedBatch) {
+	batch := embedBatch{}
+	send := func() bool {
+		if len(batch.texts) == 0 {
+			return true
+		}
+		select {
+		case batches <- batch:
+			batch = embedBatch{offset: batch.offset + len(batch.texts)}
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for _, text := range texts {
+		tokens := e.config.countTokens(text)
+		if len(batch.texts) == e.config.batchSize || (len(batch.texts) > 0 && batch.tokens+tokens > e.config.batchTokens) {
+			if !send() {
+				return
+			}
+		}
+		batch.texts = append(batch.texts, text)
+		batch.tokens += tokens
+	}
+	send()
+}
+
+// embed sends a batch, retrying it when it fails, and stores its embeddings.
+func (e *embedder) embed(ctx context.Context, batch embedBatch) error {
+	for retry := 0; ; retry++ {
+		if err := e.wait(ctx); err != nil {
+			return err
+		}
+		var raw RawResponse
+		// the raw response option goes last so it overrides one of the caller's, which would leave
+		// the rate limits unknown and be written by concurrent requests
+		n := len(e.config.requestOptions)
+		opts := append(e.config.requestOptions[:n:n], WithRawResponse(&raw))
+		rsp, err := e.client.Embeddings(ctx, EmbeddingsRequest{
+			Input:      batch.texts,
+			Model:      e.model,
+			Dimensions: e.config.dimensions,
+		}, opts...)
+		if raw.StatusCode != 0 {
+			e.limit(raw.RateLimitHeaders, batch.tokens)
+		}
+		if err == nil {
+			return e.store(batch, rsp)
+		}
+		if retry >= e.config.retries || !isRetryable(ctx, err) {
+			return err
+		}
+		if err := sleep(ctx, retryDelay(retry+1, err)); err != nil {
+			return err
+		}
+	}
+}
+
+// wait blocks until new requests may be sent.
+func (e *embedder) wait(ctx context.Context) error {
+	e.mu.Lock()
+	pause := time.Until(e.pauseUntil)
+	e.mu.Unlock()
+	if pause <= 0 {
+		return nil
+	}
+	return sleep(ctx, pause)
+}
+
+// limit pauses new requests if the rate limit headers show the requests or tokens are used up.
+func (e *embedder) limit(headers RateLimitHeaders, tokens int) {
+	var pause time.Duration
+	if headers.LimitRequests > 0 && headers.RemainingRequests == 0 {
+		pause = headers.ResetRequests
+	}
+	if headers.LimitTokens > 0 && headers.RemainingTokens < tokens && headers.ResetTokens > pause {
+		pause = headers.ResetTokens
+	}
+	if pause <= 0 {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if until := time.Now().Add(pause); until.After(e.pauseUntil) {
+		e.pauseUntil = until
+	}
+}
+
+// store puts the embeddings of a batch in place using the index of each result, and reports progress.
+func (e *embedder) store(batch embedBatch, rsp *EmbeddingsResponse) error {
+	if len(rsp.Data) != len(batch.texts) {
+		return fmt.Errorf("embeddings response has %d results for %d inputs", len(rsp.Data), len(batch.texts))
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, result := range rsp.Data {
+		if result.Index < 0 || result.Index >= len(batch.texts) {
+			return fmt.Errorf("embeddings response has result index %d for %d inputs", result.Index, len(batch.texts))
+		}
+		e.embeddings[batch.offset+result.Index] = result.Embedding
+	}
+	e.done += len(batch.texts)
+	if e.config.progress != nil {
+		e.config.progress(e.done, e.total)
+	}
+	return nil
+}
+
+// fail records the first error.
+func (e *embedder) fail(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
@@ -0,0 +1,100 @@
+package gpt3_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/PullRequestInc/go-gpt3/gpt3test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbedAll(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.FailWith(gpt3test.Error{StatusCode: http.StatusInternalServerError, Message: "flaky"})
+
+	var texts []string
+	for i := 0; i < 10; i++ {
+		texts = append(texts, fmt.Sprintf("document number %d", i))
+	}
+	var progress [][2]int
+	embeddings, err := gpt3.EmbedAll(context.Background(), server.Client(), gpt3.TextEmbedding3Small, texts,
+		gpt3.WithEmbedBatchSize(3),
+		gpt3.WithEmbedConcurrency(2),
+		gpt3.WithEmbedDimensions(8),
+		gpt3.WithEmbedProgress(func(done, total int) {
+			progress = append(progress, [2]int{done, total})
+		}),
+	)
+	assert.NoError(t, err)
+	assert.Len(t, embeddings, 10)
+	for i, text := range texts {
+		assert.Equal(t, gpt3test.FakeEmbedding(text, 8), embeddings[i], text)
+	}
+	// four batches, one of which failed once and was retried
+	assert.Len(t, server.Requests(), 5)
+	assert.Len(t, progress, 4)
+	assert.Equal(t, [2]int{10, 10}, progress[3])
+}
+
+func TestEmbedAllPacksByTokens(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+
+	texts := []string{"aaaa aaaa", "bbbb", "cccc cccc cccc", "dddd"}
+	embeddings, err := gpt3.EmbedAll(context.Background(), server.Client(), gpt3.TextEmbedding3Small, texts,
+		gpt3.WithEmbedBatchTokens(3),
+		gpt3.WithEmbedConcurrency(1),
+		gpt3.WithEmbedTokenCounter(func(text string) int { return len(text) / 4 }),
+	)
+	assert.NoError(t, err)
+	assert.Len(t, embeddings, 4)
+	// 2+1 tokens, then 3 tokens, then 1 token
+	assert.Len(t, server.Requests(), 3)
+}
+
+func TestEmbedAllFails(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.FailWith(gpt3test.Error{StatusCode: http.StatusBadRequest, Message: "bad input"})
+
+	_, err := gpt3.EmbedAll(context.Background(), server.Client(), gpt3.TextEmbedding3Small, []string{"a", "b"},
+		gpt3.WithEmbedBatchSize(1), gpt3.WithEmbedConcurrency(1))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "bad input")
+
+	_, err = gpt3.EmbedAll(context.Background(), server.Client(), gpt3.TextEmbedding3Small, nil, gpt3.WithEmbedConcurrency(0))
+	assert.EqualError(t, err, "concurrency must be positive")
+}
+
+func TestEmbedAllWaitsForRateLimits(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.SetRateLimits(gpt3.RateLimitHeaders{LimitRequests: 10, RemainingRequests: 0, ResetRequests: 100 * time.Millisecond})
+
+	start := time.Now()
+	_, err := gpt3.EmbedAll(context.Background(), server.Client(), gpt3.TextEmbedding3Small, []string{"a", "b"},
+		gpt3.WithEmbedBatchSize(1), gpt3.WithEmbedConcurrency(1))
+	assert.NoError(t, err)
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
+
+func TestEmbedAllIgnoresRawResponseOption(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.SetRateLimits(gpt3.RateLimitHeaders{LimitRequests: 10, RemainingRequests: 0, ResetRequests: 100 * time.Millisecond})
+
+	// run with -race, as the concurrent requests must not share the caller's raw response
+	var raw gpt3.RawResponse
+	start := time.Now()
+	_, err := gpt3.EmbedAll(context.Background(), server.Client(), gpt3.TextEmbedding3Small, []string{"a", "b", "c"},
+		gpt3.WithEmbedBatchSize(1), gpt3.WithEmbedConcurrency(2), gpt3.WithEmbedRequestOptions(gpt3.WithRawResponse(&raw)))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, raw.StatusCode)
+	// the rate limits are still read from the responses
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+}
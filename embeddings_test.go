@@ -0,0 +1,65 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddingsBase64(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	// 1.0, -2.5 and 0.25 as little-endian float32 values
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Body: ioutil.NopCloser(bytes.NewBufferString(`{"object": "list", "data": [
+			{"object": "embedding", "embedding": "AACAPwAAIMAAAIA+", "index": 0}
+		]}`)),
+	}, nil)
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient))
+
+	rsp, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{
+		Input:      []string{"hello"},
+		Model:      gpt3.TextEmbedding3Small,
+		Dimensions: 3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []float32{1, -2.5, 0.25}, rsp.Data[0].Embedding)
+
+	var body map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rt.RoundTripArgsForCall(0).Body).Decode(&body))
+	assert.Equal(t, "base64", body["encoding_format"])
+	assert.Equal(t, float64(3), body["dimensions"])
+}
+
+func TestEmbeddingsInvalidBase64(t *testing.T) {
+	var result gpt3.EmbeddingsResult
+	assert.EqualError(t, json.Unmarshal([]byte(`{"embedding": "AACAPwA="}`), &result),
+		"invalid base64 embedding: 5 bytes is not a whole number of float32 values")
+}
+
+func TestEmbeddingsRequestJSON(t *testing.T) {
+	data, err := json.Marshal(gpt3.EmbeddingsRequest{InputTokens: [][]int{{1, 2}, {3}}, Model: "model", EncodingFormat: "float"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"input": [[1, 2], [3]], "model": "model", "encoding_format": "float"}`, string(data))
+
+	data, err = json.Marshal(gpt3.EmbeddingsRequest{Input: []string{"a"}, Model: "model"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"input": ["a"], "model": "model"}`, string(data))
+
+	for input, expected := range map[string]gpt3.EmbeddingsRequest{
+		`"a"`:           {Input: []string{"a"}},
+		`["a", "b"]`:    {Input: []string{"a", "b"}},
+		`[1, 2]`:        {InputTokens: [][]int{{1, 2}}},
+		`[[1, 2], [3]]`: {InputTokens: [][]int{{1, 2}, {3}}},
+	} {
+		var request gpt3.EmbeddingsRequest
+		assert.NoError(t, json.Unmarshal([]byte(`{"input": `+input+`}`), &request))
+		assert.Equal(t, expected, request, input)
+	}
+}
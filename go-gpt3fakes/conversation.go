@@ -0,0 +1,129 @@
+package gogpt3fakes
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	gpt3 "github.com/PullRequestInc/go-gpt3"
+)
+
+// ErrNoScriptedReply is returned by a Conversation when a chat call is made with no reply queued.
+var ErrNoScriptedReply = errors.New("no scripted reply queued")
+
+// Conversation is a FakeClient whose ChatCompletion and ChatCompletionStream methods answer from
+// queued replies, in order, and record the requests they received. Other methods behave like a
+// plain FakeClient and can be stubbed as usual.
+type Conversation struct {
+	*FakeClient
+
+	mu       sync.Mutex
+	replies  []scriptedReply
+	requests []gpt3.ChatCompletionRequest
+}
+
+type scriptedReply struct {
+	response *gpt3.ChatCompletionResponse
+	chunks   []*gpt3.ChatCompletionStreamResponse
+	err      error
+}
+
+// NewConversation returns a Conversation with no queued replies.
+func NewConversation() *Conversation {
+	c := &Conversation{FakeClient: &FakeClient{}}
+	c.ChatCompletionStub = c.chatCompletion
+	c.ChatCompletionStreamStub = c.chatCompletionStream
+	return c
+}
+
+// QueueResponse queues replies for ChatCompletion calls.
+func (c *Conversation) QueueResponse(responses ...gpt3.ChatCompletionResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i := range responses {
+		c.replies = append(c.replies, scriptedReply{response: &responses[i]})
+	}
+}
+
+// QueueStream queues a single reply for a ChatCompletionStream call, delivered as the given chunks.
+func (c *Conversation) QueueStream(chunks ...gpt3.ChatCompletionStreamResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reply := scriptedReply{}
+	for i := range chunks {
+		reply.chunks = append(reply.chunks, &chunks[i])
+	}
+	c.replies = append(c.replies, reply)
+}
+
+// QueueError queues an error returned by the next chat call.
+func (c *Conversation) QueueError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.replies = append(c.replies, scriptedReply{err: err})
+}
+
+// Requests returns the chat requests received so far, from both ChatCompletion and ChatCompletionStream.
+func (c *Conversation) Requests() []gpt3.ChatCompletionRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]gpt3.ChatCompletionRequest(nil), c.requests...)
+}
+
+// Remaining returns the number of queued replies that have not been used.
+func (c *Conversation) Remaining() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.replies)
+}
+
+func (c *Conversation) next(request gpt3.ChatCompletionRequest) (scriptedReply, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, request)
+	if len(c.replies) == 0 {
+		return scriptedReply{}, ErrNoScriptedReply
+	}
+	reply := c.replies[0]
+	c.replies = c.replies[1:]
+	return reply, reply.err
+}
+
+func (c *Conversation) chatCompletion(
+	ctx context.Context,
+	request gpt3.ChatCompletionRequest,
+	opts ...gpt3.RequestOption,
+) (*gpt3.ChatCompletionResponse, error) {
+	reply, err := c.next(request)
+	if err != nil {
+		return nil, err
+	}
+	if reply.response == nil {
+		return nil, errors.New("scripted reply is a stream, not a response")
+	}
+	return reply.response, nil
+}
+
+func (c *Conversation) chatCompletionStream(
+	ctx context.Context,
+	request gpt3.ChatCompletionRequest,
+	onData func(*gpt3.ChatCompletionStreamResponse) error,
+	opts ...gpt3.RequestOption,
+) error {
+	reply, err := c.next(request)
+	if err != nil {
+		return err
+	}
+	if reply.chunks == nil {
+		return errors.New("scripted reply is a response, not a stream")
+	}
+	for _, chunk := range reply.chunks {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := onData(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
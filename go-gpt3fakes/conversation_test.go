@@ -0,0 +1,63 @@
+package gogpt3fakes_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	fakes "github.com/PullRequestInc/go-gpt3/go-gpt3fakes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConversation(t *testing.T) {
+	ctx := context.Background()
+	var client gpt3.Client
+	conversation := fakes.NewConversation()
+	client = conversation
+
+	conversation.QueueResponse(gpt3.ChatCompletionResponse{ID: "first"})
+	conversation.QueueStream(
+		gpt3.ChatCompletionStreamResponse{Choices: []gpt3.ChatCompletionStreamResponseChoice{{Delta: gpt3.ChatCompletionResponseMessage{Content: "a"}}}},
+		gpt3.ChatCompletionStreamResponse{Choices: []gpt3.ChatCompletionStreamResponseChoice{{Delta: gpt3.ChatCompletionResponseMessage{Content: "b"}}}},
+	)
+	conversation.QueueError(errors.New("boom"))
+	assert.Equal(t, 3, conversation.Remaining())
+
+	rsp, err := client.ChatCompletion(ctx, gpt3.ChatCompletionRequest{User: "one"})
+	assert.NoError(t, err)
+	assert.Equal(t, "first", rsp.ID)
+
+	var content string
+	err = client.ChatCompletionStream(ctx, gpt3.ChatCompletionRequest{User: "two"}, func(rsp *gpt3.ChatCompletionStreamResponse) error {
+		content += rsp.Choices[0].Delta.Content
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ab", content)
+
+	_, err = client.ChatCompletion(ctx, gpt3.ChatCompletionRequest{User: "three"})
+	assert.EqualError(t, err, "boom")
+
+	_, err = client.ChatCompletion(ctx, gpt3.ChatCompletionRequest{User: "four"})
+	assert.Equal(t, fakes.ErrNoScriptedReply, err)
+
+	var users []string
+	for _, request := range conversation.Requests() {
+		users = append(users, request.User)
+	}
+	assert.Equal(t, []string{"one", "two", "three", "four"}, users)
+	assert.Equal(t, 3, conversation.ChatCompletionCallCount())
+	assert.Equal(t, 1, conversation.ChatCompletionStreamCallCount())
+}
+
+func TestFakeClientStubs(t *testing.T) {
+	fake := &fakes.FakeClient{}
+	fake.EmbeddingsReturns(&gpt3.EmbeddingsResponse{Object: "list"}, nil)
+
+	rsp, err := fake.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: gpt3.TextEmbeddingAda002})
+	assert.NoError(t, err)
+	assert.Equal(t, "list", rsp.Object)
+	_, request, _ := fake.EmbeddingsArgsForCall(0)
+	assert.Equal(t, gpt3.TextEmbeddingAda002, request.Model)
+}
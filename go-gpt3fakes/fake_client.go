@@ -0,0 +1,1086 @@
+// Code generated by counterfeiter. DO NOT EDIT.
+package gogpt3fakes
+
+import (
+	"context"
+	"sync"
+
+	gpt3 "github.com/PullRequestInc/go-gpt3"
+)
+
+type FakeClient struct {
+	ChatCompletionStub        func(context.Context, gpt3.ChatCompletionRequest, ...gpt3.RequestOption) (*gpt3.ChatCompletionResponse, error)
+	chatCompletionMutex       sync.RWMutex
+	chatCompletionArgsForCall []struct {
+		arg1 context.Context
+		arg2 gpt3.ChatCompletionRequest
+		arg3 []gpt3.RequestOption
+	}
+	chatCompletionReturns struct {
+		result1 *gpt3.ChatCompletionResponse
+		result2 error
+	}
+	chatCompletionReturnsOnCall map[int]struct {
+		result1 *gpt3.ChatCompletionResponse
+		result2 error
+	}
+	ChatCompletionStreamStub        func(context.Context, gpt3.ChatCompletionRequest, func(*gpt3.ChatCompletionStreamResponse) error, ...gpt3.RequestOption) error
+	chatCompletionStreamMutex       sync.RWMutex
+	chatCompletionStreamArgsForCall []struct {
+		arg1 context.Context
+		arg2 gpt3.ChatCompletionRequest
+		arg3 func(*gpt3.ChatCompletionStreamResponse) error
+		arg4 []gpt3.RequestOption
+	}
+	chatCompletionStreamReturns struct {
+		result1 error
+	}
+	chatCompletionStreamReturnsOnCall map[int]struct {
+		result1 error
+	}
+	CompletionStub        func(context.Context, gpt3.CompletionRequest, ...gpt3.RequestOption) (*gpt3.CompletionResponse, error)
+	completionMutex       sync.RWMutex
+	completionArgsForCall []struct {
+		arg1 context.Context
+		arg2 gpt3.CompletionRequest
+		arg3 []gpt3.RequestOption
+	}
+	completionReturns struct {
+		result1 *gpt3.CompletionResponse
+		result2 error
+	}
+	completionReturnsOnCall map[int]struct {
+		result1 *gpt3.CompletionResponse
+		result2 error
+	}
+	CompletionStreamStub        func(context.Context, gpt3.CompletionRequest, func(*gpt3.CompletionResponse), ...gpt3.RequestOption) error
+	completionStreamMutex       sync.RWMutex
+	completionStreamArgsForCall []struct {
+		arg1 context.Context
+		arg2 gpt3.CompletionRequest
+		arg3 func(*gpt3.CompletionResponse)
+		arg4 []gpt3.RequestOption
+	}
+	completionStreamReturns struct {
+		result1 error
+	}
+	completionStreamReturnsOnCall map[int]struct {
+		result1 error
+	}
+	CompletionStreamWithEngineStub        func(context.Context, string, gpt3.CompletionRequest, func(*gpt3.CompletionResponse), ...gpt3.RequestOption) error
+	completionStreamWithEngineMutex       sync.RWMutex
+	completionStreamWithEngineArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 gpt3.CompletionRequest
+		arg4 func(*gpt3.CompletionResponse)
+		arg5 []gpt3.RequestOption
+	}
+	completionStreamWithEngineReturns struct {
+		result1 error
+	}
+	completionStreamWithEngineReturnsOnCall map[int]struct {
+		result1 error
+	}
+	CompletionWithEngineStub        func(context.Context, string, gpt3.CompletionRequest, ...gpt3.RequestOption) (*gpt3.CompletionResponse, error)
+	completionWithEngineMutex       sync.RWMutex
+	completionWithEngineArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 gpt3.CompletionRequest
+		arg4 []gpt3.RequestOption
+	}
+	completionWithEngineReturns struct {
+		result1 *gpt3.CompletionResponse
+		result2 error
+	}
+	completionWithEngineReturnsOnCall map[int]struct {
+		result1 *gpt3.CompletionResponse
+		result2 error
+	}
+	EditsStub        func(context.Context, gpt3.EditsRequest, ...gpt3.RequestOption) (*gpt3.EditsResponse, error)
+	editsMutex       sync.RWMutex
+	editsArgsForCall []struct {
+		arg1 context.Context
+		arg2 gpt3.EditsRequest
+		arg3 []gpt3.RequestOption
+	}
+	editsReturns struct {
+		result1 *gpt3.EditsResponse
+		result2 error
+	}
+	editsReturnsOnCall map[int]struct {
+		result1 *gpt3.EditsResponse
+		result2 error
+	}
+	EmbeddingsStub        func(context.Context, gpt3.EmbeddingsRequest, ...gpt3.RequestOption) (*gpt3.EmbeddingsResponse, error)
+	embeddingsMutex       sync.RWMutex
+	embeddingsArgsForCall []struct {
+		arg1 context.Context
+		arg2 gpt3.EmbeddingsRequest
+		arg3 []gpt3.RequestOption
+	}
+	embeddingsReturns struct {
+		result1 *gpt3.EmbeddingsResponse
+		result2 error
+	}
+	embeddingsReturnsOnCall map[int]struct {
+		result1 *gpt3.EmbeddingsResponse
+		result2 error
+	}
+	EngineStub        func(context.Context, string, ...gpt3.RequestOption) (*gpt3.EngineObject, error)
+	engineMutex       sync.RWMutex
+	engineArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 []gpt3.RequestOption
+	}
+	engineReturns struct {
+		result1 *gpt3.EngineObject
+		result2 error
+	}
+	engineReturnsOnCall map[int]struct {
+		result1 *gpt3.EngineObject
+		result2 error
+	}
+	EnginesStub        func(context.Context, ...gpt3.RequestOption) (*gpt3.EnginesResponse, error)
+	enginesMutex       sync.RWMutex
+	enginesArgsForCall []struct {
+		arg1 context.Context
+		arg2 []gpt3.RequestOption
+	}
+	enginesReturns struct {
+		result1 *gpt3.EnginesResponse
+		result2 error
+	}
+	enginesReturnsOnCall map[int]struct {
+		result1 *gpt3.EnginesResponse
+		result2 error
+	}
+	ModerationStub        func(context.Context, gpt3.ModerationRequest, ...gpt3.RequestOption) (*gpt3.ModerationResponse, error)
+	moderationMutex       sync.RWMutex
+	moderationArgsForCall []struct {
+		arg1 context.Context
+		arg2 gpt3.ModerationRequest
+		arg3 []gpt3.RequestOption
+	}
+	moderationReturns struct {
+		result1 *gpt3.ModerationResponse
+		result2 error
+	}
+	moderationReturnsOnCall map[int]struct {
+		result1 *gpt3.ModerationResponse
+		result2 error
+	}
+	SearchStub        func(context.Context, gpt3.SearchRequest, ...gpt3.RequestOption) (*gpt3.SearchResponse, error)
+	searchMutex       sync.RWMutex
+	searchArgsForCall []struct {
+		arg1 context.Context
+		arg2 gpt3.SearchRequest
+		arg3 []gpt3.RequestOption
+	}
+	searchReturns struct {
+		result1 *gpt3.SearchResponse
+		result2 error
+	}
+	searchReturnsOnCall map[int]struct {
+		result1 *gpt3.SearchResponse
+		result2 error
+	}
+	SearchWithEngineStub        func(context.Context, string, gpt3.SearchRequest, ...gpt3.RequestOption) (*gpt3.SearchResponse, error)
+	searchWithEngineMutex       sync.RWMutex
+	searchWithEngineArgsForCall []struct {
+		arg1 context.Context
+		arg2 string
+		arg3 gpt3.SearchRequest
+		arg4 []gpt3.RequestOption
+	}
+	searchWithEngineReturns struct {
+		result1 *gpt3.SearchResponse
+		result2 error
+	}
+	searchWithEngineReturnsOnCall map[int]struct {
+		result1 *gpt3.SearchResponse
+		result2 error
+	}
+	invocations      map[string][][]interface{}
+	invocationsMutex sync.RWMutex
+}
+
+func (fake *FakeClient) ChatCompletion(arg1 context.Context, arg2 gpt3.ChatCompletionRequest, arg3 ...gpt3.RequestOption) (*gpt3.ChatCompletionResponse, error) {
+	fake.chatCompletionMutex.Lock()
+	ret, specificReturn := fake.chatCompletionReturnsOnCall[len(fake.chatCompletionArgsForCall)]
+	fake.chatCompletionArgsForCall = append(fake.chatCompletionArgsForCall, struct {
+		arg1 context.Context
+		arg2 gpt3.ChatCompletionRequest
+		arg3 []gpt3.RequestOption
+	}{arg1, arg2, arg3})
+	stub := fake.ChatCompletionStub
+	fakeReturns := fake.chatCompletionReturns
+	fake.recordInvocation("ChatCompletion", []interface{}{arg1, arg2, arg3})
+	fake.chatCompletionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) ChatCompletionCallCount() int {
+	fake.chatCompletionMutex.RLock()
+	defer fake.chatCompletionMutex.RUnlock()
+	return len(fake.chatCompletionArgsForCall)
+}
+
+func (fake *FakeClient) ChatCompletionCalls(stub func(context.Context, gpt3.ChatCompletionRequest, ...gpt3.RequestOption) (*gpt3.ChatCompletionResponse, error)) {
+	fake.chatCompletionMutex.Lock()
+	defer fake.chatCompletionMutex.Unlock()
+	fake.ChatCompletionStub = stub
+}
+
+func (fake *FakeClient) ChatCompletionArgsForCall(i int) (context.Context, gpt3.ChatCompletionRequest, []gpt3.RequestOption) {
+	fake.chatCompletionMutex.RLock()
+	defer fake.chatCompletionMutex.RUnlock()
+	argsForCall := fake.chatCompletionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) ChatCompletionReturns(result1 *gpt3.ChatCompletionResponse, result2 error) {
+	fake.chatCompletionMutex.Lock()
+	defer fake.chatCompletionMutex.Unlock()
+	fake.ChatCompletionStub = nil
+	fake.chatCompletionReturns = struct {
+		result1 *gpt3.ChatCompletionResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ChatCompletionReturnsOnCall(i int, result1 *gpt3.ChatCompletionResponse, result2 error) {
+	fake.chatCompletionMutex.Lock()
+	defer fake.chatCompletionMutex.Unlock()
+	fake.ChatCompletionStub = nil
+	if fake.chatCompletionReturnsOnCall == nil {
+		fake.chatCompletionReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.ChatCompletionResponse
+			result2 error
+		})
+	}
+	fake.chatCompletionReturnsOnCall[i] = struct {
+		result1 *gpt3.ChatCompletionResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ChatCompletionStream(arg1 context.Context, arg2 gpt3.ChatCompletionRequest, arg3 func(*gpt3.ChatCompletionStreamResponse) error, arg4 ...gpt3.RequestOption) error {
+	fake.chatCompletionStreamMutex.Lock()
+	ret, specificReturn := fake.chatCompletionStreamReturnsOnCall[len(fake.chatCompletionStreamArgsForCall)]
+	fake.chatCompletionStreamArgsForCall = append(fake.chatCompletionStreamArgsForCall, struct {
+		arg1 context.Context
+		arg2 gpt3.ChatCompletionRequest
+		arg3 func(*gpt3.ChatCompletionStreamResponse) error
+		arg4 []gpt3.RequestOption
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.ChatCompletionStreamStub
+	fakeReturns := fake.chatCompletionStreamReturns
+	fake.recordInvocation("ChatCompletionStream", []interface{}{arg1, arg2, arg3, arg4})
+	fake.chatCompletionStreamMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4...)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) ChatCompletionStreamCallCount() int {
+	fake.chatCompletionStreamMutex.RLock()
+	defer fake.chatCompletionStreamMutex.RUnlock()
+	return len(fake.chatCompletionStreamArgsForCall)
+}
+
+func (fake *FakeClient) ChatCompletionStreamCalls(stub func(context.Context, gpt3.ChatCompletionRequest, func(*gpt3.ChatCompletionStreamResponse) error, ...gpt3.RequestOption) error) {
+	fake.chatCompletionStreamMutex.Lock()
+	defer fake.chatCompletionStreamMutex.Unlock()
+	fake.ChatCompletionStreamStub = stub
+}
+
+func (fake *FakeClient) ChatCompletionStreamArgsForCall(i int) (context.Context, gpt3.ChatCompletionRequest, func(*gpt3.ChatCompletionStreamResponse) error, []gpt3.RequestOption) {
+	fake.chatCompletionStreamMutex.RLock()
+	defer fake.chatCompletionStreamMutex.RUnlock()
+	argsForCall := fake.chatCompletionStreamArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeClient) ChatCompletionStreamReturns(result1 error) {
+	fake.chatCompletionStreamMutex.Lock()
+	defer fake.chatCompletionStreamMutex.Unlock()
+	fake.ChatCompletionStreamStub = nil
+	fake.chatCompletionStreamReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) ChatCompletionStreamReturnsOnCall(i int, result1 error) {
+	fake.chatCompletionStreamMutex.Lock()
+	defer fake.chatCompletionStreamMutex.Unlock()
+	fake.ChatCompletionStreamStub = nil
+	if fake.chatCompletionStreamReturnsOnCall == nil {
+		fake.chatCompletionStreamReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.chatCompletionStreamReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) Completion(arg1 context.Context, arg2 gpt3.CompletionRequest, arg3 ...gpt3.RequestOption) (*gpt3.CompletionResponse, error) {
+	fake.completionMutex.Lock()
+	ret, specificReturn := fake.completionReturnsOnCall[len(fake.completionArgsForCall)]
+	fake.completionArgsForCall = append(fake.completionArgsForCall, struct {
+		arg1 context.Context
+		arg2 gpt3.CompletionRequest
+		arg3 []gpt3.RequestOption
+	}{arg1, arg2, arg3})
+	stub := fake.CompletionStub
+	fakeReturns := fake.completionReturns
+	fake.recordInvocation("Completion", []interface{}{arg1, arg2, arg3})
+	fake.completionMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) CompletionCallCount() int {
+	fake.completionMutex.RLock()
+	defer fake.completionMutex.RUnlock()
+	return len(fake.completionArgsForCall)
+}
+
+func (fake *FakeClient) CompletionCalls(stub func(context.Context, gpt3.CompletionRequest, ...gpt3.RequestOption) (*gpt3.CompletionResponse, error)) {
+	fake.completionMutex.Lock()
+	defer fake.completionMutex.Unlock()
+	fake.CompletionStub = stub
+}
+
+func (fake *FakeClient) CompletionArgsForCall(i int) (context.Context, gpt3.CompletionRequest, []gpt3.RequestOption) {
+	fake.completionMutex.RLock()
+	defer fake.completionMutex.RUnlock()
+	argsForCall := fake.completionArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) CompletionReturns(result1 *gpt3.CompletionResponse, result2 error) {
+	fake.completionMutex.Lock()
+	defer fake.completionMutex.Unlock()
+	fake.CompletionStub = nil
+	fake.completionReturns = struct {
+		result1 *gpt3.CompletionResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) CompletionReturnsOnCall(i int, result1 *gpt3.CompletionResponse, result2 error) {
+	fake.completionMutex.Lock()
+	defer fake.completionMutex.Unlock()
+	fake.CompletionStub = nil
+	if fake.completionReturnsOnCall == nil {
+		fake.completionReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.CompletionResponse
+			result2 error
+		})
+	}
+	fake.completionReturnsOnCall[i] = struct {
+		result1 *gpt3.CompletionResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) CompletionStream(arg1 context.Context, arg2 gpt3.CompletionRequest, arg3 func(*gpt3.CompletionResponse), arg4 ...gpt3.RequestOption) error {
+	fake.completionStreamMutex.Lock()
+	ret, specificReturn := fake.completionStreamReturnsOnCall[len(fake.completionStreamArgsForCall)]
+	fake.completionStreamArgsForCall = append(fake.completionStreamArgsForCall, struct {
+		arg1 context.Context
+		arg2 gpt3.CompletionRequest
+		arg3 func(*gpt3.CompletionResponse)
+		arg4 []gpt3.RequestOption
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.CompletionStreamStub
+	fakeReturns := fake.completionStreamReturns
+	fake.recordInvocation("CompletionStream", []interface{}{arg1, arg2, arg3, arg4})
+	fake.completionStreamMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4...)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) CompletionStreamCallCount() int {
+	fake.completionStreamMutex.RLock()
+	defer fake.completionStreamMutex.RUnlock()
+	return len(fake.completionStreamArgsForCall)
+}
+
+func (fake *FakeClient) CompletionStreamCalls(stub func(context.Context, gpt3.CompletionRequest, func(*gpt3.CompletionResponse), ...gpt3.RequestOption) error) {
+	fake.completionStreamMutex.Lock()
+	defer fake.completionStreamMutex.Unlock()
+	fake.CompletionStreamStub = stub
+}
+
+func (fake *FakeClient) CompletionStreamArgsForCall(i int) (context.Context, gpt3.CompletionRequest, func(*gpt3.CompletionResponse), []gpt3.RequestOption) {
+	fake.completionStreamMutex.RLock()
+	defer fake.completionStreamMutex.RUnlock()
+	argsForCall := fake.completionStreamArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeClient) CompletionStreamReturns(result1 error) {
+	fake.completionStreamMutex.Lock()
+	defer fake.completionStreamMutex.Unlock()
+	fake.CompletionStreamStub = nil
+	fake.completionStreamReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) CompletionStreamReturnsOnCall(i int, result1 error) {
+	fake.completionStreamMutex.Lock()
+	defer fake.completionStreamMutex.Unlock()
+	fake.CompletionStreamStub = nil
+	if fake.completionStreamReturnsOnCall == nil {
+		fake.completionStreamReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.completionStreamReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) CompletionStreamWithEngine(arg1 context.Context, arg2 string, arg3 gpt3.CompletionRequest, arg4 func(*gpt3.CompletionResponse), arg5 ...gpt3.RequestOption) error {
+	fake.completionStreamWithEngineMutex.Lock()
+	ret, specificReturn := fake.completionStreamWithEngineReturnsOnCall[len(fake.completionStreamWithEngineArgsForCall)]
+	fake.completionStreamWithEngineArgsForCall = append(fake.completionStreamWithEngineArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 gpt3.CompletionRequest
+		arg4 func(*gpt3.CompletionResponse)
+		arg5 []gpt3.RequestOption
+	}{arg1, arg2, arg3, arg4, arg5})
+	stub := fake.CompletionStreamWithEngineStub
+	fakeReturns := fake.completionStreamWithEngineReturns
+	fake.recordInvocation("CompletionStreamWithEngine", []interface{}{arg1, arg2, arg3, arg4, arg5})
+	fake.completionStreamWithEngineMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4, arg5...)
+	}
+	if specificReturn {
+		return ret.result1
+	}
+	return fakeReturns.result1
+}
+
+func (fake *FakeClient) CompletionStreamWithEngineCallCount() int {
+	fake.completionStreamWithEngineMutex.RLock()
+	defer fake.completionStreamWithEngineMutex.RUnlock()
+	return len(fake.completionStreamWithEngineArgsForCall)
+}
+
+func (fake *FakeClient) CompletionStreamWithEngineCalls(stub func(context.Context, string, gpt3.CompletionRequest, func(*gpt3.CompletionResponse), ...gpt3.RequestOption) error) {
+	fake.completionStreamWithEngineMutex.Lock()
+	defer fake.completionStreamWithEngineMutex.Unlock()
+	fake.CompletionStreamWithEngineStub = stub
+}
+
+func (fake *FakeClient) CompletionStreamWithEngineArgsForCall(i int) (context.Context, string, gpt3.CompletionRequest, func(*gpt3.CompletionResponse), []gpt3.RequestOption) {
+	fake.completionStreamWithEngineMutex.RLock()
+	defer fake.completionStreamWithEngineMutex.RUnlock()
+	argsForCall := fake.completionStreamWithEngineArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4, argsForCall.arg5
+}
+
+func (fake *FakeClient) CompletionStreamWithEngineReturns(result1 error) {
+	fake.completionStreamWithEngineMutex.Lock()
+	defer fake.completionStreamWithEngineMutex.Unlock()
+	fake.CompletionStreamWithEngineStub = nil
+	fake.completionStreamWithEngineReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) CompletionStreamWithEngineReturnsOnCall(i int, result1 error) {
+	fake.completionStreamWithEngineMutex.Lock()
+	defer fake.completionStreamWithEngineMutex.Unlock()
+	fake.CompletionStreamWithEngineStub = nil
+	if fake.completionStreamWithEngineReturnsOnCall == nil {
+		fake.completionStreamWithEngineReturnsOnCall = make(map[int]struct {
+			result1 error
+		})
+	}
+	fake.completionStreamWithEngineReturnsOnCall[i] = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeClient) CompletionWithEngine(arg1 context.Context, arg2 string, arg3 gpt3.CompletionRequest, arg4 ...gpt3.RequestOption) (*gpt3.CompletionResponse, error) {
+	fake.completionWithEngineMutex.Lock()
+	ret, specificReturn := fake.completionWithEngineReturnsOnCall[len(fake.completionWithEngineArgsForCall)]
+	fake.completionWithEngineArgsForCall = append(fake.completionWithEngineArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 gpt3.CompletionRequest
+		arg4 []gpt3.RequestOption
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.CompletionWithEngineStub
+	fakeReturns := fake.completionWithEngineReturns
+	fake.recordInvocation("CompletionWithEngine", []interface{}{arg1, arg2, arg3, arg4})
+	fake.completionWithEngineMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) CompletionWithEngineCallCount() int {
+	fake.completionWithEngineMutex.RLock()
+	defer fake.completionWithEngineMutex.RUnlock()
+	return len(fake.completionWithEngineArgsForCall)
+}
+
+func (fake *FakeClient) CompletionWithEngineCalls(stub func(context.Context, string, gpt3.CompletionRequest, ...gpt3.RequestOption) (*gpt3.CompletionResponse, error)) {
+	fake.completionWithEngineMutex.Lock()
+	defer fake.completionWithEngineMutex.Unlock()
+	fake.CompletionWithEngineStub = stub
+}
+
+func (fake *FakeClient) CompletionWithEngineArgsForCall(i int) (context.Context, string, gpt3.CompletionRequest, []gpt3.RequestOption) {
+	fake.completionWithEngineMutex.RLock()
+	defer fake.completionWithEngineMutex.RUnlock()
+	argsForCall := fake.completionWithEngineArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeClient) CompletionWithEngineReturns(result1 *gpt3.CompletionResponse, result2 error) {
+	fake.completionWithEngineMutex.Lock()
+	defer fake.completionWithEngineMutex.Unlock()
+	fake.CompletionWithEngineStub = nil
+	fake.completionWithEngineReturns = struct {
+		result1 *gpt3.CompletionResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) CompletionWithEngineReturnsOnCall(i int, result1 *gpt3.CompletionResponse, result2 error) {
+	fake.completionWithEngineMutex.Lock()
+	defer fake.completionWithEngineMutex.Unlock()
+	fake.CompletionWithEngineStub = nil
+	if fake.completionWithEngineReturnsOnCall == nil {
+		fake.completionWithEngineReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.CompletionResponse
+			result2 error
+		})
+	}
+	fake.completionWithEngineReturnsOnCall[i] = struct {
+		result1 *gpt3.CompletionResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) Edits(arg1 context.Context, arg2 gpt3.EditsRequest, arg3 ...gpt3.RequestOption) (*gpt3.EditsResponse, error) {
+	fake.editsMutex.Lock()
+	ret, specificReturn := fake.editsReturnsOnCall[len(fake.editsArgsForCall)]
+	fake.editsArgsForCall = append(fake.editsArgsForCall, struct {
+		arg1 context.Context
+		arg2 gpt3.EditsRequest
+		arg3 []gpt3.RequestOption
+	}{arg1, arg2, arg3})
+	stub := fake.EditsStub
+	fakeReturns := fake.editsReturns
+	fake.recordInvocation("Edits", []interface{}{arg1, arg2, arg3})
+	fake.editsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) EditsCallCount() int {
+	fake.editsMutex.RLock()
+	defer fake.editsMutex.RUnlock()
+	return len(fake.editsArgsForCall)
+}
+
+func (fake *FakeClient) EditsCalls(stub func(context.Context, gpt3.EditsRequest, ...gpt3.RequestOption) (*gpt3.EditsResponse, error)) {
+	fake.editsMutex.Lock()
+	defer fake.editsMutex.Unlock()
+	fake.EditsStub = stub
+}
+
+func (fake *FakeClient) EditsArgsForCall(i int) (context.Context, gpt3.EditsRequest, []gpt3.RequestOption) {
+	fake.editsMutex.RLock()
+	defer fake.editsMutex.RUnlock()
+	argsForCall := fake.editsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) EditsReturns(result1 *gpt3.EditsResponse, result2 error) {
+	fake.editsMutex.Lock()
+	defer fake.editsMutex.Unlock()
+	fake.EditsStub = nil
+	fake.editsReturns = struct {
+		result1 *gpt3.EditsResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) EditsReturnsOnCall(i int, result1 *gpt3.EditsResponse, result2 error) {
+	fake.editsMutex.Lock()
+	defer fake.editsMutex.Unlock()
+	fake.EditsStub = nil
+	if fake.editsReturnsOnCall == nil {
+		fake.editsReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.EditsResponse
+			result2 error
+		})
+	}
+	fake.editsReturnsOnCall[i] = struct {
+		result1 *gpt3.EditsResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) Embeddings(arg1 context.Context, arg2 gpt3.EmbeddingsRequest, arg3 ...gpt3.RequestOption) (*gpt3.EmbeddingsResponse, error) {
+	fake.embeddingsMutex.Lock()
+	ret, specificReturn := fake.embeddingsReturnsOnCall[len(fake.embeddingsArgsForCall)]
+	fake.embeddingsArgsForCall = append(fake.embeddingsArgsForCall, struct {
+		arg1 context.Context
+		arg2 gpt3.EmbeddingsRequest
+		arg3 []gpt3.RequestOption
+	}{arg1, arg2, arg3})
+	stub := fake.EmbeddingsStub
+	fakeReturns := fake.embeddingsReturns
+	fake.recordInvocation("Embeddings", []interface{}{arg1, arg2, arg3})
+	fake.embeddingsMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) EmbeddingsCallCount() int {
+	fake.embeddingsMutex.RLock()
+	defer fake.embeddingsMutex.RUnlock()
+	return len(fake.embeddingsArgsForCall)
+}
+
+func (fake *FakeClient) EmbeddingsCalls(stub func(context.Context, gpt3.EmbeddingsRequest, ...gpt3.RequestOption) (*gpt3.EmbeddingsResponse, error)) {
+	fake.embeddingsMutex.Lock()
+	defer fake.embeddingsMutex.Unlock()
+	fake.EmbeddingsStub = stub
+}
+
+func (fake *FakeClient) EmbeddingsArgsForCall(i int) (context.Context, gpt3.EmbeddingsRequest, []gpt3.RequestOption) {
+	fake.embeddingsMutex.RLock()
+	defer fake.embeddingsMutex.RUnlock()
+	argsForCall := fake.embeddingsArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) EmbeddingsReturns(result1 *gpt3.EmbeddingsResponse, result2 error) {
+	fake.embeddingsMutex.Lock()
+	defer fake.embeddingsMutex.Unlock()
+	fake.EmbeddingsStub = nil
+	fake.embeddingsReturns = struct {
+		result1 *gpt3.EmbeddingsResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) EmbeddingsReturnsOnCall(i int, result1 *gpt3.EmbeddingsResponse, result2 error) {
+	fake.embeddingsMutex.Lock()
+	defer fake.embeddingsMutex.Unlock()
+	fake.EmbeddingsStub = nil
+	if fake.embeddingsReturnsOnCall == nil {
+		fake.embeddingsReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.EmbeddingsResponse
+			result2 error
+		})
+	}
+	fake.embeddingsReturnsOnCall[i] = struct {
+		result1 *gpt3.EmbeddingsResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) Engine(arg1 context.Context, arg2 string, arg3 ...gpt3.RequestOption) (*gpt3.EngineObject, error) {
+	fake.engineMutex.Lock()
+	ret, specificReturn := fake.engineReturnsOnCall[len(fake.engineArgsForCall)]
+	fake.engineArgsForCall = append(fake.engineArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 []gpt3.RequestOption
+	}{arg1, arg2, arg3})
+	stub := fake.EngineStub
+	fakeReturns := fake.engineReturns
+	fake.recordInvocation("Engine", []interface{}{arg1, arg2, arg3})
+	fake.engineMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) EngineCallCount() int {
+	fake.engineMutex.RLock()
+	defer fake.engineMutex.RUnlock()
+	return len(fake.engineArgsForCall)
+}
+
+func (fake *FakeClient) EngineCalls(stub func(context.Context, string, ...gpt3.RequestOption) (*gpt3.EngineObject, error)) {
+	fake.engineMutex.Lock()
+	defer fake.engineMutex.Unlock()
+	fake.EngineStub = stub
+}
+
+func (fake *FakeClient) EngineArgsForCall(i int) (context.Context, string, []gpt3.RequestOption) {
+	fake.engineMutex.RLock()
+	defer fake.engineMutex.RUnlock()
+	argsForCall := fake.engineArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) EngineReturns(result1 *gpt3.EngineObject, result2 error) {
+	fake.engineMutex.Lock()
+	defer fake.engineMutex.Unlock()
+	fake.EngineStub = nil
+	fake.engineReturns = struct {
+		result1 *gpt3.EngineObject
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) EngineReturnsOnCall(i int, result1 *gpt3.EngineObject, result2 error) {
+	fake.engineMutex.Lock()
+	defer fake.engineMutex.Unlock()
+	fake.EngineStub = nil
+	if fake.engineReturnsOnCall == nil {
+		fake.engineReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.EngineObject
+			result2 error
+		})
+	}
+	fake.engineReturnsOnCall[i] = struct {
+		result1 *gpt3.EngineObject
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) Engines(arg1 context.Context, arg2 ...gpt3.RequestOption) (*gpt3.EnginesResponse, error) {
+	fake.enginesMutex.Lock()
+	ret, specificReturn := fake.enginesReturnsOnCall[len(fake.enginesArgsForCall)]
+	fake.enginesArgsForCall = append(fake.enginesArgsForCall, struct {
+		arg1 context.Context
+		arg2 []gpt3.RequestOption
+	}{arg1, arg2})
+	stub := fake.EnginesStub
+	fakeReturns := fake.enginesReturns
+	fake.recordInvocation("Engines", []interface{}{arg1, arg2})
+	fake.enginesMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) EnginesCallCount() int {
+	fake.enginesMutex.RLock()
+	defer fake.enginesMutex.RUnlock()
+	return len(fake.enginesArgsForCall)
+}
+
+func (fake *FakeClient) EnginesCalls(stub func(context.Context, ...gpt3.RequestOption) (*gpt3.EnginesResponse, error)) {
+	fake.enginesMutex.Lock()
+	defer fake.enginesMutex.Unlock()
+	fake.EnginesStub = stub
+}
+
+func (fake *FakeClient) EnginesArgsForCall(i int) (context.Context, []gpt3.RequestOption) {
+	fake.enginesMutex.RLock()
+	defer fake.enginesMutex.RUnlock()
+	argsForCall := fake.enginesArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2
+}
+
+func (fake *FakeClient) EnginesReturns(result1 *gpt3.EnginesResponse, result2 error) {
+	fake.enginesMutex.Lock()
+	defer fake.enginesMutex.Unlock()
+	fake.EnginesStub = nil
+	fake.enginesReturns = struct {
+		result1 *gpt3.EnginesResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) EnginesReturnsOnCall(i int, result1 *gpt3.EnginesResponse, result2 error) {
+	fake.enginesMutex.Lock()
+	defer fake.enginesMutex.Unlock()
+	fake.EnginesStub = nil
+	if fake.enginesReturnsOnCall == nil {
+		fake.enginesReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.EnginesResponse
+			result2 error
+		})
+	}
+	fake.enginesReturnsOnCall[i] = struct {
+		result1 *gpt3.EnginesResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) Moderation(arg1 context.Context, arg2 gpt3.ModerationRequest, arg3 ...gpt3.RequestOption) (*gpt3.ModerationResponse, error) {
+	fake.moderationMutex.Lock()
+	ret, specificReturn := fake.moderationReturnsOnCall[len(fake.moderationArgsForCall)]
+	fake.moderationArgsForCall = append(fake.moderationArgsForCall, struct {
+		arg1 context.Context
+		arg2 gpt3.ModerationRequest
+		arg3 []gpt3.RequestOption
+	}{arg1, arg2, arg3})
+	stub := fake.ModerationStub
+	fakeReturns := fake.moderationReturns
+	fake.recordInvocation("Moderation", []interface{}{arg1, arg2, arg3})
+	fake.moderationMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) ModerationCallCount() int {
+	fake.moderationMutex.RLock()
+	defer fake.moderationMutex.RUnlock()
+	return len(fake.moderationArgsForCall)
+}
+
+func (fake *FakeClient) ModerationCalls(stub func(context.Context, gpt3.ModerationRequest, ...gpt3.RequestOption) (*gpt3.ModerationResponse, error)) {
+	fake.moderationMutex.Lock()
+	defer fake.moderationMutex.Unlock()
+	fake.ModerationStub = stub
+}
+
+func (fake *FakeClient) ModerationArgsForCall(i int) (context.Context, gpt3.ModerationRequest, []gpt3.RequestOption) {
+	fake.moderationMutex.RLock()
+	defer fake.moderationMutex.RUnlock()
+	argsForCall := fake.moderationArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) ModerationReturns(result1 *gpt3.ModerationResponse, result2 error) {
+	fake.moderationMutex.Lock()
+	defer fake.moderationMutex.Unlock()
+	fake.ModerationStub = nil
+	fake.moderationReturns = struct {
+		result1 *gpt3.ModerationResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) ModerationReturnsOnCall(i int, result1 *gpt3.ModerationResponse, result2 error) {
+	fake.moderationMutex.Lock()
+	defer fake.moderationMutex.Unlock()
+	fake.ModerationStub = nil
+	if fake.moderationReturnsOnCall == nil {
+		fake.moderationReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.ModerationResponse
+			result2 error
+		})
+	}
+	fake.moderationReturnsOnCall[i] = struct {
+		result1 *gpt3.ModerationResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) Search(arg1 context.Context, arg2 gpt3.SearchRequest, arg3 ...gpt3.RequestOption) (*gpt3.SearchResponse, error) {
+	fake.searchMutex.Lock()
+	ret, specificReturn := fake.searchReturnsOnCall[len(fake.searchArgsForCall)]
+	fake.searchArgsForCall = append(fake.searchArgsForCall, struct {
+		arg1 context.Context
+		arg2 gpt3.SearchRequest
+		arg3 []gpt3.RequestOption
+	}{arg1, arg2, arg3})
+	stub := fake.SearchStub
+	fakeReturns := fake.searchReturns
+	fake.recordInvocation("Search", []interface{}{arg1, arg2, arg3})
+	fake.searchMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) SearchCallCount() int {
+	fake.searchMutex.RLock()
+	defer fake.searchMutex.RUnlock()
+	return len(fake.searchArgsForCall)
+}
+
+func (fake *FakeClient) SearchCalls(stub func(context.Context, gpt3.SearchRequest, ...gpt3.RequestOption) (*gpt3.SearchResponse, error)) {
+	fake.searchMutex.Lock()
+	defer fake.searchMutex.Unlock()
+	fake.SearchStub = stub
+}
+
+func (fake *FakeClient) SearchArgsForCall(i int) (context.Context, gpt3.SearchRequest, []gpt3.RequestOption) {
+	fake.searchMutex.RLock()
+	defer fake.searchMutex.RUnlock()
+	argsForCall := fake.searchArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3
+}
+
+func (fake *FakeClient) SearchReturns(result1 *gpt3.SearchResponse, result2 error) {
+	fake.searchMutex.Lock()
+	defer fake.searchMutex.Unlock()
+	fake.SearchStub = nil
+	fake.searchReturns = struct {
+		result1 *gpt3.SearchResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) SearchReturnsOnCall(i int, result1 *gpt3.SearchResponse, result2 error) {
+	fake.searchMutex.Lock()
+	defer fake.searchMutex.Unlock()
+	fake.SearchStub = nil
+	if fake.searchReturnsOnCall == nil {
+		fake.searchReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.SearchResponse
+			result2 error
+		})
+	}
+	fake.searchReturnsOnCall[i] = struct {
+		result1 *gpt3.SearchResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) SearchWithEngine(arg1 context.Context, arg2 string, arg3 gpt3.SearchRequest, arg4 ...gpt3.RequestOption) (*gpt3.SearchResponse, error) {
+	fake.searchWithEngineMutex.Lock()
+	ret, specificReturn := fake.searchWithEngineReturnsOnCall[len(fake.searchWithEngineArgsForCall)]
+	fake.searchWithEngineArgsForCall = append(fake.searchWithEngineArgsForCall, struct {
+		arg1 context.Context
+		arg2 string
+		arg3 gpt3.SearchRequest
+		arg4 []gpt3.RequestOption
+	}{arg1, arg2, arg3, arg4})
+	stub := fake.SearchWithEngineStub
+	fakeReturns := fake.searchWithEngineReturns
+	fake.recordInvocation("SearchWithEngine", []interface{}{arg1, arg2, arg3, arg4})
+	fake.searchWithEngineMutex.Unlock()
+	if stub != nil {
+		return stub(arg1, arg2, arg3, arg4...)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *FakeClient) SearchWithEngineCallCount() int {
+	fake.searchWithEngineMutex.RLock()
+	defer fake.searchWithEngineMutex.RUnlock()
+	return len(fake.searchWithEngineArgsForCall)
+}
+
+func (fake *FakeClient) SearchWithEngineCalls(stub func(context.Context, string, gpt3.SearchRequest, ...gpt3.RequestOption) (*gpt3.SearchResponse, error)) {
+	fake.searchWithEngineMutex.Lock()
+	defer fake.searchWithEngineMutex.Unlock()
+	fake.SearchWithEngineStub = stub
+}
+
+func (fake *FakeClient) SearchWithEngineArgsForCall(i int) (context.Context, string, gpt3.SearchRequest, []gpt3.RequestOption) {
+	fake.searchWithEngineMutex.RLock()
+	defer fake.searchWithEngineMutex.RUnlock()
+	argsForCall := fake.searchWithEngineArgsForCall[i]
+	return argsForCall.arg1, argsForCall.arg2, argsForCall.arg3, argsForCall.arg4
+}
+
+func (fake *FakeClient) SearchWithEngineReturns(result1 *gpt3.SearchResponse, result2 error) {
+	fake.searchWithEngineMutex.Lock()
+	defer fake.searchWithEngineMutex.Unlock()
+	fake.SearchWithEngineStub = nil
+	fake.searchWithEngineReturns = struct {
+		result1 *gpt3.SearchResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) SearchWithEngineReturnsOnCall(i int, result1 *gpt3.SearchResponse, result2 error) {
+	fake.searchWithEngineMutex.Lock()
+	defer fake.searchWithEngineMutex.Unlock()
+	fake.SearchWithEngineStub = nil
+	if fake.searchWithEngineReturnsOnCall == nil {
+		fake.searchWithEngineReturnsOnCall = make(map[int]struct {
+			result1 *gpt3.SearchResponse
+			result2 error
+		})
+	}
+	fake.searchWithEngineReturnsOnCall[i] = struct {
+		result1 *gpt3.SearchResponse
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *FakeClient) Invocations() map[string][][]interface{} {
+	fake.invocationsMutex.RLock()
+	defer fake.invocationsMutex.RUnlock()
+	copiedInvocations := map[string][][]interface{}{}
+	for key, value := range fake.invocations {
+		copiedInvocations[key] = value
+	}
+	return copiedInvocations
+}
+
+func (fake *FakeClient) recordInvocation(key string, args []interface{}) {
+	fake.invocationsMutex.Lock()
+	defer fake.invocationsMutex.Unlock()
+	if fake.invocations == nil {
+		fake.invocations = map[string][][]interface{}{}
+	}
+	if fake.invocations[key] == nil {
+		fake.invocations[key] = [][]interface{}{}
+	}
+	fake.invocations[key] = append(fake.invocations[key], args)
+}
+
+var _ gpt3.Client = new(FakeClient)
@@ -5,10 +5,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -50,11 +52,21 @@ const (
 	CodeSearchBabbageCode001  = "code-search-babbage-code-001"
 	CodeSearchBabbageText001  = "code-search-babbage-text-001"
 	TextEmbeddingAda002       = "text-embedding-ada-002"
+	TextEmbedding3Small       = "text-embedding-3-small"
+	TextEmbedding3Large       = "text-embedding-3-large"
 )
 
+// Embedding encoding formats
 const (
-	TextModerationLatest = "text-moderation-latest"
-	TextModerationStable = "text-moderation-stable"
+	EmbeddingEncodingFloat  = "float"
+	EmbeddingEncodingBase64 = "base64"
+)
+
+const (
+	TextModerationLatest   = "text-moderation-latest"
+	TextModerationStable   = "text-moderation-stable"
+	OmniModerationLatest   = "omni-moderation-latest"
+	OmniModeration20240926 = "omni-moderation-2024-09-26"
 )
 
 const (
@@ -67,53 +79,60 @@ func getEngineURL(engine string) string {
 	return fmt.Sprintf("%s/engines/%s/completions", defaultBaseURL, engine)
 }
 
-// A Client is an API client to communicate with the OpenAI gpt-3 APIs
+//go:generate go run github.com/maxbrunsfeld/counterfeiter/v6 -o go-gpt3fakes/fake_client.go . Client
+
+// A Client is an API client to communicate with the OpenAI gpt-3 APIs. Every method accepts
+// RequestOptions that customize that single call, such as extra headers, extra body fields or a timeout.
 type Client interface {
 	// Engines lists the currently available engines, and provides basic information about each
 	// option such as the owner and availability.
-	Engines(ctx context.Context) (*EnginesResponse, error)
+	Engines(ctx context.Context, opts ...RequestOption) (*EnginesResponse, error)
 
 	// Engine retrieves an engine instance, providing basic information about the engine such
 	// as the owner and availability.
-	Engine(ctx context.Context, engine string) (*EngineObject, error)
+	Engine(ctx context.Context, engine string, opts ...RequestOption) (*EngineObject, error)
 
 	// ChatCompletion creates a completion with the Chat completion endpoint which
 	// is what powers the ChatGPT experience.
-	ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletionResponse, error)
+	ChatCompletion(ctx context.Context, request ChatCompletionRequest, opts ...RequestOption) (*ChatCompletionResponse, error)
 
 	// ChatCompletion creates a completion with the Chat completion endpoint which
 	// is what powers the ChatGPT experience.
-	ChatCompletionStream(ctx context.Context, request ChatCompletionRequest, onData func(*ChatCompletionStreamResponse) error) error
+	ChatCompletionStream(ctx context.Context, request ChatCompletionRequest, onData func(*ChatCompletionStreamResponse) error, opts ...RequestOption) error
 
 	// Completion creates a completion with the default engine. This is the main endpoint of the API
 	// which auto-completes based on the given prompt.
-	Completion(ctx context.Context, request CompletionRequest) (*CompletionResponse, error)
+	Completion(ctx context.Context, request CompletionRequest, opts ...RequestOption) (*CompletionResponse, error)
 
 	// CompletionStream creates a completion with the default engine and streams the results through
 	// multiple calls to onData.
-	CompletionStream(ctx context.Context, request CompletionRequest, onData func(*CompletionResponse)) error
+	CompletionStream(ctx context.Context, request CompletionRequest, onData func(*CompletionResponse), opts ...RequestOption) error
 
 	// CompletionWithEngine is the same as Completion except allows overriding the default engine on the client
-	CompletionWithEngine(ctx context.Context, engine string, request CompletionRequest) (*CompletionResponse, error)
+	CompletionWithEngine(ctx context.Context, engine string, request CompletionRequest, opts ...RequestOption) (*CompletionResponse, error)
 
 	// CompletionStreamWithEngine is the same as CompletionStream except allows overriding the default engine on the client
-	CompletionStreamWithEngine(ctx context.Context, engine string, request CompletionRequest, onData func(*CompletionResponse)) error
+	CompletionStreamWithEngine(ctx context.Context, engine string, request CompletionRequest, onData func(*CompletionResponse), opts ...RequestOption) error
 
 	// Given a prompt and an instruction, the model will return an edited version of the prompt.
-	Edits(ctx context.Context, request EditsRequest) (*EditsResponse, error)
+	Edits(ctx context.Context, request EditsRequest, opts ...RequestOption) (*EditsResponse, error)
 
-	// Search performs a semantic search over a list of documents with the default engine.
-	Search(ctx context.Context, request SearchRequest) (*SearchResponse, error)
+	// Search performs a semantic search over a list of documents. The search endpoint of the API
+	// was shut down, so the query and the documents are embedded with the search model, see
+	// WithSearchModel, and each document is scored by the cosine similarity of its embedding to
+	// the query's, from -1 to 1. The results are in the order of the documents.
+	Search(ctx context.Context, request SearchRequest, opts ...RequestOption) (*SearchResponse, error)
 
-	// SearchWithEngine performs a semantic search over a list of documents with the specified engine.
-	SearchWithEngine(ctx context.Context, engine string, request SearchRequest) (*SearchResponse, error)
+	// SearchWithEngine is the same as Search except that engine is used as the embedding model if
+	// it is one, e.g. TextEmbedding3Large. Other engines use the search model of the client.
+	SearchWithEngine(ctx context.Context, engine string, request SearchRequest, opts ...RequestOption) (*SearchResponse, error)
 
 	// Returns an embedding using the provided request.
-	Embeddings(ctx context.Context, request EmbeddingsRequest) (*EmbeddingsResponse, error)
+	Embeddings(ctx context.Context, request EmbeddingsRequest, opts ...RequestOption) (*EmbeddingsResponse, error)
 
-	// Moderation performs a moderation check on the given text against an OpenAI classifier to determine whether the
-	// provided content complies with OpenAI's usage policies.
-	Moderation(ctx context.Context, request ModerationRequest) (*ModerationResponse, error)
+	// Moderation performs a moderation check on the given text, texts or images against an OpenAI classifier to
+	// determine whether the provided content complies with OpenAI's usage policies.
+	Moderation(ctx context.Context, request ModerationRequest, opts ...RequestOption) (*ModerationResponse, error)
 }
 
 type client struct {
@@ -121,65 +140,134 @@ type client struct {
 	apiKey        string
 	userAgent     string
 	httpClient    *http.Client
+	timeout       *time.Duration
 	defaultEngine string
 	idOrg         string
+	project       string
+	appInfo       []string
+	azure         *AzureConfig
+	credentials   CredentialProvider
+	maxRetries    int
+	balancer      *balancer
+	searchModel   string
+	searchCache   EmbeddingCache
+	middlewares   []Middleware
+	// moderationGuard is set by WithModerationGuard
+	moderationGuard bool
 }
 
-// NewClient returns a new OpenAI GPT-3 API client. An apiKey is required to use the client
+// NewClient returns a new OpenAI GPT-3 API client. An apiKey is required to use the client.
+// Invalid options are ignored; use NewClientWithOptions to have them reported.
 func NewClient(apiKey string, options ...ClientOption) Client {
-	httpClient := &http.Client{
-		Timeout: time.Duration(defaultTimeoutSeconds * time.Second),
+	c, _ := newClient(apiKey, options)
+	return c
+}
+
+// NewClientWithOptions returns a new OpenAI GPT-3 API client like NewClient, but validates the
+// apiKey and every option first. The apiKey may only be empty if a CredentialProvider or an Azure
+// TokenProvider is configured. If anything is invalid it returns an *OptionsError listing all
+// of the failures instead of a client.
+func NewClientWithOptions(apiKey string, options ...ClientOption) (Client, error) {
+	c, errs := newClient(apiKey, options)
+	if apiKey == "" && c.credentials == nil && (c.azure == nil || c.azure.TokenProvider == nil) {
+		errs = append(errs, errors.New("an api key is required"))
+	}
+	if len(errs) > 0 {
+		return nil, &OptionsError{Errors: errs}
 	}
+	return c, nil
+}
 
+// newClient applies the options in order, collecting the errors of those that are invalid, and
+// then resolves the settings that depend on each other so the order of options doesn't matter.
+func newClient(apiKey string, options []ClientOption) (*client, []error) {
 	c := &client{
 		userAgent:     defaultUserAgent,
 		apiKey:        apiKey,
 		baseURL:       defaultBaseURL,
-		httpClient:    httpClient,
 		defaultEngine: DefaultEngine,
+		searchModel:   DefaultSearchModel,
 		idOrg:         "",
 	}
+	var errs []error
 	for _, o := range options {
-		o(c)
+		if err := o(c); err != nil {
+			errs = append(errs, err)
+		}
 	}
-	return c
-}
 
-func (c *client) Engines(ctx context.Context) (*EnginesResponse, error) {
-	req, err := c.newRequest(ctx, "GET", "/engines", nil)
-	if err != nil {
-		return nil, err
+	timeout := time.Duration(defaultTimeoutSeconds * time.Second)
+	if c.timeout != nil {
+		timeout = *c.timeout
+	}
+	switch {
+	case c.httpClient == nil:
+		c.httpClient = &http.Client{Timeout: timeout}
+	case c.timeout != nil:
+		errs = append(errs, errors.New("WithTimeout conflicts with WithHTTPClient, set the timeout on the http.Client instead"))
+		// copy the caller's http client rather than modifying one that may be shared
+		httpClient := *c.httpClient
+		httpClient.Timeout = timeout
+		c.httpClient = &httpClient
+	}
+	if c.balancer != nil {
+		switch {
+		case len(c.balancer.backends) == 0 && c.balancer.healthPath != "":
+			errs = append(errs, errors.New("WithHealthCheck requires WithBackends"))
+			c.balancer = nil
+		case len(c.balancer.backends) == 0:
+			errs = append(errs, errors.New("WithCircuitBreaker requires WithBackends"))
+			c.balancer = nil
+		case c.azure != nil:
+			errs = append(errs, errors.New("WithBackends conflicts with WithAzure"))
+		case c.baseURL != defaultBaseURL:
+			errs = append(errs, errors.New("WithBaseURL conflicts with WithBackends, set the url of each Backend instead"))
+		}
+		if c.balancer != nil {
+			c.balancer.client = c
+		}
 	}
-	resp, err := c.performRequest(req)
+	if c.azure != nil {
+		if c.baseURL != defaultBaseURL {
+			errs = append(errs, errors.New("WithBaseURL conflicts with WithAzure, set the endpoint in the AzureConfig instead"))
+		}
+		if c.moderationGuard {
+			errs = append(errs, errors.New("WithModerationGuard conflicts with WithAzure, which has no moderation API"))
+		}
+		c.baseURL = c.azure.Endpoint
+	}
+	return c, errs
+}
+
+func (c *client) Engines(ctx context.Context, opts ...RequestOption) (*EnginesResponse, error) {
+	call, err := c.newCall(ctx, OperationEngines, "GET", "/engines", opts)
 	if err != nil {
 		return nil, err
 	}
 
 	output := new(EnginesResponse)
-	if err := getResponseObject(resp, output); err != nil {
+	call.Response = output
+	if err := c.do(ctx, call); err != nil {
 		return nil, err
 	}
 	return output, nil
 }
 
-func (c *client) Engine(ctx context.Context, engine string) (*EngineObject, error) {
-	req, err := c.newRequest(ctx, "GET", fmt.Sprintf("/engines/%s", engine), nil)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.performRequest(req)
+func (c *client) Engine(ctx context.Context, engine string, opts ...RequestOption) (*EngineObject, error) {
+	call, err := c.newCall(ctx, OperationEngine, "GET", fmt.Sprintf("/engines/%s", engine), opts)
 	if err != nil {
 		return nil, err
 	}
 
 	output := new(EngineObject)
-	if err := getResponseObject(resp, output); err != nil {
+	call.Response, call.engine = output, engine
+	if err := c.do(ctx, call); err != nil {
 		return nil, err
 	}
 	return output, nil
 }
 
-func (c *client) ChatCompletion(ctx context.Context, request ChatCompletionRequest) (*ChatCompletionResponse, error) {
+func (c *client) ChatCompletion(ctx context.Context, request ChatCompletionRequest, opts ...RequestOption) (*ChatCompletionResponse, error) {
 	if request.Model == "" {
 		if request.Functions == nil {
 			request.Model = GPT3Dot5Turbo
@@ -190,102 +278,73 @@ func (c *client) ChatCompletion(ctx context.Context, request ChatCompletionReque
 
 	request.Stream = false
 
-	req, err := c.newRequest(ctx, "POST", "/chat/completions", request)
-	if err != nil {
-		return nil, err
-	}
-
-	resp, err := c.performRequest(req)
+	call, err := c.newCall(ctx, OperationChatCompletion, "POST", "/chat/completions", opts)
 	if err != nil {
 		return nil, err
 	}
 
 	output := new(ChatCompletionResponse)
-	if err := getResponseObject(resp, output); err != nil {
+	call.Request, call.Response = &request, output
+	if err := c.do(ctx, call); err != nil {
 		return nil, err
 	}
-	output.RateLimitHeaders = NewRateLimitHeadersFromResponse(resp)
+	if call.HTTPResponse != nil {
+		output.RateLimitHeaders = NewRateLimitHeadersFromResponse(call.HTTPResponse)
+	}
 	return output, nil
 }
 
 func (c *client) ChatCompletionStream(
 	ctx context.Context,
 	request ChatCompletionRequest,
-	onData func(*ChatCompletionStreamResponse) error) error {
+	onData func(*ChatCompletionStreamResponse) error,
+	opts ...RequestOption,
+) error {
 	if request.Model == "" {
 		request.Model = GPT3Dot5Turbo
 	}
 	request.Stream = true
 
-	req, err := c.newRequest(ctx, "POST", "/chat/completions", request)
+	call, err := c.newCall(ctx, OperationChatCompletionStream, "POST", "/chat/completions", opts)
 	if err != nil {
 		return err
 	}
 
-	resp, err := c.performRequest(req)
-	if err != nil {
-		return err
+	call.Request = &request
+	call.OnStreamData = func(chunk interface{}) error {
+		return onData(chunk.(*ChatCompletionStreamResponse))
 	}
-
-	reader := bufio.NewReader(resp.Body)
-	defer resp.Body.Close()
-
-	for {
-		line, err := reader.ReadBytes('\n')
-		if err != nil {
-			return err
-		}
-
-		// make sure there isn't any extra whitespace before or after
-		line = bytes.TrimSpace(line)
-		// the completion API only returns data events
-		if !bytes.HasPrefix(line, dataPrefix) {
-			continue
-		}
-		line = bytes.TrimPrefix(line, dataPrefix)
-
-		// the stream is completed when terminated by [DONE]
-		if bytes.HasPrefix(line, doneSequence) {
-			break
-		}
-		output := new(ChatCompletionStreamResponse)
-		if err := json.Unmarshal(line, output); err != nil {
-			return fmt.Errorf("invalid json stream data: %v", err)
-		}
-		if err := onData(output); err != nil {
-			return fmt.Errorf("callback returned an error: %v", err)
-		}
+	call.newStreamChunk = func() interface{} {
+		return new(ChatCompletionStreamResponse)
 	}
-
-	return nil
+	return c.do(ctx, call)
 }
 
-func (c *client) Completion(ctx context.Context, request CompletionRequest) (*CompletionResponse, error) {
-	return c.CompletionWithEngine(ctx, c.defaultEngine, request)
+func (c *client) Completion(ctx context.Context, request CompletionRequest, opts ...RequestOption) (*CompletionResponse, error) {
+	return c.CompletionWithEngine(ctx, c.defaultEngine, request, opts...)
 }
 
-func (c *client) CompletionWithEngine(ctx context.Context, engine string, request CompletionRequest) (*CompletionResponse, error) {
+func (c *client) CompletionWithEngine(ctx context.Context, engine string, request CompletionRequest, opts ...RequestOption) (*CompletionResponse, error) {
 	request.Stream = false
-	req, err := c.newRequest(ctx, "POST", fmt.Sprintf("/engines/%s/completions", engine), request)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.performRequest(req)
+	call, err := c.newCall(ctx, OperationCompletion, "POST", fmt.Sprintf("/engines/%s/completions", engine), opts)
 	if err != nil {
 		return nil, err
 	}
 
 	output := new(CompletionResponse)
-	if err := getResponseObject(resp, output); err != nil {
+	call.Request, call.Response, call.engine = &request, output, engine
+	if err := c.do(ctx, call); err != nil {
 		return nil, err
 	}
-	output.RateLimitHeaders = NewRateLimitHeadersFromResponse(resp)
+	if call.HTTPResponse != nil {
+		output.RateLimitHeaders = NewRateLimitHeadersFromResponse(call.HTTPResponse)
+	}
 
 	return output, nil
 }
 
-func (c *client) CompletionStream(ctx context.Context, request CompletionRequest, onData func(*CompletionResponse)) error {
-	return c.CompletionStreamWithEngine(ctx, c.defaultEngine, request, onData)
+func (c *client) CompletionStream(ctx context.Context, request CompletionRequest, onData func(*CompletionResponse), opts ...RequestOption) error {
+	return c.CompletionStreamWithEngine(ctx, c.defaultEngine, request, onData, opts...)
 }
 
 var (
@@ -298,129 +357,206 @@ func (c *client) CompletionStreamWithEngine(
 	engine string,
 	request CompletionRequest,
 	onData func(*CompletionResponse),
+	opts ...RequestOption,
 ) error {
 	request.Stream = true
-	req, err := c.newRequest(ctx, "POST", fmt.Sprintf("/engines/%s/completions", engine), request)
+	call, err := c.newCall(ctx, OperationCompletionStream, "POST", fmt.Sprintf("/engines/%s/completions", engine), opts)
 	if err != nil {
 		return err
 	}
-	resp, err := c.performRequest(req)
-	if err != nil {
-		return err
-	}
-
-	reader := bufio.NewReader(resp.Body)
-	defer resp.Body.Close()
 
-	for {
-		line, err := reader.ReadBytes('\n')
-		if err != nil {
-			return err
-		}
-		// make sure there isn't any extra whitespace before or after
-		line = bytes.TrimSpace(line)
-		// the completion API only returns data events
-		if !bytes.HasPrefix(line, dataPrefix) {
-			continue
-		}
-		line = bytes.TrimPrefix(line, dataPrefix)
-
-		// the stream is completed when terminated by [DONE]
-		if bytes.HasPrefix(line, doneSequence) {
-			break
-		}
-		output := new(CompletionResponse)
-		if err := json.Unmarshal(line, output); err != nil {
-			return fmt.Errorf("invalid json stream data: %v", err)
-		}
-		onData(output)
+	call.Request, call.engine = &request, engine
+	call.OnStreamData = func(chunk interface{}) error {
+		onData(chunk.(*CompletionResponse))
+		return nil
 	}
-
-	return nil
+	call.newStreamChunk = func() interface{} {
+		return new(CompletionResponse)
+	}
+	return c.do(ctx, call)
 }
 
-func (c *client) Edits(ctx context.Context, request EditsRequest) (*EditsResponse, error) {
-	req, err := c.newRequest(ctx, "POST", "/edits", request)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.performRequest(req)
+func (c *client) Edits(ctx context.Context, request EditsRequest, opts ...RequestOption) (*EditsResponse, error) {
+	call, err := c.newCall(ctx, OperationEdits, "POST", "/edits", opts)
 	if err != nil {
 		return nil, err
 	}
 
 	output := new(EditsResponse)
-	if err := getResponseObject(resp, output); err != nil {
+	call.Request, call.Response = &request, output
+	if err := c.do(ctx, call); err != nil {
 		return nil, err
 	}
 	return output, nil
 }
 
-func (c *client) Search(ctx context.Context, request SearchRequest) (*SearchResponse, error) {
-	return c.SearchWithEngine(ctx, c.defaultEngine, request)
+func (c *client) Search(ctx context.Context, request SearchRequest, opts ...RequestOption) (*SearchResponse, error) {
+	return c.search(ctx, c.searchModel, request, opts)
 }
 
-func (c *client) SearchWithEngine(ctx context.Context, engine string, request SearchRequest) (*SearchResponse, error) {
-	req, err := c.newRequest(ctx, "POST", fmt.Sprintf("/engines/%s/search", engine), request)
-	if err != nil {
-		return nil, err
+func (c *client) SearchWithEngine(ctx context.Context, engine string, request SearchRequest, opts ...RequestOption) (*SearchResponse, error) {
+	model := c.searchModel
+	if isEmbeddingModel(engine) {
+		model = engine
 	}
-	resp, err := c.performRequest(req)
-	if err != nil {
-		return nil, err
-	}
-	output := new(SearchResponse)
-	if err := getResponseObject(resp, output); err != nil {
-		return nil, err
-	}
-	return output, nil
+	return c.search(ctx, model, request, opts)
 }
 
 // Embeddings creates text embeddings for a supplied slice of inputs with a provided model.
+// Unless another encoding format is requested, the embeddings are transferred base64 encoded,
+// which is smaller and faster to decode, and are decoded into the []float32 of each result.
 //
 // See: https://beta.openai.com/docs/api-reference/embeddings
-func (c *client) Embeddings(ctx context.Context, request EmbeddingsRequest) (*EmbeddingsResponse, error) {
-	req, err := c.newRequest(ctx, "POST", "/embeddings", request)
-	if err != nil {
-		return nil, err
+func (c *client) Embeddings(ctx context.Context, request EmbeddingsRequest, opts ...RequestOption) (*EmbeddingsResponse, error) {
+	if request.EncodingFormat == "" {
+		request.EncodingFormat = EmbeddingEncodingBase64
 	}
-	resp, err := c.performRequest(req)
+	call, err := c.newCall(ctx, OperationEmbeddings, "POST", "/embeddings", opts)
 	if err != nil {
 		return nil, err
 	}
 
 	output := EmbeddingsResponse{}
-	if err := getResponseObject(resp, &output); err != nil {
+	call.Request, call.Response = &request, &output
+	if err := c.do(ctx, call); err != nil {
 		return nil, err
 	}
 	return &output, nil
 }
 
-// Moderation performs a moderation check on the given text against an OpenAI classifier.
+// Moderation performs a moderation check on the given text, texts or images against an OpenAI classifier.
 //
 // See: https://platform.openai.com/docs/api-reference/moderations/create
-func (c *client) Moderation(ctx context.Context, request ModerationRequest) (*ModerationResponse, error) {
-	req, err := c.newRequest(ctx, "POST", "/moderations", request)
-	if err != nil {
-		return nil, err
-	}
-	resp, err := c.performRequest(req)
+func (c *client) Moderation(ctx context.Context, request ModerationRequest, opts ...RequestOption) (*ModerationResponse, error) {
+	call, err := c.newCall(ctx, OperationModeration, "POST", "/moderations", opts)
 	if err != nil {
 		return nil, err
 	}
 
 	output := ModerationResponse{}
-	if err := getResponseObject(resp, &output); err != nil {
+	call.Request, call.Response = &request, &output
+	if err := c.do(ctx, call); err != nil {
 		return nil, err
 	}
 	return &output, nil
 }
 
-func (c *client) performRequest(req *http.Request) (*http.Response, error) {
-	resp, err := c.httpClient.Do(req)
+// do runs the call through the client's middlewares, ending with send.
+func (c *client) do(ctx context.Context, call *Call) error {
+	if call.options.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, call.options.timeout)
+		defer cancel()
+	}
+	if c.azure != nil {
+		if err := c.applyAzure(ctx, call); err != nil {
+			return err
+		}
+	}
+	middlewares := c.middlewares
+	if c.balancer != nil {
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], c.balancer.middleware)
+	}
+	return chainMiddleware(middlewares, c.send)(ctx, call)
+}
+
+// send is the final handler of the middleware chain. It encodes the request payload, performs the
+// request and then decodes the response, or streams it through call.OnStreamData. When a key from
+// the credential provider is rejected, the request is sent again with the next key, and failed
+// requests are retried as configured by WithMaxRetries.
+func (c *client) send(ctx context.Context, call *Call) error {
+	var resp *http.Response
+	retries := 0
+	for attempt := 1; ; attempt++ {
+		apiKey, err := c.authorize(ctx, call)
+		if err != nil {
+			return err
+		}
+		// encode the body on every attempt, as sending the request consumes it
+		if call.Request != nil {
+			if err := setJSONBody(call.HTTPRequest, call.Request, call.options.extraBody); err != nil {
+				return err
+			}
+		}
+		resp, err = c.performRequest(call.HTTPRequest.WithContext(ctx), &call.options)
+		if err == nil {
+			break
+		}
+		if c.failover(apiKey, err, attempt) {
+			continue
+		}
+		if retries >= c.maxRetries || !isRetryable(ctx, err) {
+			return err
+		}
+		retries++
+		if err := sleep(ctx, retryDelay(retries, err)); err != nil {
+			return err
+		}
+	}
+	call.HTTPResponse = resp
+
+	if call.Stream() {
+		return readStream(resp, call)
+	}
+	if call.Response == nil {
+		resp.Body.Close()
+		return nil
+	}
+	return getResponseObject(resp, call.Response)
+}
+
+// readStream reads server-sent events from the response and passes each decoded chunk to call.OnStreamData.
+func readStream(resp *http.Response, call *Call) error {
+	reader := bufio.NewReader(resp.Body)
+	defer resp.Body.Close()
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+
+		// make sure there isn't any extra whitespace before or after
+		line = bytes.TrimSpace(line)
+		// the completion API only returns data events
+		if !bytes.HasPrefix(line, dataPrefix) {
+			continue
+		}
+		line = bytes.TrimPrefix(line, dataPrefix)
+
+		// the stream is completed when terminated by [DONE]
+		if bytes.HasPrefix(line, doneSequence) {
+			break
+		}
+		output := call.newStreamChunk()
+		if err := json.Unmarshal(line, output); err != nil {
+			return fmt.Errorf("invalid json stream data: %w", err)
+		}
+		if err := call.OnStreamData(output); err != nil {
+			return fmt.Errorf("callback returned an error: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// performRequest sends req with the client's http client. A per-call timeout is enforced by the
+// context of req, and replaces the timeout of the http client so that it can extend it as well as
+// shorten it.
+func (c *client) performRequest(req *http.Request, options *requestOptions) (*http.Response, error) {
+	httpClient := c.httpClient
+	if options.timeout > 0 && httpClient.Timeout > 0 {
+		untimed := *httpClient
+		untimed.Timeout = 0
+		httpClient = &untimed
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if options.rawResponse != nil {
+		options.rawResponse.capture(resp)
+	}
 	if err := checkForSuccess(resp); err != nil {
 		return nil, err
 	}
@@ -458,34 +594,87 @@ func getResponseObject(rsp *http.Response, v interface{}) error {
 	if err := json.NewDecoder(rsp.Body).Decode(v); err != nil {
 		return fmt.Errorf("invalid json response: %w", err)
 	}
+	// read any trailing whitespace so the whole body is consumed
+	_, _ = io.Copy(ioutil.Discard, rsp.Body)
 	return nil
 }
 
-func jsonBodyReader(body interface{}) (io.Reader, error) {
-	if body == nil {
-		return bytes.NewBuffer(nil), nil
-	}
-	raw, err := json.Marshal(body)
+// setJSONBody encodes the payload as the request body, with any extra fields merged in.
+func setJSONBody(req *http.Request, payload interface{}, extra map[string]interface{}) error {
+	raw, err := json.Marshal(payload)
 	if err != nil {
-		return nil, fmt.Errorf("failed encoding json: %w", err)
+		return fmt.Errorf("failed encoding json: %w", err)
 	}
-	return bytes.NewBuffer(raw), nil
+	if len(extra) > 0 {
+		fields := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return fmt.Errorf("failed merging extra body fields: %w", err)
+		}
+		for key, value := range extra {
+			fields[key] = value
+		}
+		if raw, err = json.Marshal(fields); err != nil {
+			return fmt.Errorf("failed encoding json: %w", err)
+		}
+	}
+	req.ContentLength = int64(len(raw))
+	req.Body = ioutil.NopCloser(bytes.NewReader(raw))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(raw)), nil
+	}
+	return nil
 }
 
-func (c *client) newRequest(ctx context.Context, method, path string, payload interface{}) (*http.Request, error) {
-	bodyReader, err := jsonBodyReader(payload)
+// newCall creates a Call for an API operation, with its HTTP request built from the client's
+// configuration and the request options.
+func (c *client) newCall(ctx context.Context, operation, method, path string, opts []RequestOption) (*Call, error) {
+	options := requestOptions{}
+	for _, o := range opts {
+		if err := o(&options); err != nil {
+			return nil, err
+		}
+	}
+	req, err := c.newRequest(ctx, method, path, &options)
 	if err != nil {
 		return nil, err
 	}
-	url := c.baseURL + path
-	req, err := http.NewRequestWithContext(ctx, method, url, bodyReader)
+	return &Call{Operation: operation, HTTPRequest: req, options: options, path: path}, nil
+}
+
+func (c *client) newRequest(ctx context.Context, method, path string, options *requestOptions) (*http.Request, error) {
+	baseURL, apiKey := c.baseURL, c.apiKey
+	if options.baseURL != "" {
+		baseURL = options.baseURL
+	}
+	if options.apiKey != "" {
+		apiKey = options.apiKey
+	}
+	url := baseURL + path
+	if len(options.query) > 0 {
+		url += "?" + options.query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, err
 	}
-	if len(c.idOrg) > 0 {
-		req.Header.Set("OpenAI-Organization", c.idOrg)
+	org, project := c.idOrg, c.project
+	if options.org != "" {
+		org = options.org
+	}
+	if options.project != "" {
+		project = options.project
+	}
+	if len(org) > 0 {
+		req.Header.Set("OpenAI-Organization", org)
 	}
+	if len(project) > 0 {
+		req.Header.Set("OpenAI-Project", project)
+	}
+	req.Header.Set("User-Agent", strings.Join(append([]string{c.userAgent}, c.appInfo...), " "))
 	req.Header.Set("Content-type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", c.apiKey))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	for key, values := range options.header {
+		req.Header[key] = values
+	}
 	return req, nil
 }
@@ -110,16 +110,16 @@ func TestRequestCreationFails(t *testing.T) {
 		{
 			"Search",
 			func() (interface{}, error) {
-				return client.Search(ctx, gpt3.SearchRequest{})
+				return client.Search(ctx, gpt3.SearchRequest{Documents: []string{"document"}, Query: "query"})
 			},
-			"Post \"https://api.openai.com/v1/engines/davinci/search\": request error",
+			"Post \"https://api.openai.com/v1/embeddings\": request error",
 		},
 		{
 			"SearchWithEngine",
 			func() (interface{}, error) {
-				return client.SearchWithEngine(ctx, gpt3.AdaEngine, gpt3.SearchRequest{})
+				return client.SearchWithEngine(ctx, gpt3.AdaEngine, gpt3.SearchRequest{Documents: []string{"document"}, Query: "query"})
 			},
-			"Post \"https://api.openai.com/v1/engines/ada/search\": request error",
+			"Post \"https://api.openai.com/v1/embeddings\": request error",
 		},
 		{
 			"Embeddings",
@@ -301,32 +301,16 @@ func TestResponses(t *testing.T) {
 		{
 			"Search",
 			func() (interface{}, error) {
-				return client.Search(ctx, gpt3.SearchRequest{})
-			},
-			&gpt3.SearchResponse{
-				Data: []gpt3.SearchData{
-					{
-						Document: 1,
-						Object:   "search_result",
-						Score:    40.312,
-					},
-				},
+				return client.Search(ctx, gpt3.SearchRequest{Documents: []string{"document"}, Query: "query"})
 			},
+			nil, // searches embed their inputs and are tested separately
 		},
 		{
 			"SearchWithEngine",
 			func() (interface{}, error) {
-				return client.SearchWithEngine(ctx, gpt3.AdaEngine, gpt3.SearchRequest{})
-			},
-			&gpt3.SearchResponse{
-				Data: []gpt3.SearchData{
-					{
-						Document: 1,
-						Object:   "search_result",
-						Score:    40.312,
-					},
-				},
+				return client.SearchWithEngine(ctx, gpt3.AdaEngine, gpt3.SearchRequest{Documents: []string{"document"}, Query: "query"})
 			},
+			nil, // searches embed their inputs and are tested separately
 		},
 		{
 			"Embeddings",
@@ -337,7 +321,7 @@ func TestResponses(t *testing.T) {
 				Object: "list",
 				Data: []gpt3.EmbeddingsResult{{
 					Object:    "object",
-					Embedding: []float64{0.1, 0.2, 0.3},
+					Embedding: []float32{0.1, 0.2, 0.3},
 					Index:     0,
 				}},
 				Usage: gpt3.EmbeddingsUsage{
@@ -463,6 +447,42 @@ func TestResponses(t *testing.T) {
 	}
 }
 
+func TestCompletionRequestJSON(t *testing.T) {
+	// unset options are left out, and set zero values that matter are kept
+	data, err := json.Marshal(gpt3.CompletionRequest{Prompt: []string{"a"}})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"prompt": ["a"]}`, string(data))
+
+	data, err = json.Marshal(gpt3.CompletionRequest{
+		PromptTokens: [][]int{{1, 2}, {3}},
+		Suffix:       "end",
+		N:            gpt3.IntPtr(2),
+		BestOf:       gpt3.IntPtr(3),
+		LogProbs:     gpt3.IntPtr(0),
+		LogitBias:    map[string]float32{"50256": -100},
+		User:         "user-1",
+		Seed:         gpt3.IntPtr(0),
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"prompt": [[1, 2], [3]], "suffix": "end", "n": 2, "best_of": 3, "logprobs": 0,
+		"logit_bias": {"50256": -100}, "user": "user-1", "seed": 0}`, string(data))
+
+	for prompt, expected := range map[string]gpt3.CompletionRequest{
+		`"a"`:           {Prompt: []string{"a"}},
+		`["a", "b"]`:    {Prompt: []string{"a", "b"}},
+		`[1, 2]`:        {PromptTokens: [][]int{{1, 2}}},
+		`[[1, 2], [3]]`: {PromptTokens: [][]int{{1, 2}, {3}}},
+	} {
+		var request gpt3.CompletionRequest
+		assert.NoError(t, json.Unmarshal([]byte(`{"prompt": `+prompt+`, "seed": 7}`), &request))
+		expected.Seed = gpt3.IntPtr(7)
+		assert.Equal(t, expected, request, prompt)
+	}
+
+	var request gpt3.CompletionRequest
+	assert.EqualError(t, json.Unmarshal([]byte(`{"prompt": {}}`), &request), "invalid completion prompt: {}")
+}
+
 func TestRateLimitHeaders(t *testing.T) {
 	/*
 		These values are taken directly from the documentation at https://platform.openai.com/docs/guides/rate-limits/overview
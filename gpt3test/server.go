@@ -0,0 +1,709 @@
+// Package gpt3test provides an in-process fake OpenAI API server for integration tests.
+//
+// The server implements the chat, completions, embeddings, moderation, engines, models and files
+// endpoints under /v1, with real server-sent event streaming. By default it answers every request
+// with a deterministic response derived from the request. Tests can queue scripted responses,
+// inject error responses with rate limit headers and add latency:
+//
+//	server := gpt3test.NewServer()
+//	defer server.Close()
+//
+//	server.QueueChatCompletion(gpt3.ChatCompletionResponse{...})
+//	client := server.Client()
+package gpt3test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+)
+
+// DefaultEmbeddingDimensions is the length of the fake embeddings returned by default.
+const DefaultEmbeddingDimensions = 1536
+
+// Error is an error response returned by the server instead of handling a request.
+type Error struct {
+	// StatusCode is the HTTP status code of the response, e.g. http.StatusTooManyRequests.
+	StatusCode int
+	// Type and Message are returned in the API error body.
+	Type    string
+	Message string
+	// RetryAfter sets the Retry-After header when non-zero.
+	RetryAfter time.Duration
+	// Times is the number of requests that fail with this error. Defaults to 1.
+	Times int
+	// Path limits the error to requests whose path ends with Path, e.g. "/chat/completions".
+	Path string
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   []byte
+}
+
+// File is a file stored by the files endpoints.
+type File struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int    `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"`
+
+	content []byte
+}
+
+// Model is a model returned by the models endpoints.
+type Model struct {
+	ID      string `json:"id"`
+	Object  string `json:"object"`
+	Created int64  `json:"created"`
+	OwnedBy string `json:"owned_by"`
+}
+
+// Server is a fake OpenAI API server. Its methods are safe to call while requests are being served.
+type Server struct {
+	*httptest.Server
+
+	mu                  sync.Mutex
+	requests            []Request
+	errors              []*Error
+	latency             time.Duration
+	chunkDelay          time.Duration
+	rateLimits          gpt3.RateLimitHeaders
+	embeddingDimensions int
+	chatCompletions     []gpt3.ChatCompletionResponse
+	completions         []gpt3.CompletionResponse
+	moderations         []gpt3.ModerationResponse
+	models              []Model
+	files               []*File
+	nextID              int
+}
+
+// NewServer starts and returns a new Server. Callers should call Close when finished.
+func NewServer() *Server {
+	s := &Server{
+		embeddingDimensions: DefaultEmbeddingDimensions,
+		rateLimits: gpt3.RateLimitHeaders{
+			LimitRequests:     3500,
+			LimitTokens:       90000,
+			RemainingRequests: 3499,
+			RemainingTokens:   89000,
+			ResetRequests:     17 * time.Millisecond,
+			ResetTokens:       666 * time.Millisecond,
+		},
+		models: []Model{
+			{ID: gpt3.GPT3Dot5Turbo, Object: "model", OwnedBy: "openai"},
+			{ID: gpt3.TextDavinci003Engine, Object: "model", OwnedBy: "openai"},
+			{ID: gpt3.TextEmbeddingAda002, Object: "model", OwnedBy: "openai"},
+			{ID: gpt3.TextModerationLatest, Object: "model", OwnedBy: "openai"},
+		},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/chat/completions", s.handleChatCompletion)
+	mux.HandleFunc("/v1/completions", s.handleCompletion)
+	mux.HandleFunc("/v1/engines", s.handleEngines)
+	mux.HandleFunc("/v1/engines/", s.handleEngines)
+	mux.HandleFunc("/v1/embeddings", s.handleEmbeddings)
+	mux.HandleFunc("/v1/moderations", s.handleModeration)
+	mux.HandleFunc("/v1/models", s.handleModels)
+	mux.HandleFunc("/v1/models/", s.handleModels)
+	mux.HandleFunc("/v1/files", s.handleFiles)
+	mux.HandleFunc("/v1/files/", s.handleFiles)
+	s.Server = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// BaseURL returns the base URL to pass to gpt3.WithBaseURL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/v1"
+}
+
+// Client returns a client configured to use the server.
+func (s *Server) Client(options ...gpt3.ClientOption) gpt3.Client {
+	options = append([]gpt3.ClientOption{gpt3.WithBaseURL(s.BaseURL())}, options...)
+	return gpt3.NewClient("test-key", options...)
+}
+
+// Requests returns the requests received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// SetLatency delays every response by the given duration.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latency = latency
+}
+
+// SetChunkDelay delays every chunk of streamed responses by the given duration.
+func (s *Server) SetChunkDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chunkDelay = delay
+}
+
+// SetRateLimits sets the rate limit headers sent with every response.
+func (s *Server) SetRateLimits(rateLimits gpt3.RateLimitHeaders) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rateLimits = rateLimits
+}
+
+// SetEmbeddingDimensions sets the length of the fake embeddings.
+func (s *Server) SetEmbeddingDimensions(dimensions int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.embeddingDimensions = dimensions
+}
+
+// FailWith makes the next matching requests fail with the given error. Errors are matched in the
+// order they were added.
+func (s *Server) FailWith(e Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.Times <= 0 {
+		e.Times = 1
+	}
+	s.errors = append(s.errors, &e)
+}
+
+// QueueChatCompletion queues responses returned, in order, by the chat completions endpoint. Streamed
+// requests receive the queued response split into chunks.
+func (s *Server) QueueChatCompletion(responses ...gpt3.ChatCompletionResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.chatCompletions = append(s.chatCompletions, responses...)
+}
+
+// QueueCompletion queues responses returned, in order, by the completions endpoints.
+func (s *Server) QueueCompletion(responses ...gpt3.CompletionResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.completions = append(s.completions, responses...)
+}
+
+// QueueModeration queues responses returned, in order, by the moderations endpoint.
+func (s *Server) QueueModeration(responses ...gpt3.ModerationResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.moderations = append(s.moderations, responses...)
+}
+
+// middleware records requests, applies latency and injected errors and sets rate limit headers.
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		r.Body.Close()
+		r.Body = ioutil.NopCloser(strings.NewReader(string(body)))
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: body})
+		latency, rateLimits := s.latency, s.rateLimits
+		injected := s.takeError(r.URL.Path)
+		s.mu.Unlock()
+
+		if latency > 0 {
+			select {
+			case <-time.After(latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		h := w.Header()
+		h.Set("X-Request-Id", fmt.Sprintf("req_%d", time.Now().UnixNano()))
+		h.Set("X-Ratelimit-Limit-Requests", strconv.Itoa(rateLimits.LimitRequests))
+		h.Set("X-Ratelimit-Limit-Tokens", strconv.Itoa(rateLimits.LimitTokens))
+		h.Set("X-Ratelimit-Remaining-Requests", strconv.Itoa(rateLimits.RemainingRequests))
+		h.Set("X-Ratelimit-Remaining-Tokens", strconv.Itoa(rateLimits.RemainingTokens))
+		h.Set("X-Ratelimit-Reset-Requests", rateLimits.ResetRequests.String())
+		h.Set("X-Ratelimit-Reset-Tokens", rateLimits.ResetTokens.String())
+
+		if injected != nil {
+			if injected.RetryAfter > 0 {
+				h.Set("Retry-After", strconv.Itoa(int(math.Ceil(injected.RetryAfter.Seconds()))))
+			}
+			writeError(w, injected.StatusCode, injected.Type, injected.Message)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// takeError returns the first injected error matching path. s.mu must be held.
+func (s *Server) takeError(path string) *Error {
+	for i, e := range s.errors {
+		if e.Path != "" && !strings.HasSuffix(path, e.Path) {
+			continue
+		}
+		injected := *e
+		e.Times--
+		if e.Times == 0 {
+			s.errors = append(s.errors[:i], s.errors[i+1:]...)
+		}
+		return &injected
+	}
+	return nil
+}
+
+func (s *Server) handleChatCompletion(w http.ResponseWriter, r *http.Request) {
+	var request gpt3.ChatCompletionRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	var response gpt3.ChatCompletionResponse
+	if len(s.chatCompletions) > 0 {
+		response, s.chatCompletions = s.chatCompletions[0], s.chatCompletions[1:]
+	} else {
+		response = s.defaultChatCompletion(request)
+	}
+	chunkDelay := s.chunkDelay
+	s.mu.Unlock()
+
+	if !request.Stream {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	var chunks []interface{}
+	for _, choice := range response.Choices {
+		for i, part := range splitWords(choice.Message.Content) {
+			delta := gpt3.ChatCompletionResponseMessage{Content: part}
+			if i == 0 {
+				delta.Role = choice.Message.Role
+			}
+			chunks = append(chunks, gpt3.ChatCompletionStreamResponse{
+				ID: response.ID, Object: "chat.completion.chunk", Created: response.Created, Model: response.Model,
+				Choices: []gpt3.ChatCompletionStreamResponseChoice{{Index: choice.Index, Delta: delta}},
+			})
+		}
+		chunks = append(chunks, gpt3.ChatCompletionStreamResponse{
+			ID: response.ID, Object: "chat.completion.chunk", Created: response.Created, Model: response.Model,
+			Choices: []gpt3.ChatCompletionStreamResponseChoice{{
+				Index: choice.Index, FinishReason: choice.FinishReason, Delta: gpt3.ChatCompletionResponseMessage{FunctionCall: choice.Message.FunctionCall},
+			}},
+		})
+	}
+	writeStream(w, r, chunks, chunkDelay)
+}
+
+func (s *Server) handleCompletion(w http.ResponseWriter, r *http.Request) {
+	s.serveCompletion(w, r, "")
+}
+
+func (s *Server) handleEngines(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/engines"), "/"), "/")
+	switch {
+	case parts[0] == "":
+		s.mu.Lock()
+		engines := gpt3.EnginesResponse{Object: "list"}
+		for _, m := range s.models {
+			engines.Data = append(engines.Data, gpt3.EngineObject{ID: m.ID, Object: "engine", Owner: m.OwnedBy, Ready: true})
+		}
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, engines)
+	case len(parts) == 1:
+		writeJSON(w, http.StatusOK, gpt3.EngineObject{ID: parts[0], Object: "engine", Owner: "openai", Ready: true})
+	case len(parts) == 2 && parts[1] == "completions":
+		s.serveCompletion(w, r, parts[0])
+	default:
+		writeError(w, http.StatusNotFound, "invalid_request_error", "unknown url "+r.URL.Path)
+	}
+}
+
+func (s *Server) serveCompletion(w http.ResponseWriter, r *http.Request, engine string) {
+	// the model is decoded separately, as the request's own UnmarshalJSON would skip it
+	var body json.RawMessage
+	if !decodeRequest(w, r, &body) {
+		return
+	}
+	var request gpt3.CompletionRequest
+	var model struct {
+		Model string `json:"model"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid json body: %v", err))
+		return
+	}
+	json.Unmarshal(body, &model)
+	if engine == "" {
+		engine = model.Model
+	}
+
+	s.mu.Lock()
+	var response gpt3.CompletionResponse
+	if len(s.completions) > 0 {
+		response, s.completions = s.completions[0], s.completions[1:]
+	} else {
+		response = s.defaultCompletion(engine, request)
+	}
+	chunkDelay := s.chunkDelay
+	s.mu.Unlock()
+
+	if !request.Stream {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+
+	var chunks []interface{}
+	for _, choice := range response.Choices {
+		parts := splitWords(choice.Text)
+		for i, part := range parts {
+			chunk := gpt3.CompletionResponseChoice{Index: choice.Index, Text: part}
+			if i == len(parts)-1 {
+				chunk.FinishReason = choice.FinishReason
+			}
+			chunks = append(chunks, gpt3.CompletionResponse{
+				ID: response.ID, Object: "text_completion", Created: response.Created, Model: response.Model,
+				Choices: []gpt3.CompletionResponseChoice{chunk},
+			})
+		}
+	}
+	writeStream(w, r, chunks, chunkDelay)
+}
+
+func (s *Server) handleEmbeddings(w http.ResponseWriter, r *http.Request) {
+	var request gpt3.EmbeddingsRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	inputs, tokenCounts := request.Input, []int{}
+	for _, input := range request.Input {
+		tokenCounts = append(tokenCounts, countTokens(input))
+	}
+	for _, tokens := range request.InputTokens {
+		inputs = append(inputs, fmt.Sprint(tokens))
+		tokenCounts = append(tokenCounts, len(tokens))
+	}
+
+	s.mu.Lock()
+	dimensions := s.embeddingDimensions
+	s.mu.Unlock()
+	if request.Dimensions > 0 {
+		dimensions = request.Dimensions
+	}
+
+	// the results are written by hand, as the embedding is a string in the base64 encoding
+	type result struct {
+		Object    string      `json:"object"`
+		Embedding interface{} `json:"embedding"`
+		Index     int         `json:"index"`
+	}
+	var response struct {
+		Object string               `json:"object"`
+		Data   []result             `json:"data"`
+		Usage  gpt3.EmbeddingsUsage `json:"usage"`
+	}
+	response.Object = "list"
+	for i, input := range inputs {
+		var embedding interface{} = FakeEmbedding(input, dimensions)
+		if request.EncodingFormat == gpt3.EmbeddingEncodingBase64 {
+			embedding = encodeEmbedding(FakeEmbedding(input, dimensions))
+		}
+		response.Data = append(response.Data, result{Object: "embedding", Embedding: embedding, Index: i})
+		response.Usage.PromptTokens += tokenCounts[i]
+	}
+	response.Usage.TotalTokens = response.Usage.PromptTokens
+	writeJSON(w, http.StatusOK, response)
+}
+
+// encodeEmbedding encodes an embedding the way the API does for the base64 encoding format.
+func encodeEmbedding(embedding []float32) string {
+	data := make([]byte, 4*len(embedding))
+	for i, value := range embedding {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(value))
+	}
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func (s *Server) handleModeration(w http.ResponseWriter, r *http.Request) {
+	var request gpt3.ModerationRequest
+	if !decodeRequest(w, r, &request) {
+		return
+	}
+
+	s.mu.Lock()
+	var response gpt3.ModerationResponse
+	if len(s.moderations) > 0 {
+		response, s.moderations = s.moderations[0], s.moderations[1:]
+	} else {
+		model := request.Model
+		if model == "" {
+			model = gpt3.TextModerationLatest
+		}
+		// a result for each text, or a single one for a multi-modal input
+		results := 1
+		if request.MultiModalInput == nil && request.Inputs != nil {
+			results = len(request.Inputs)
+		}
+		response = gpt3.ModerationResponse{ID: s.newID("modr"), Model: model, Results: make([]gpt3.ModerationResult, results)}
+	}
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/models"), "/")
+	if id == "" {
+		writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": s.models})
+		return
+	}
+	for _, m := range s.models {
+		if m.ID == id {
+			writeJSON(w, http.StatusOK, m)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("The model '%s' does not exist", id))
+}
+
+func (s *Server) handleFiles(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/files"), "/"), "/")
+
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		s.mu.Lock()
+		files := append([]*File(nil), s.files...)
+		s.mu.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"object": "list", "data": files})
+	case parts[0] == "" && r.Method == http.MethodPost:
+		s.uploadFile(w, r)
+	default:
+		s.mu.Lock()
+		var file *File
+		index := -1
+		for i, f := range s.files {
+			if f.ID == parts[0] {
+				file, index = f, i
+			}
+		}
+		if file != nil && r.Method == http.MethodDelete {
+			s.files = append(s.files[:index], s.files[index+1:]...)
+		}
+		s.mu.Unlock()
+
+		switch {
+		case file == nil:
+			writeError(w, http.StatusNotFound, "invalid_request_error", fmt.Sprintf("No such File object: %s", parts[0]))
+		case r.Method == http.MethodDelete:
+			writeJSON(w, http.StatusOK, map[string]interface{}{"id": file.ID, "object": "file", "deleted": true})
+		case len(parts) == 2 && parts[1] == "content":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(file.content)
+		default:
+			writeJSON(w, http.StatusOK, file)
+		}
+	}
+}
+
+func (s *Server) uploadFile(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+	upload, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "missing file")
+		return
+	}
+	defer upload.Close()
+	content, err := ioutil.ReadAll(upload)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	file := &File{
+		ID:        s.newID("file"),
+		Object:    "file",
+		Bytes:     len(content),
+		CreatedAt: time.Now().Unix(),
+		Filename:  header.Filename,
+		Purpose:   r.FormValue("purpose"),
+		content:   content,
+	}
+	s.files = append(s.files, file)
+	s.mu.Unlock()
+	writeJSON(w, http.StatusOK, file)
+}
+
+// defaultChatCompletion answers the last message of the request. s.mu must be held.
+func (s *Server) defaultChatCompletion(request gpt3.ChatCompletionRequest) gpt3.ChatCompletionResponse {
+	var prompt string
+	promptTokens := 0
+	for _, m := range request.Messages {
+		prompt = m.Content
+		promptTokens += countTokens(m.Content)
+	}
+	content := "This is a fake response to: " + prompt
+	return gpt3.ChatCompletionResponse{
+		ID:      s.newID("chatcmpl"),
+		Object:  "chat.completion",
+		Created: int(time.Now().Unix()),
+		Model:   request.Model,
+		Choices: []gpt3.ChatCompletionResponseChoice{{
+			FinishReason: "stop",
+			Message:      gpt3.ChatCompletionResponseMessage{Role: "assistant", Content: content},
+		}},
+		Usage: gpt3.ChatCompletionsResponseUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: countTokens(content),
+			TotalTokens:      promptTokens + countTokens(content),
+		},
+	}
+}
+
+// defaultCompletion answers every prompt of the request. s.mu must be held.
+func (s *Server) defaultCompletion(engine string, request gpt3.CompletionRequest) gpt3.CompletionResponse {
+	response := gpt3.CompletionResponse{
+		ID:      s.newID("cmpl"),
+		Object:  "text_completion",
+		Created: int(time.Now().Unix()),
+		Model:   engine,
+	}
+	for i, prompt := range request.Prompt {
+		text := " fake completion of: " + prompt
+		response.Choices = append(response.Choices, gpt3.CompletionResponseChoice{Index: i, Text: text, FinishReason: "stop"})
+		response.Usage.PromptTokens += countTokens(prompt)
+		response.Usage.CompletionTokens += countTokens(text)
+	}
+	for i, tokens := range request.PromptTokens {
+		text := " fake completion of: " + fmt.Sprint(tokens)
+		response.Choices = append(response.Choices, gpt3.CompletionResponseChoice{Index: i, Text: text, FinishReason: "stop"})
+		response.Usage.PromptTokens += len(tokens)
+		response.Usage.CompletionTokens += countTokens(text)
+	}
+	response.Usage.TotalTokens = response.Usage.PromptTokens + response.Usage.CompletionTokens
+	return response
+}
+
+// newID returns a new unique object ID. s.mu must be held.
+func (s *Server) newID(prefix string) string {
+	s.nextID++
+	return fmt.Sprintf("%s-%d", prefix, s.nextID)
+}
+
+// FakeEmbedding returns the deterministic unit-length embedding the server returns for text.
+func FakeEmbedding(text string, dimensions int) []float32 {
+	values := make([]float64, dimensions)
+	var norm float64
+	for i := range values {
+		var seed [8]byte
+		binary.LittleEndian.PutUint64(seed[:], uint64(i/4))
+		sum := sha256.Sum256(append(seed[:], text...))
+		value := binary.LittleEndian.Uint64(sum[(i%4)*8:])
+		values[i] = float64(value)/float64(math.MaxUint64)*2 - 1
+		norm += values[i] * values[i]
+	}
+	norm = math.Sqrt(norm)
+	embedding := make([]float32, dimensions)
+	for i := range values {
+		embedding[i] = float32(values[i] / norm)
+	}
+	return embedding
+}
+
+// countTokens approximates the number of tokens in text by counting words.
+func countTokens(text string) int {
+	return len(strings.Fields(text))
+}
+
+// splitWords splits text into words, keeping the whitespace before each word.
+func splitWords(text string) []string {
+	var parts []string
+	start := 0
+	for i := 1; i < len(text); i++ {
+		if text[i] == ' ' && text[i-1] != ' ' {
+			parts = append(parts, text[start:i])
+			start = i
+		}
+	}
+	if start < len(text) {
+		parts = append(parts, text[start:])
+	}
+	return parts
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "invalid_request_error", "method not allowed")
+		return false
+	}
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("invalid json body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, errorType, message string) {
+	if errorType == "" {
+		errorType = "server_error"
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	writeJSON(w, status, map[string]interface{}{
+		"error": map[string]string{"type": errorType, "message": message},
+	})
+}
+
+// writeStream writes the chunks as server-sent events, flushing after each one.
+func writeStream(w http.ResponseWriter, r *http.Request, chunks []interface{}, delay time.Duration) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	for _, chunk := range chunks {
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		data, _ := json.Marshal(chunk)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,199 @@
+package gpt3test_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/PullRequestInc/go-gpt3/gpt3test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultResponses(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	client := server.Client()
+	ctx := context.Background()
+
+	chat, err := client.ChatCompletion(ctx, gpt3.ChatCompletionRequest{
+		Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "hello there"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "This is a fake response to: hello there", chat.Choices[0].Message.Content)
+	assert.Equal(t, 2, chat.Usage.PromptTokens)
+	assert.Equal(t, 3499, chat.RateLimitHeaders.RemainingRequests)
+
+	completion, err := client.CompletionWithEngine(ctx, gpt3.AdaEngine, gpt3.CompletionRequest{Prompt: []string{"1, 2,"}})
+	assert.NoError(t, err)
+	assert.Equal(t, gpt3.AdaEngine, completion.Model)
+	assert.Equal(t, " fake completion of: 1, 2,", completion.Choices[0].Text)
+
+	embeddings, err := client.Embeddings(ctx, gpt3.EmbeddingsRequest{Input: []string{"a", "b"}, Model: gpt3.TextEmbeddingAda002})
+	assert.NoError(t, err)
+	assert.Len(t, embeddings.Data, 2)
+	assert.Equal(t, gpt3test.FakeEmbedding("b", gpt3test.DefaultEmbeddingDimensions), embeddings.Data[1].Embedding)
+	assert.NotEqual(t, embeddings.Data[0].Embedding, embeddings.Data[1].Embedding)
+
+	moderation, err := client.Moderation(ctx, gpt3.ModerationRequest{Input: "hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, gpt3.TextModerationLatest, moderation.Model)
+	assert.False(t, moderation.Results[0].Flagged)
+	moderation, err = client.Moderation(ctx, gpt3.ModerationRequest{Inputs: []string{"a", "b", "c"}})
+	assert.NoError(t, err)
+	assert.Len(t, moderation.Results, 3)
+
+	engines, err := client.Engines(ctx)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, engines.Data)
+
+	assert.Len(t, server.Requests(), 6)
+	assert.Equal(t, "/v1/chat/completions", server.Requests()[0].Path)
+}
+
+func TestScriptedStreams(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.SetChunkDelay(time.Millisecond)
+	server.QueueChatCompletion(gpt3.ChatCompletionResponse{
+		ID: "chatcmpl-1",
+		Choices: []gpt3.ChatCompletionResponseChoice{{
+			FinishReason: "stop",
+			Message:      gpt3.ChatCompletionResponseMessage{Role: "assistant", Content: "Roses are red"},
+		}},
+	})
+
+	var deltas []string
+	var finishReason string
+	err := server.Client().ChatCompletionStream(context.Background(), gpt3.ChatCompletionRequest{},
+		func(rsp *gpt3.ChatCompletionStreamResponse) error {
+			assert.Equal(t, "chatcmpl-1", rsp.ID)
+			if rsp.Choices[0].FinishReason != "" {
+				finishReason = rsp.Choices[0].FinishReason
+			} else {
+				deltas = append(deltas, rsp.Choices[0].Delta.Content)
+			}
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Roses", " are", " red"}, deltas)
+	assert.Equal(t, "stop", finishReason)
+
+	var text string
+	err = server.Client().CompletionStream(context.Background(), gpt3.CompletionRequest{Prompt: []string{"x"}},
+		func(rsp *gpt3.CompletionResponse) {
+			text += rsp.Choices[0].Text
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, " fake completion of: x", text)
+}
+
+func TestInjectedErrors(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.FailWith(gpt3test.Error{
+		StatusCode: http.StatusTooManyRequests,
+		Type:       "rate_limit_exceeded",
+		Message:    "slow down",
+		RetryAfter: 2 * time.Second,
+		Path:       "/embeddings",
+		Times:      2,
+	})
+	server.SetRateLimits(gpt3.RateLimitHeaders{LimitRequests: 60, RemainingRequests: 0})
+	client := server.Client()
+	ctx := context.Background()
+
+	_, err := client.ChatCompletion(ctx, gpt3.ChatCompletionRequest{})
+	assert.NoError(t, err, "errors only apply to matching paths")
+
+	for i := 0; i < 2; i++ {
+		_, err = client.Embeddings(ctx, gpt3.EmbeddingsRequest{Input: []string{"a"}})
+		assert.EqualError(t, err, "[429:rate_limit_exceeded] slow down")
+		assert.Equal(t, 0, err.(gpt3.APIError).RateLimitHeaders.RemainingRequests)
+		assert.Equal(t, 60, err.(gpt3.APIError).RateLimitHeaders.LimitRequests)
+	}
+
+	_, err = client.Embeddings(ctx, gpt3.EmbeddingsRequest{Input: []string{"a"}})
+	assert.NoError(t, err)
+}
+
+func TestLatency(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := server.Client().Moderation(ctx, gpt3.ModerationRequest{Input: "hi"})
+	assert.Error(t, err)
+}
+
+func TestFilesAndModels(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	assert.NoError(t, form.WriteField("purpose", "fine-tune"))
+	part, err := form.CreateFormFile("file", "data.jsonl")
+	assert.NoError(t, err)
+	part.Write([]byte(`{"prompt":"a","completion":"b"}`))
+	assert.NoError(t, form.Close())
+
+	rsp, err := http.Post(server.BaseURL()+"/files", form.FormDataContentType(), &body)
+	assert.NoError(t, err)
+	var file gpt3test.File
+	assert.NoError(t, json.NewDecoder(rsp.Body).Decode(&file))
+	assert.Equal(t, "data.jsonl", file.Filename)
+	assert.Equal(t, "fine-tune", file.Purpose)
+
+	rsp, err = http.Get(server.BaseURL() + "/files/" + file.ID + "/content")
+	assert.NoError(t, err)
+	var content bytes.Buffer
+	content.ReadFrom(rsp.Body)
+	assert.Equal(t, `{"prompt":"a","completion":"b"}`, content.String())
+
+	rsp, err = http.Get(server.BaseURL() + "/models/" + gpt3.GPT3Dot5Turbo)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, rsp.StatusCode)
+	rsp, err = http.Get(server.BaseURL() + "/models/unknown")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, rsp.StatusCode)
+}
+
+func TestEmbeddingsOptions(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	client := server.Client()
+	ctx := context.Background()
+
+	// base64 by default, and floats on request, decode to the same embedding
+	for _, format := range []string{"", gpt3.EmbeddingEncodingFloat} {
+		rsp, err := client.Embeddings(ctx, gpt3.EmbeddingsRequest{
+			InputTokens:    [][]int{{1, 2, 3}},
+			Dimensions:     256,
+			EncodingFormat: format,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, gpt3test.FakeEmbedding("[1 2 3]", 256), rsp.Data[0].Embedding)
+		assert.Equal(t, 3, rsp.Usage.PromptTokens)
+	}
+}
+
+func TestCompletionPromptTokens(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	rsp, err := client.CompletionWithEngine(context.Background(), gpt3.TextDavinci003Engine, gpt3.CompletionRequest{
+		PromptTokens: [][]int{{1, 2, 3}, {4}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, " fake completion of: [1 2 3]", rsp.Choices[0].Text)
+	assert.Equal(t, " fake completion of: [4]", rsp.Choices[1].Text)
+	assert.Equal(t, 4, rsp.Usage.PromptTokens)
+}
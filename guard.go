@@ -0,0 +1,376 @@
+package gpt3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultModerationStreamWindow is the number of bytes of streamed text a moderation guard checks
+// at a time, unless ModerationGuard.StreamWindow sets another.
+const DefaultModerationStreamWindow = 400
+
+// Stages of a chat completion at which a moderation guard blocks it, see ModerationBlockedError.
+const (
+	ModerationStageInput  = "input"
+	ModerationStageOutput = "output"
+)
+
+// ModerationGuard configures WithModerationGuard.
+type ModerationGuard struct {
+	// Model is the moderation model, e.g. OmniModerationLatest. Defaults to the API's default.
+	Model string
+
+	// Thresholds are the scores from which each category blocks text. Text is blocked in a
+	// category without a threshold if the moderation result flags it. A threshold above 1
+	// disables a category.
+	Thresholds map[string]float32
+
+	// SkipInput disables checking the user messages of requests.
+	SkipInput bool
+
+	// SkipOutput disables checking the messages of the model.
+	SkipOutput bool
+
+	// StreamWindow is the number of bytes of streamed text that is checked at a time. Streamed
+	// chunks are held back until the text they are part of has been checked. Defaults to
+	// DefaultModerationStreamWindow.
+	StreamWindow int
+
+	// Refusal, if set, is returned as the message of the model, with the finish reason
+	// "content_filter", instead of a ModerationBlockedError when a completion is blocked.
+	Refusal string
+}
+
+// ModerationBlockedError is the error of a chat completion blocked by a moderation guard.
+type ModerationBlockedError struct {
+	// Stage is ModerationStageInput if the user messages were blocked, or ModerationStageOutput if
+	// the messages of the model were.
+	Stage string
+
+	// Categories are the categories the text was blocked for, sorted.
+	Categories []string
+
+	// Result is the moderation result of the blocked text.
+	Result ModerationResult
+}
+
+func (e *ModerationBlockedError) Error() string {
+	return fmt.Sprintf("moderation blocked the %s: %s", e.Stage, strings.Join(e.Categories, ", "))
+}
+
+// WithModerationGuard is a client option that adds a middleware checking chat completions with
+// the moderation API: the user messages after the last message of the model before the request
+// is sent, and the messages of the model once they are received, or in windows of text as they
+// are streamed. Blocked completions fail with a *ModerationBlockedError, or return the refusal of
+// the guard instead. The moderation requests use the base url, api key, organization and project
+// of the request options of the chat completion. Like other middlewares, the guard wraps those
+// passed after it. Azure OpenAI has no moderation API, so the guard conflicts with WithAzure.
+func WithModerationGuard(guard ModerationGuard) ClientOption {
+	return func(c *client) error {
+		if guard.StreamWindow < 0 {
+			return errors.New("moderation stream window must not be negative")
+		}
+		if guard.StreamWindow == 0 {
+			guard.StreamWindow = DefaultModerationStreamWindow
+		}
+		thresholds := make(map[string]float32, len(guard.Thresholds))
+		for category, threshold := range guard.Thresholds {
+			thresholds[category] = threshold
+		}
+		guard.Thresholds = thresholds
+		g := &moderationGuard{ModerationGuard: guard, client: c}
+		c.middlewares = append(c.middlewares, g.middleware)
+		c.moderationGuard = true
+		return nil
+	}
+}
+
+type moderationGuard struct {
+	ModerationGuard
+	client *client
+}
+
+// errStreamRefused stops a stream once the refusal has been sent in place of blocked text.
+var errStreamRefused = errors.New("stream refused by moderation guard")
+
+func (g *moderationGuard) middleware(next Handler) Handler {
+	return func(ctx context.Context, call *Call) error {
+		request, ok := call.Request.(*ChatCompletionRequest)
+		if !ok {
+			return next(ctx, call)
+		}
+		// taken before the call is sent, as middlewares after the guard may change its options
+		route := routingOption(call.options)
+		if !g.SkipInput {
+			if err := g.check(ctx, ModerationStageInput, userInput(request.Messages), route); err != nil {
+				return g.refuse(call, request.Model, err)
+			}
+		}
+		if g.SkipOutput {
+			return next(ctx, call)
+		}
+
+		if call.Stream() {
+			s := &guardedStream{guard: g, ctx: ctx, route: route, onData: call.OnStreamData, texts: make(map[int]*streamText)}
+			call.OnStreamData = s.add
+			err := next(ctx, call)
+			if err == nil {
+				err = s.check()
+			}
+			if errors.Is(err, errStreamRefused) {
+				return nil
+			}
+			return err
+		}
+
+		if err := next(ctx, call); err != nil {
+			return err
+		}
+		response, ok := call.Response.(*ChatCompletionResponse)
+		if !ok {
+			return nil
+		}
+		texts := make([]string, len(response.Choices))
+		for i, choice := range response.Choices {
+			texts[i] = choice.Message.Content
+		}
+		blocked, err := g.moderate(ctx, ModerationStageOutput, texts, route)
+		if err != nil {
+			return err
+		}
+		for i, blockErr := range blocked {
+			if blockErr == nil {
+				continue
+			}
+			if g.Refusal == "" {
+				return blockErr
+			}
+			response.Choices[i].Message = ChatCompletionResponseMessage{Role: "assistant", Content: g.Refusal}
+			response.Choices[i].FinishReason = "content_filter"
+		}
+		return nil
+	}
+}
+
+// refuse ends a call blocked before it was sent with the refusal of the guard, if it has one, or
+// else with err.
+func (g *moderationGuard) refuse(call *Call, model string, err error) error {
+	var blockErr *ModerationBlockedError
+	if g.Refusal == "" || !errors.As(err, &blockErr) {
+		return err
+	}
+	message := ChatCompletionResponseMessage{Role: "assistant", Content: g.Refusal}
+	if call.Stream() {
+		return call.OnStreamData(&ChatCompletionStreamResponse{
+			Object:  "chat.completion.chunk",
+			Model:   model,
+			Choices: []ChatCompletionStreamResponseChoice{{FinishReason: "content_filter", Delta: message}},
+		})
+	}
+	if response, ok := call.Response.(*ChatCompletionResponse); ok {
+		*response = ChatCompletionResponse{
+			Object:  "chat.completion",
+			Model:   model,
+			Choices: []ChatCompletionResponseChoice{{FinishReason: "content_filter", Message: message}},
+		}
+	}
+	return nil
+}
+
+// routingOption returns a request option that sends a request where a call with options is sent:
+// to the same base url, with the same api key, organization and project.
+func routingOption(options requestOptions) RequestOption {
+	return func(o *requestOptions) error {
+		o.baseURL, o.apiKey = options.baseURL, options.apiKey
+		o.org, o.project = options.org, options.project
+		return nil
+	}
+}
+
+// check moderates texts and returns the error of the first one that is blocked.
+func (g *moderationGuard) check(ctx context.Context, stage string, texts []string, route RequestOption) error {
+	blocked, err := g.moderate(ctx, stage, texts, route)
+	if err != nil {
+		return err
+	}
+	for _, blockErr := range blocked {
+		if blockErr != nil {
+			return blockErr
+		}
+	}
+	return nil
+}
+
+// moderate moderates texts in a single request sent with route and returns, for each text, the error
+// blocking it or nil. Empty texts are not sent.
+func (g *moderationGuard) moderate(ctx context.Context, stage string, texts []string, route RequestOption) ([]*ModerationBlockedError, error) {
+	blocked := make([]*ModerationBlockedError, len(texts))
+	var inputs []string
+	var indexes []int
+	for i, text := range texts {
+		if strings.TrimSpace(text) != "" {
+			inputs = append(inputs, text)
+			indexes = append(indexes, i)
+		}
+	}
+	if len(inputs) == 0 {
+		return blocked, nil
+	}
+	rsp, err := g.client.Moderation(ctx, ModerationRequest{Inputs: inputs, Model: g.Model}, route)
+	if err != nil {
+		return nil, fmt.Errorf("moderation guard: %w", err)
+	}
+	if len(rsp.Results) != len(inputs) {
+		return nil, fmt.Errorf("moderation guard: moderation response has %d results for %d inputs", len(rsp.Results), len(inputs))
+	}
+	for i, result := range rsp.Results {
+		if categories := g.blockedCategories(result); len(categories) > 0 {
+			blocked[indexes[i]] = &ModerationBlockedError{Stage: stage, Categories: categories, Result: result}
+		}
+	}
+	return blocked, nil
+}
+
+// blockedCategories returns the categories of a result that block its text, sorted.
+func (g *moderationGuard) blockedCategories(result ModerationResult) []string {
+	flags, scores := result.Categories.Map(), result.CategoryScores.Map()
+	for category := range scores {
+		if _, ok := flags[category]; !ok {
+			flags[category] = false
+		}
+	}
+	var categories []string
+	for category, flagged := range flags {
+		threshold, ok := g.Thresholds[category]
+		if (ok && scores[category] >= threshold) || (!ok && flagged) {
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// userInput returns the content of the user messages after the last message of the model, which
+// are those new to this request.
+func userInput(messages []ChatCompletionRequestMessage) []string {
+	var texts []string
+	for _, message := range messages {
+		switch message.Role {
+		case "assistant":
+			texts = texts[:0]
+		case "user":
+			texts = append(texts, message.Content)
+		}
+	}
+	return texts
+}
+
+// guardedStream holds back the chunks of a stream until the text they add has been checked.
+type guardedStream struct {
+	guard  *moderationGuard
+	ctx    context.Context
+	route  RequestOption
+	onData func(chunk interface{}) error
+
+	pending []*ChatCompletionStreamResponse
+	texts   map[int]*streamText
+	model   string
+}
+
+// streamText is the text streamed for a choice, and how much of it has been checked.
+type streamText struct {
+	strings.Builder
+	checked int
+}
+
+func (s *guardedStream) add(chunk interface{}) error {
+	response, ok := chunk.(*ChatCompletionStreamResponse)
+	if !ok {
+		return s.onData(chunk)
+	}
+	s.pending = append(s.pending, response)
+	s.model = response.Model
+	full := false
+	for _, choice := range response.Choices {
+		text, ok := s.texts[choice.Index]
+		if !ok {
+			text = &streamText{}
+			s.texts[choice.Index] = text
+		}
+		text.WriteString(choice.Delta.Content)
+		if text.Len()-text.checked >= s.guard.StreamWindow {
+			full = true
+		}
+	}
+	if !full {
+		return nil
+	}
+	return s.check()
+}
+
+// check moderates the text that hasn't been checked yet, with the window before it for context,
+// and passes the held back chunks on if none of it is blocked.
+func (s *guardedStream) check() error {
+	indexes := make([]int, 0, len(s.texts))
+	for index := range s.texts {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	texts := make([]string, len(indexes))
+	for i, index := range indexes {
+		text := s.texts[index]
+		if text.Len() == text.checked {
+			continue
+		}
+		full, start := text.String(), 0
+		if text.checked > s.guard.StreamWindow {
+			// start the context at a word of the window before, so words and runes aren't cut
+			start = text.checked - s.guard.StreamWindow
+			if space := strings.IndexAny(full[start:text.checked], " \t\n"); space >= 0 {
+				start += space + 1
+			} else {
+				start = text.checked
+			}
+		}
+		texts[i] = full[start:]
+		text.checked = text.Len()
+	}
+	blocked, err := s.guard.moderate(s.ctx, ModerationStageOutput, texts, s.route)
+	if err != nil {
+		return err
+	}
+	for i, blockErr := range blocked {
+		if blockErr == nil {
+			continue
+		}
+		if s.guard.Refusal == "" {
+			return blockErr
+		}
+		s.pending = nil
+		err := s.onData(&ChatCompletionStreamResponse{
+			Object: "chat.completion.chunk",
+			Model:  s.model,
+			Choices: []ChatCompletionStreamResponseChoice{{
+				Index:        indexes[i],
+				FinishReason: "content_filter",
+				Delta:        ChatCompletionResponseMessage{Role: "assistant", Content: s.guard.Refusal},
+			}},
+		})
+		if err != nil {
+			return err
+		}
+		return errStreamRefused
+	}
+
+	pending := s.pending
+	s.pending = nil
+	for _, chunk := range pending {
+		if err := s.onData(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package gpt3_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/PullRequestInc/go-gpt3/gpt3test"
+	"github.com/stretchr/testify/assert"
+)
+
+func moderationResults(results ...gpt3.ModerationResult) gpt3.ModerationResponse {
+	return gpt3.ModerationResponse{ID: "modr-1", Model: gpt3.OmniModerationLatest, Results: results}
+}
+
+var violent = gpt3.ModerationResult{
+	Flagged:        true,
+	Categories:     gpt3.ModerationCategoryResult{Violence: true},
+	CategoryScores: gpt3.ModerationCategoryScores{Violence: 0.9},
+}
+
+// moderatedInputs returns the inputs of the moderation requests received by server.
+func moderatedInputs(t *testing.T, server *gpt3test.Server) [][]string {
+	var inputs [][]string
+	for _, r := range server.Requests() {
+		if r.Path == "/v1/moderations" {
+			var request gpt3.ModerationRequest
+			assert.NoError(t, json.Unmarshal(r.Body, &request))
+			inputs = append(inputs, request.Inputs)
+		}
+	}
+	return inputs
+}
+
+func TestModerationGuardBlocksInput(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.QueueModeration(moderationResults(gpt3.ModerationResult{}, violent))
+	client := server.Client(gpt3.WithModerationGuard(gpt3.ModerationGuard{Model: gpt3.OmniModerationLatest}))
+
+	_, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{
+		Messages: []gpt3.ChatCompletionRequestMessage{
+			{Role: "system", Content: "Be nice."},
+			{Role: "user", Content: "Earlier question"},
+			{Role: "assistant", Content: "Earlier answer"},
+			{Role: "user", Content: "First"},
+			{Role: "user", Content: "Second"},
+		},
+	})
+	var blockErr *gpt3.ModerationBlockedError
+	assert.True(t, errors.As(err, &blockErr))
+	assert.EqualError(t, err, "moderation blocked the input: violence")
+	assert.Equal(t, gpt3.ModerationStageInput, blockErr.Stage)
+	assert.Equal(t, []string{gpt3.ModerationViolence}, blockErr.Categories)
+	assert.Equal(t, violent, blockErr.Result)
+
+	assert.Equal(t, [][]string{{"First", "Second"}}, moderatedInputs(t, server))
+	assert.Len(t, server.Requests(), 1)
+}
+
+func TestModerationGuardThresholds(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.QueueModeration(
+		moderationResults(gpt3.ModerationResult{
+			Flagged:        true,
+			Categories:     gpt3.ModerationCategoryResult{Violence: true},
+			CategoryScores: gpt3.ModerationCategoryScores{Violence: 0.6, Harassment: 0.4},
+		}),
+		moderationResults(gpt3.ModerationResult{
+			CategoryScores: gpt3.ModerationCategoryScores{Harassment: 0.1},
+		}),
+	)
+	client := server.Client(gpt3.WithModerationGuard(gpt3.ModerationGuard{
+		Thresholds: map[string]float32{gpt3.ModerationViolence: 0.8, gpt3.ModerationHarassment: 0.3},
+		SkipOutput: true,
+	}))
+	request := gpt3.ChatCompletionRequest{Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "Hi"}}}
+
+	// violence is flagged but below its threshold, harassment is not flagged but above its threshold
+	_, err := client.ChatCompletion(context.Background(), request)
+	assert.EqualError(t, err, "moderation blocked the input: harassment")
+
+	_, err = client.ChatCompletion(context.Background(), request)
+	assert.NoError(t, err)
+}
+
+func TestModerationGuardBlocksOutput(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.QueueChatCompletion(gpt3.ChatCompletionResponse{
+		ID: "chatcmpl-1",
+		Choices: []gpt3.ChatCompletionResponseChoice{
+			{Index: 0, FinishReason: "stop", Message: gpt3.ChatCompletionResponseMessage{Role: "assistant", Content: "Fine"}},
+			{Index: 1, FinishReason: "stop", Message: gpt3.ChatCompletionResponseMessage{Role: "assistant", Content: "Violent"}},
+		},
+	})
+	server.QueueModeration(moderationResults(gpt3.ModerationResult{}), moderationResults(gpt3.ModerationResult{}, violent))
+	client := server.Client(gpt3.WithModerationGuard(gpt3.ModerationGuard{Refusal: "I can't help with that."}))
+
+	rsp, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{
+		Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "Hi"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "chatcmpl-1", rsp.ID)
+	assert.Equal(t, "Fine", rsp.Choices[0].Message.Content)
+	assert.Equal(t, "I can't help with that.", rsp.Choices[1].Message.Content)
+	assert.Equal(t, "content_filter", rsp.Choices[1].FinishReason)
+	assert.Equal(t, [][]string{{"Hi"}, {"Fine", "Violent"}}, moderatedInputs(t, server))
+}
+
+func TestModerationGuardRefusesInput(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.QueueModeration(moderationResults(violent), moderationResults(violent))
+	client := server.Client(gpt3.WithModerationGuard(gpt3.ModerationGuard{Refusal: "No."}))
+	request := gpt3.ChatCompletionRequest{Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "Hi"}}}
+
+	rsp, err := client.ChatCompletion(context.Background(), request)
+	assert.NoError(t, err)
+	assert.Equal(t, "No.", rsp.Choices[0].Message.Content)
+	assert.Equal(t, "content_filter", rsp.Choices[0].FinishReason)
+
+	var content []string
+	err = client.ChatCompletionStream(context.Background(), request, func(chunk *gpt3.ChatCompletionStreamResponse) error {
+		content = append(content, chunk.Choices[0].Delta.Content)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"No."}, content)
+	assert.Len(t, server.Requests(), 2)
+}
+
+func TestModerationGuardStream(t *testing.T) {
+	text := "one two three four five six seven eight"
+	request := gpt3.ChatCompletionRequest{Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "Count"}}}
+
+	t.Run("allowed", func(t *testing.T) {
+		server := gpt3test.NewServer()
+		defer server.Close()
+		server.QueueChatCompletion(gpt3.ChatCompletionResponse{
+			Choices: []gpt3.ChatCompletionResponseChoice{{Message: gpt3.ChatCompletionResponseMessage{Role: "assistant", Content: text}}},
+		})
+		client := server.Client(gpt3.WithModerationGuard(gpt3.ModerationGuard{StreamWindow: 10, SkipInput: true}))
+
+		var content strings.Builder
+		err := client.ChatCompletionStream(context.Background(), request, func(chunk *gpt3.ChatCompletionStreamResponse) error {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, text, content.String())
+		// each window is checked with the window before it
+		assert.Equal(t, [][]string{
+			{"one two three"},
+			{"two three four five"},
+			{"four five six seven"},
+			{"six seven eight"},
+		}, moderatedInputs(t, server))
+	})
+
+	t.Run("blocked", func(t *testing.T) {
+		server := gpt3test.NewServer()
+		defer server.Close()
+		server.QueueChatCompletion(gpt3.ChatCompletionResponse{
+			Choices: []gpt3.ChatCompletionResponseChoice{{Message: gpt3.ChatCompletionResponseMessage{Role: "assistant", Content: text}}},
+		})
+		server.QueueModeration(moderationResults(gpt3.ModerationResult{}), moderationResults(violent))
+		client := server.Client(gpt3.WithModerationGuard(gpt3.ModerationGuard{StreamWindow: 10, SkipInput: true}))
+
+		var content strings.Builder
+		err := client.ChatCompletionStream(context.Background(), request, func(chunk *gpt3.ChatCompletionStreamResponse) error {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			return nil
+		})
+		var blockErr *gpt3.ModerationBlockedError
+		assert.True(t, errors.As(err, &blockErr))
+		assert.Equal(t, gpt3.ModerationStageOutput, blockErr.Stage)
+		// only the first window reached the callback
+		assert.Equal(t, "one two three", content.String())
+	})
+	t.Run("refused", func(t *testing.T) {
+		server := gpt3test.NewServer()
+		defer server.Close()
+		server.QueueChatCompletion(gpt3.ChatCompletionResponse{
+			Choices: []gpt3.ChatCompletionResponseChoice{{Message: gpt3.ChatCompletionResponseMessage{Role: "assistant", Content: text}}},
+		})
+		server.QueueModeration(moderationResults(gpt3.ModerationResult{}), moderationResults(violent))
+		client := server.Client(gpt3.WithModerationGuard(gpt3.ModerationGuard{StreamWindow: 10, SkipInput: true, Refusal: " No."}))
+
+		var content strings.Builder
+		var finishReason string
+		err := client.ChatCompletionStream(context.Background(), request, func(chunk *gpt3.ChatCompletionStreamResponse) error {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			finishReason = chunk.Choices[0].FinishReason
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, "one two three No.", content.String())
+		assert.Equal(t, "content_filter", finishReason)
+	})
+}
+
+func TestModerationGuardUsesRequestOptions(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	client := gpt3.NewClient("client-key", gpt3.WithBaseURL("http://127.0.0.1:1/v1"),
+		gpt3.WithModerationGuard(gpt3.ModerationGuard{}))
+
+	_, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{
+		Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "Hello"}},
+	}, gpt3.WithRequestBaseURL(server.BaseURL()), gpt3.WithRequestAPIKey("tenant-key"), gpt3.WithRequestOrg("org-tenant"))
+	assert.NoError(t, err)
+	// the input, the completion and its output are all sent with the options of the call
+	requests := server.Requests()
+	assert.Len(t, requests, 3)
+	for _, r := range requests {
+		assert.Equal(t, "Bearer tenant-key", r.Header.Get("Authorization"), r.Path)
+		assert.Equal(t, "org-tenant", r.Header.Get("OpenAI-Organization"), r.Path)
+	}
+	assert.Len(t, moderatedInputs(t, server), 2)
+}
+
+func TestModerationGuardConflictsWithAzure(t *testing.T) {
+	_, err := gpt3.NewClientWithOptions("key",
+		gpt3.WithAzure(gpt3.AzureConfig{Endpoint: "https://my-resource.openai.azure.com"}),
+		gpt3.WithModerationGuard(gpt3.ModerationGuard{}),
+	)
+	assert.EqualError(t, err, "invalid client options: WithModerationGuard conflicts with WithAzure, which has no moderation API")
+}
@@ -0,0 +1,17 @@
+module github.com/PullRequestInc/go-gpt3/logging
+
+go 1.21
+
+// Develops against the root module in this repository, see Releasing in the README.
+replace github.com/PullRequestInc/go-gpt3 => ../
+
+require (
+	github.com/PullRequestInc/go-gpt3 v1.2.0
+	github.com/stretchr/testify v1.8.4
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,235 @@
+// Package logging writes a structured log/slog record for every go-gpt3 client call.
+//
+// Each call is logged once with its operation, model, status, latency, token usage and request ID.
+// Request headers and bodies can additionally be logged in a separate debug level record, with the
+// Authorization header, the API key and any configured fields redacted.
+package logging
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+)
+
+// Redacted replaces every redacted value in logged headers and bodies.
+const Redacted = "[REDACTED]"
+
+// sensitiveHeaders are always redacted when headers are logged.
+var sensitiveHeaders = []string{"Authorization", "Api-Key"}
+
+type config struct {
+	level          slog.Level
+	bodies         bool
+	redactedFields map[string]bool
+}
+
+// Option configures the logging middleware.
+type Option func(*config)
+
+// WithLevel sets the level of the record logged for successful calls. The default is slog.LevelInfo.
+// Failed calls are always logged at slog.LevelError.
+func WithLevel(level slog.Level) Option {
+	return func(c *config) {
+		c.level = level
+	}
+}
+
+// WithBodies additionally logs the request headers and the request and response bodies in a
+// separate record at debug level, after the record of the call.
+func WithBodies() Option {
+	return func(c *config) {
+		c.bodies = true
+	}
+}
+
+// WithRedactedFields redacts the values of the given JSON fields wherever they appear in logged
+// bodies, e.g. "content", "prompt" or "input" to keep message content out of the logs.
+func WithRedactedFields(fields ...string) Option {
+	return func(c *config) {
+		for _, field := range fields {
+			c.redactedFields[field] = true
+		}
+	}
+}
+
+// WithLogging is a client option that logs every call made by the client to the given logger.
+func WithLogging(logger *slog.Logger, opts ...Option) gpt3.ClientOption {
+	return gpt3.WithMiddleware(Middleware(logger, opts...))
+}
+
+// Middleware returns a gpt3.Middleware that logs every call to the given logger.
+func Middleware(logger *slog.Logger, opts ...Option) gpt3.Middleware {
+	cfg := config{level: slog.LevelInfo, redactedFields: map[string]bool{}}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	return func(next gpt3.Handler) gpt3.Handler {
+		return func(ctx context.Context, call *gpt3.Call) error {
+			start := time.Now()
+			chunks := 0
+			if call.Stream() {
+				onData := call.OnStreamData
+				call.OnStreamData = func(chunk interface{}) error {
+					chunks++
+					return onData(chunk)
+				}
+			}
+
+			err := next(ctx, call)
+
+			attrs := []slog.Attr{
+				slog.String("operation", call.Operation),
+				slog.String("model", call.Model()),
+				slog.Duration("latency", time.Since(start)),
+			}
+			var apiErr gpt3.APIError
+			if errors.As(err, &apiErr) {
+				attrs = append(attrs, slog.Int("status", apiErr.StatusCode))
+			} else if call.HTTPResponse != nil {
+				attrs = append(attrs, slog.Int("status", call.HTTPResponse.StatusCode))
+			}
+			if call.HTTPResponse != nil {
+				if id := call.HTTPResponse.Header.Get("X-Request-Id"); id != "" {
+					attrs = append(attrs, slog.String("request_id", id))
+				}
+			}
+			if call.Stream() {
+				attrs = append(attrs, slog.Int("chunks", chunks))
+			} else if err == nil {
+				attrs = append(attrs, usageAttrs(call.Response)...)
+			}
+
+			level, msg := cfg.level, "gpt3 call"
+			if err != nil {
+				level, msg = slog.LevelError, "gpt3 call failed"
+				attrs = append(attrs, slog.String("error", err.Error()))
+			}
+			logger.LogAttrs(ctx, level, msg, attrs...)
+			if cfg.bodies && logger.Enabled(ctx, slog.LevelDebug) {
+				// a record of its own, so that payloads never reach handlers filtering out debug
+				bodyAttrs := append([]slog.Attr{
+					slog.String("operation", call.Operation),
+					slog.String("model", call.Model()),
+				}, cfg.bodyAttrs(call, err)...)
+				logger.LogAttrs(ctx, slog.LevelDebug, "gpt3 call bodies", bodyAttrs...)
+			}
+			return err
+		}
+	}
+}
+
+// usageAttrs returns the token usage reported by a decoded response.
+func usageAttrs(response interface{}) []slog.Attr {
+	var prompt, completion, total int
+	switch r := response.(type) {
+	case *gpt3.ChatCompletionResponse:
+		prompt, completion, total = r.Usage.PromptTokens, r.Usage.CompletionTokens, r.Usage.TotalTokens
+	case *gpt3.CompletionResponse:
+		prompt, completion, total = r.Usage.PromptTokens, r.Usage.CompletionTokens, r.Usage.TotalTokens
+	case *gpt3.EditsResponse:
+		prompt, completion, total = r.Usage.PromptTokens, r.Usage.CompletionTokens, r.Usage.TotalTokens
+	case *gpt3.EmbeddingsResponse:
+		prompt, total = r.Usage.PromptTokens, r.Usage.TotalTokens
+	default:
+		return nil
+	}
+	return []slog.Attr{slog.Group("usage",
+		slog.Int("prompt_tokens", prompt),
+		slog.Int("completion_tokens", completion),
+		slog.Int("total_tokens", total),
+	)}
+}
+
+// bodyAttrs returns the redacted request headers and request and response bodies of the call.
+func (cfg *config) bodyAttrs(call *gpt3.Call, err error) []slog.Attr {
+	var secrets []string
+	var headers []slog.Attr
+	if call.HTTPRequest != nil {
+		secrets = apiKeys(call.HTTPRequest.Header)
+		names := make([]string, 0, len(call.HTTPRequest.Header))
+		for name := range call.HTTPRequest.Header {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			value := strings.Join(call.HTTPRequest.Header[name], ", ")
+			for _, sensitive := range sensitiveHeaders {
+				if http.CanonicalHeaderKey(sensitive) == name {
+					value = Redacted
+				}
+			}
+			headers = append(headers, slog.String(name, value))
+		}
+	}
+
+	attrs := []slog.Attr{slog.Any("request_headers", slog.GroupValue(headers...))}
+	if call.Request != nil {
+		attrs = append(attrs, slog.String("request_body", cfg.redact(call.Request, secrets)))
+	}
+	if err == nil && call.Response != nil {
+		attrs = append(attrs, slog.String("response_body", cfg.redact(call.Response, secrets)))
+	}
+	return attrs
+}
+
+// apiKeys returns the credentials sent in the request headers so they can be removed from bodies.
+func apiKeys(header http.Header) []string {
+	var keys []string
+	if auth := header.Get("Authorization"); auth != "" {
+		keys = append(keys, strings.TrimSpace(strings.TrimPrefix(auth, "Bearer")))
+	}
+	if key := header.Get("Api-Key"); key != "" {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// redact encodes v as JSON with the configured fields and any secrets replaced.
+func (cfg *config) redact(v interface{}, secrets []string) string {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	if len(cfg.redactedFields) > 0 {
+		var decoded interface{}
+		if err := json.Unmarshal(raw, &decoded); err == nil {
+			if redacted, err := json.Marshal(cfg.redactFields(decoded)); err == nil {
+				raw = redacted
+			}
+		}
+	}
+	body := string(raw)
+	for _, secret := range secrets {
+		if secret != "" {
+			body = strings.ReplaceAll(body, secret, Redacted)
+		}
+	}
+	return body
+}
+
+// redactFields replaces the values of the configured fields anywhere in a decoded JSON value.
+func (cfg *config) redactFields(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for key, field := range value {
+			if cfg.redactedFields[key] {
+				value[key] = Redacted
+			} else {
+				value[key] = cfg.redactFields(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = cfg.redactFields(item)
+		}
+	}
+	return v
+}
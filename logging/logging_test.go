@@ -0,0 +1,121 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	fakes "github.com/PullRequestInc/go-gpt3/go-gpt3fakes"
+	"github.com/PullRequestInc/go-gpt3/logging"
+	"github.com/stretchr/testify/assert"
+)
+
+// apiKey is shaped like a real API key, to check it is scrubbed wherever it appears.
+const apiKey = "sk-proj-Xq3vT9mLr2Kd8WbZ1nYc5FhJ7uPs0AeG4tRiBoNy6MwQ"
+
+func newClient(rt *fakes.FakeRoundTripper, level slog.Level, opts ...logging.Option) (gpt3.Client, *bytes.Buffer) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level}))
+	client := gpt3.NewClient(apiKey, gpt3.WithHTTPClient(&http.Client{Transport: rt}),
+		logging.WithLogging(logger, opts...))
+	return client, &buf
+}
+
+func decodeRecord(t *testing.T, buf *bytes.Buffer) map[string]interface{} {
+	records := decodeRecords(t, buf)
+	assert.Len(t, records, 1)
+	return records[0]
+}
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var records []map[string]interface{}
+	decoder := json.NewDecoder(buf)
+	for decoder.More() {
+		record := map[string]interface{}{}
+		assert.NoError(t, decoder.Decode(&record))
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogsCall(t *testing.T) {
+	rt := &fakes.FakeRoundTripper{}
+	header := make(http.Header)
+	header.Set("x-request-id", "req-123")
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`)),
+	}, nil)
+	client, buf := newClient(rt, slog.LevelInfo, logging.WithBodies())
+
+	_, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{})
+	assert.NoError(t, err)
+
+	record := decodeRecord(t, buf)
+	assert.Equal(t, "INFO", record["level"])
+	assert.Equal(t, "gpt3 call", record["msg"])
+	assert.Equal(t, gpt3.OperationChatCompletion, record["operation"])
+	assert.Equal(t, gpt3.GPT3Dot5Turbo, record["model"])
+	assert.Equal(t, float64(200), record["status"])
+	assert.Equal(t, "req-123", record["request_id"])
+	assert.Equal(t, float64(12), record["usage"].(map[string]interface{})["total_tokens"])
+	assert.NotContains(t, record, "request_body", "bodies are only logged at debug level")
+}
+
+func TestLogsRedactedBodies(t *testing.T) {
+	rt := &fakes.FakeRoundTripper{}
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"choices":[{"message":{"content":"the answer"}}]}`)),
+	}, nil)
+	client, buf := newClient(rt, slog.LevelDebug, logging.WithBodies(), logging.WithRedactedFields("content"))
+
+	_, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{
+		Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "my secret question"}},
+	})
+	assert.NoError(t, err)
+
+	assert.NotContains(t, buf.String(), apiKey)
+	assert.NotContains(t, buf.String(), "my secret question")
+	assert.NotContains(t, buf.String(), "the answer")
+
+	records := decodeRecords(t, buf)
+	assert.Len(t, records, 2)
+	assert.Equal(t, "INFO", records[0]["level"])
+	assert.NotContains(t, records[0], "request_headers")
+	assert.NotContains(t, records[0], "request_body")
+
+	record := records[1]
+	assert.Equal(t, "DEBUG", record["level"])
+	assert.Equal(t, "gpt3 call bodies", record["msg"])
+	assert.Equal(t, gpt3.OperationChatCompletion, record["operation"])
+	headers := record["request_headers"].(map[string]interface{})
+	assert.Equal(t, logging.Redacted, headers["Authorization"])
+	assert.Equal(t, "application/json", headers["Content-Type"])
+	assert.Contains(t, record["request_body"], `"role":"user"`)
+	assert.Contains(t, record["response_body"], `"content":"[REDACTED]"`)
+}
+
+func TestLogsFailure(t *testing.T) {
+	rt := &fakes.FakeRoundTripper{}
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 500,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error":{"type":"server_error","message":"oops"}}`)),
+	}, nil)
+	client, buf := newClient(rt, slog.LevelInfo)
+
+	_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: gpt3.TextEmbeddingAda002})
+	assert.Error(t, err)
+
+	record := decodeRecord(t, buf)
+	assert.Equal(t, "ERROR", record["level"])
+	assert.Equal(t, "gpt3 call failed", record["msg"])
+	assert.Equal(t, float64(500), record["status"])
+	assert.Equal(t, "[500:server_error] oops", record["error"])
+}
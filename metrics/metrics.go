@@ -0,0 +1,243 @@
+// Package metrics records Prometheus metrics for go-gpt3 client calls: request counts, latency,
+// time to first token for streams, token usage, estimated cost and the remaining rate limits.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Price is the cost in dollars of 1000 prompt and completion tokens for a model.
+type Price struct {
+	PromptPer1K     float64
+	CompletionPer1K float64
+}
+
+type config struct {
+	namespace string
+	buckets   []float64
+	prices    map[string]Price
+}
+
+// Option configures a Collector.
+type Option func(*config)
+
+// WithNamespace sets the namespace prefixed to every metric name. The default is "gpt3".
+func WithNamespace(namespace string) Option {
+	return func(c *config) {
+		c.namespace = namespace
+	}
+}
+
+// WithBuckets overrides the histogram buckets, in seconds, used for the latency metrics.
+func WithBuckets(buckets []float64) Option {
+	return func(c *config) {
+		c.buckets = buckets
+	}
+}
+
+// WithPrices enables the cost counter, using the given prices keyed by model name.
+func WithPrices(prices map[string]Price) Option {
+	return func(c *config) {
+		c.prices = prices
+	}
+}
+
+// Collector holds the metrics recorded for client calls.
+type Collector struct {
+	prices map[string]Price
+
+	requests          *prometheus.CounterVec
+	duration          *prometheus.HistogramVec
+	timeToFirstToken  *prometheus.HistogramVec
+	promptTokens      *prometheus.CounterVec
+	completionTokens  *prometheus.CounterVec
+	cost              *prometheus.CounterVec
+	remainingRequests *prometheus.GaugeVec
+	remainingTokens   *prometheus.GaugeVec
+}
+
+// NewCollector creates the metrics and registers them on the given registerer.
+func NewCollector(registerer prometheus.Registerer, opts ...Option) (*Collector, error) {
+	cfg := config{
+		namespace: "gpt3",
+		buckets:   []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60},
+	}
+	for _, o := range opts {
+		o(&cfg)
+	}
+
+	c := &Collector{
+		prices: cfg.prices,
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "requests_total",
+			Help:      "Number of API calls by operation, model and status.",
+		}, []string{"operation", "model", "status"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Name:      "request_duration_seconds",
+			Help:      "Duration of API calls, including the full body of streams.",
+			Buckets:   cfg.buckets,
+		}, []string{"operation", "model"}),
+		timeToFirstToken: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: cfg.namespace,
+			Name:      "time_to_first_token_seconds",
+			Help:      "Time until the first chunk of a streaming call was received.",
+			Buckets:   cfg.buckets,
+		}, []string{"operation", "model"}),
+		promptTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "prompt_tokens_total",
+			Help:      "Number of prompt tokens reported in the usage of responses.",
+		}, []string{"operation", "model"}),
+		completionTokens: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "completion_tokens_total",
+			Help:      "Number of completion tokens reported in the usage of responses.",
+		}, []string{"operation", "model"}),
+		cost: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: cfg.namespace,
+			Name:      "cost_dollars_total",
+			Help:      "Estimated cost in dollars of the tokens used, for models with a configured price.",
+		}, []string{"operation", "model"}),
+		remainingRequests: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: cfg.namespace,
+			Name:      "ratelimit_remaining_requests",
+			Help:      "Remaining requests before exhausting the rate limit, from the last response.",
+		}, []string{"model"}),
+		remainingTokens: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: cfg.namespace,
+			Name:      "ratelimit_remaining_tokens",
+			Help:      "Remaining tokens before exhausting the rate limit, from the last response.",
+		}, []string{"model"}),
+	}
+
+	collectors := []prometheus.Collector{
+		c.requests, c.duration, c.timeToFirstToken, c.promptTokens,
+		c.completionTokens, c.remainingRequests, c.remainingTokens,
+	}
+	if c.prices != nil {
+		collectors = append(collectors, c.cost)
+	}
+	for _, collector := range collectors {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// ClientOption is a client option that records metrics for every call made by the client.
+func (c *Collector) ClientOption() gpt3.ClientOption {
+	return gpt3.WithMiddleware(c.Middleware())
+}
+
+// Middleware returns a gpt3.Middleware that records metrics for every call.
+func (c *Collector) Middleware() gpt3.Middleware {
+	return func(next gpt3.Handler) gpt3.Handler {
+		return func(ctx context.Context, call *gpt3.Call) error {
+			operation, model := call.Operation, call.Model()
+			start := time.Now()
+
+			var usage usage
+			if call.Stream() {
+				var once sync.Once
+				onData := call.OnStreamData
+				call.OnStreamData = func(chunk interface{}) error {
+					once.Do(func() {
+						c.timeToFirstToken.WithLabelValues(operation, model).Observe(time.Since(start).Seconds())
+					})
+					usage.add(chunk)
+					return onData(chunk)
+				}
+			}
+
+			err := next(ctx, call)
+
+			c.duration.WithLabelValues(operation, model).Observe(time.Since(start).Seconds())
+			c.requests.WithLabelValues(operation, model, status(call, err)).Inc()
+
+			var apiErr gpt3.APIError
+			if call.HTTPResponse != nil {
+				c.setRateLimits(model, gpt3.NewRateLimitHeadersFromResponse(call.HTTPResponse))
+			} else if errors.As(err, &apiErr) {
+				c.setRateLimits(model, apiErr.RateLimitHeaders)
+			}
+
+			if err == nil && !call.Stream() {
+				usage.add(call.Response)
+			}
+			c.recordUsage(operation, model, usage)
+			return err
+		}
+	}
+}
+
+func (c *Collector) setRateLimits(model string, headers gpt3.RateLimitHeaders) {
+	if headers.LimitRequests > 0 {
+		c.remainingRequests.WithLabelValues(model).Set(float64(headers.RemainingRequests))
+	}
+	if headers.LimitTokens > 0 {
+		c.remainingTokens.WithLabelValues(model).Set(float64(headers.RemainingTokens))
+	}
+}
+
+func (c *Collector) recordUsage(operation, model string, u usage) {
+	if u.prompt == 0 && u.completion == 0 {
+		return
+	}
+	c.promptTokens.WithLabelValues(operation, model).Add(float64(u.prompt))
+	c.completionTokens.WithLabelValues(operation, model).Add(float64(u.completion))
+	if price, ok := c.prices[model]; ok {
+		cost := float64(u.prompt)/1000*price.PromptPer1K + float64(u.completion)/1000*price.CompletionPer1K
+		c.cost.WithLabelValues(operation, model).Add(cost)
+	}
+}
+
+// status returns the status label of a call: the HTTP status code, or "error" if no response was received.
+func status(call *gpt3.Call, err error) string {
+	var apiErr gpt3.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		return strconv.Itoa(apiErr.StatusCode)
+	case call.HTTPResponse != nil:
+		return strconv.Itoa(call.HTTPResponse.StatusCode)
+	case err == nil:
+		// the call was short-circuited by another middleware
+		return "ok"
+	default:
+		return "error"
+	}
+}
+
+type usage struct {
+	prompt     int
+	completion int
+}
+
+// add accumulates the usage reported by a response or stream chunk.
+func (u *usage) add(response interface{}) {
+	switch r := response.(type) {
+	case *gpt3.ChatCompletionResponse:
+		u.prompt += r.Usage.PromptTokens
+		u.completion += r.Usage.CompletionTokens
+	case *gpt3.ChatCompletionStreamResponse:
+		u.prompt += r.Usage.PromptTokens
+		u.completion += r.Usage.CompletionTokens
+	case *gpt3.CompletionResponse:
+		u.prompt += r.Usage.PromptTokens
+		u.completion += r.Usage.CompletionTokens
+	case *gpt3.EditsResponse:
+		u.prompt += r.Usage.PromptTokens
+		u.completion += r.Usage.CompletionTokens
+	case *gpt3.EmbeddingsResponse:
+		u.prompt += r.Usage.PromptTokens
+	}
+}
@@ -0,0 +1,92 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	fakes "github.com/PullRequestInc/go-gpt3/go-gpt3fakes"
+	"github.com/PullRequestInc/go-gpt3/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func newClient(t *testing.T, rt *fakes.FakeRoundTripper) (gpt3.Client, *prometheus.Registry) {
+	registry := prometheus.NewRegistry()
+	collector, err := metrics.NewCollector(registry, metrics.WithPrices(map[string]metrics.Price{
+		gpt3.GPT3Dot5Turbo: {PromptPer1K: 1, CompletionPer1K: 2},
+	}))
+	assert.NoError(t, err)
+	return gpt3.NewClient("test-key", gpt3.WithHTTPClient(&http.Client{Transport: rt}), collector.ClientOption()), registry
+}
+
+func TestChatCompletionMetrics(t *testing.T) {
+	rt := &fakes.FakeRoundTripper{}
+	header := make(http.Header)
+	header.Set("x-ratelimit-limit-requests", "60")
+	header.Set("x-ratelimit-remaining-requests", "59")
+	header.Set("x-ratelimit-limit-tokens", "150000")
+	header.Set("x-ratelimit-remaining-tokens", "149984")
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"usage":{"prompt_tokens":500,"completion_tokens":250,"total_tokens":750}}`)),
+	}, nil)
+	client, registry := newClient(t, rt)
+
+	_, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{})
+	assert.NoError(t, err)
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, bytes.NewBufferString(`
+# HELP gpt3_requests_total Number of API calls by operation, model and status.
+# TYPE gpt3_requests_total counter
+gpt3_requests_total{model="gpt-3.5-turbo",operation="ChatCompletion",status="200"} 1
+# HELP gpt3_prompt_tokens_total Number of prompt tokens reported in the usage of responses.
+# TYPE gpt3_prompt_tokens_total counter
+gpt3_prompt_tokens_total{model="gpt-3.5-turbo",operation="ChatCompletion"} 500
+# HELP gpt3_completion_tokens_total Number of completion tokens reported in the usage of responses.
+# TYPE gpt3_completion_tokens_total counter
+gpt3_completion_tokens_total{model="gpt-3.5-turbo",operation="ChatCompletion"} 250
+# HELP gpt3_cost_dollars_total Estimated cost in dollars of the tokens used, for models with a configured price.
+# TYPE gpt3_cost_dollars_total counter
+gpt3_cost_dollars_total{model="gpt-3.5-turbo",operation="ChatCompletion"} 1
+# HELP gpt3_ratelimit_remaining_requests Remaining requests before exhausting the rate limit, from the last response.
+# TYPE gpt3_ratelimit_remaining_requests gauge
+gpt3_ratelimit_remaining_requests{model="gpt-3.5-turbo"} 59
+# HELP gpt3_ratelimit_remaining_tokens Remaining tokens before exhausting the rate limit, from the last response.
+# TYPE gpt3_ratelimit_remaining_tokens gauge
+gpt3_ratelimit_remaining_tokens{model="gpt-3.5-turbo"} 149984
+`), "gpt3_requests_total", "gpt3_prompt_tokens_total", "gpt3_completion_tokens_total",
+		"gpt3_cost_dollars_total", "gpt3_ratelimit_remaining_requests", "gpt3_ratelimit_remaining_tokens"))
+	assert.Equal(t, 1, testutil.CollectAndCount(registry, "gpt3_request_duration_seconds"))
+}
+
+func TestErrorAndStreamMetrics(t *testing.T) {
+	rt := &fakes.FakeRoundTripper{}
+	rt.RoundTripReturnsOnCall(0, &http.Response{
+		StatusCode: 429,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error":{"type":"rate_limit_exceeded"}}`)),
+	}, nil)
+	rt.RoundTripReturnsOnCall(1, &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBufferString("data: {\"choices\":[{\"text\":\"a\"}]}\n\ndata: [DONE]\n\n")),
+	}, nil)
+	client, registry := newClient(t, rt)
+
+	_, err := client.Completion(context.Background(), gpt3.CompletionRequest{})
+	assert.Error(t, err)
+	err = client.CompletionStream(context.Background(), gpt3.CompletionRequest{}, func(*gpt3.CompletionResponse) {})
+	assert.NoError(t, err)
+
+	assert.NoError(t, testutil.GatherAndCompare(registry, bytes.NewBufferString(`
+# HELP gpt3_requests_total Number of API calls by operation, model and status.
+# TYPE gpt3_requests_total counter
+gpt3_requests_total{model="davinci",operation="Completion",status="429"} 1
+gpt3_requests_total{model="davinci",operation="CompletionStream",status="200"} 1
+`), "gpt3_requests_total"))
+	assert.Equal(t, 1, testutil.CollectAndCount(registry, "gpt3_time_to_first_token_seconds"))
+}
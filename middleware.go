@@ -0,0 +1,92 @@
+package gpt3
+
+import (
+	"context"
+	"net/http"
+)
+
+// Operation names reported in Call.Operation for each Client method. Search is implemented with
+// embeddings, so its calls report OperationEmbeddings.
+const (
+	OperationEngines              = "Engines"
+	OperationEngine               = "Engine"
+	OperationChatCompletion       = "ChatCompletion"
+	OperationChatCompletionStream = "ChatCompletionStream"
+	OperationCompletion           = "Completion"
+	OperationCompletionStream     = "CompletionStream"
+	OperationEdits                = "Edits"
+	OperationEmbeddings           = "Embeddings"
+	OperationModeration           = "Moderation"
+)
+
+// Call describes a single logical API call as it passes through the middleware chain.
+type Call struct {
+	// Operation is the logical name of the call, e.g. OperationChatCompletion. The WithEngine
+	// variants of a method report the same operation as the method they extend.
+	Operation string
+
+	// Request is a pointer to the typed request payload, e.g. *ChatCompletionRequest, or nil for
+	// calls without a body. It is encoded into the HTTPRequest body right before the request is
+	// sent, so middlewares may modify it. Slices and maps are shared with the caller's request and
+	// should be copied rather than modified in place.
+	Request interface{}
+
+	// HTTPRequest is the outgoing HTTP request. Middlewares may add headers or replace it.
+	HTTPRequest *http.Request
+
+	// HTTPResponse is the raw HTTP response once it has been received. It is nil if the request
+	// failed or the call was short-circuited.
+	HTTPResponse *http.Response
+
+	// Response is a pointer to the typed response, e.g. *ChatCompletionResponse, which is decoded
+	// once the request succeeds. A middleware that short-circuits the call should populate the
+	// value it points to instead of calling the next handler. It is nil for streaming calls.
+	Response interface{}
+
+	// OnStreamData receives each decoded chunk of a streaming call, a *ChatCompletionStreamResponse
+	// or *CompletionResponse, before it reaches the caller's callback. Middlewares may wrap it to
+	// observe or alter chunks. It is nil for non-streaming calls.
+	OnStreamData func(chunk interface{}) error
+
+	engine         string
+	path           string
+	options        requestOptions
+	newStreamChunk func() interface{}
+}
+
+// Model returns the model requested by the call, which for the engine based endpoints is the engine.
+func (call *Call) Model() string {
+	switch r := call.Request.(type) {
+	case *ChatCompletionRequest:
+		return r.Model
+	case *EditsRequest:
+		return r.Model
+	case *EmbeddingsRequest:
+		return r.Model
+	case *ModerationRequest:
+		return r.Model
+	}
+	return call.engine
+}
+
+// Stream reports whether the call is a streaming call.
+func (call *Call) Stream() bool {
+	return call.OnStreamData != nil
+}
+
+// Handler performs a Call. The final handler in a chain sends the HTTP request and decodes the
+// response into the Call.
+type Handler func(ctx context.Context, call *Call) error
+
+// Middleware wraps a Handler to observe, modify, short-circuit or retry calls. Middlewares are
+// applied in the order they are passed to WithMiddleware, so the first one is the outermost.
+type Middleware func(next Handler) Handler
+
+// chainMiddleware wraps the final handler with the given middlewares so the first middleware runs first.
+func chainMiddleware(middlewares []Middleware, final Handler) Handler {
+	h := final
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
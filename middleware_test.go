@@ -0,0 +1,132 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareOrderAndObservation(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"id":"chatcmpl-123","usage":{"total_tokens":7}}`)),
+	}, nil)
+
+	var events []string
+	var observed *gpt3.Call
+	record := func(name string) gpt3.Middleware {
+		return func(next gpt3.Handler) gpt3.Handler {
+			return func(ctx context.Context, call *gpt3.Call) error {
+				events = append(events, name+" before")
+				err := next(ctx, call)
+				events = append(events, name+" after")
+				observed = call
+				return err
+			}
+		}
+	}
+
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient),
+		gpt3.WithMiddleware(record("first")), gpt3.WithMiddleware(record("second")))
+	rsp, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "chatcmpl-123", rsp.ID)
+
+	assert.Equal(t, []string{"first before", "second before", "second after", "first after"}, events)
+	assert.Equal(t, gpt3.OperationChatCompletion, observed.Operation)
+	assert.Equal(t, gpt3.GPT3Dot5Turbo, observed.Request.(*gpt3.ChatCompletionRequest).Model)
+	assert.Equal(t, 200, observed.HTTPResponse.StatusCode)
+	assert.Equal(t, 7, observed.Response.(*gpt3.ChatCompletionResponse).Usage.TotalTokens)
+}
+
+func TestMiddlewareModifiesRequest(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{}`)),
+	}, nil)
+
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient), gpt3.WithMiddleware(
+		func(next gpt3.Handler) gpt3.Handler {
+			return func(ctx context.Context, call *gpt3.Call) error {
+				call.Request.(*gpt3.EmbeddingsRequest).User = "hashed-user"
+				call.HTTPRequest.Header.Set("X-Test", "yes")
+				return next(ctx, call)
+			}
+		},
+	))
+	_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Input: []string{"hello"}})
+	assert.NoError(t, err)
+
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "yes", req.Header.Get("X-Test"))
+	var sent gpt3.EmbeddingsRequest
+	assert.NoError(t, json.NewDecoder(req.Body).Decode(&sent))
+	assert.Equal(t, "hashed-user", sent.User)
+}
+
+func TestMiddlewareShortCircuits(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient), gpt3.WithMiddleware(
+		func(next gpt3.Handler) gpt3.Handler {
+			return func(ctx context.Context, call *gpt3.Call) error {
+				if call.Operation == gpt3.OperationModeration {
+					return errors.New("blocked")
+				}
+				return json.Unmarshal([]byte(`{"id":"cached"}`), call.Response)
+			}
+		},
+	))
+
+	rsp, err := client.Completion(context.Background(), gpt3.CompletionRequest{})
+	assert.NoError(t, err)
+	assert.Equal(t, "cached", rsp.ID)
+
+	_, err = client.Moderation(context.Background(), gpt3.ModerationRequest{})
+	assert.EqualError(t, err, "blocked")
+	assert.Equal(t, 0, rt.RoundTripCallCount())
+}
+
+func TestMiddlewareWrapsStream(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Body: ioutil.NopCloser(bytes.NewBufferString(
+			"data: {\"choices\":[{\"delta\":{\"content\":\"a\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"b\"}}]}\n\n" +
+				"data: [DONE]\n\n")),
+	}, nil)
+
+	chunks := 0
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient), gpt3.WithMiddleware(
+		func(next gpt3.Handler) gpt3.Handler {
+			return func(ctx context.Context, call *gpt3.Call) error {
+				assert.True(t, call.Stream())
+				onData := call.OnStreamData
+				call.OnStreamData = func(chunk interface{}) error {
+					chunks++
+					return onData(chunk)
+				}
+				return next(ctx, call)
+			}
+		},
+	))
+
+	var content string
+	err := client.ChatCompletionStream(context.Background(), gpt3.ChatCompletionRequest{},
+		func(rsp *gpt3.ChatCompletionStreamResponse) error {
+			content += rsp.Choices[0].Delta.Content
+			return nil
+		})
+	assert.NoError(t, err)
+	assert.Equal(t, "ab", content)
+	assert.Equal(t, 2, chunks)
+}
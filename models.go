@@ -1,7 +1,12 @@
 package gpt3
 
 import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
 	"strconv"
 	"time"
@@ -127,8 +132,12 @@ type ChatCompletionRequest struct {
 // CompletionRequest is a request for the completions API
 type CompletionRequest struct {
 	// A list of string prompts to use.
-	// TODO there are other prompt types here for using token integers that we could add support for.
 	Prompt []string `json:"prompt"`
+	// PromptTokens are prompts that are already tokenized, one token array per prompt. When set,
+	// they are sent as the prompt instead of Prompt.
+	PromptTokens [][]int `json:"-"`
+	// The suffix that comes after a completion of inserted text.
+	Suffix string `json:"suffix,omitempty"`
 	// How many tokens to complete up to. Max of 512
 	MaxTokens *int `json:"max_tokens,omitempty"`
 	// Sampling temperature to use
@@ -136,23 +145,84 @@ type CompletionRequest struct {
 	// Alternative to temperature for nucleus sampling
 	TopP *float32 `json:"top_p,omitempty"`
 	// How many choice to create for each prompt
-	N *int `json:"n"`
+	N *int `json:"n,omitempty"`
 	// Include the probabilities of most likely tokens
-	LogProbs *int `json:"logprobs"`
+	LogProbs *int `json:"logprobs,omitempty"`
 	// Echo back the prompt in addition to the completion
-	Echo bool `json:"echo"`
+	Echo bool `json:"echo,omitempty"`
 	// Up to 4 sequences where the API will stop generating tokens. Response will not contain the stop sequence.
 	Stop []string `json:"stop,omitempty"`
 	// PresencePenalty number between 0 and 1 that penalizes tokens that have already appeared in the text so far.
-	PresencePenalty float32 `json:"presence_penalty"`
+	PresencePenalty float32 `json:"presence_penalty,omitempty"`
 	// FrequencyPenalty number between 0 and 1 that penalizes tokens on existing frequency in the text so far.
-	FrequencyPenalty float32 `json:"frequency_penalty"`
+	FrequencyPenalty float32 `json:"frequency_penalty,omitempty"`
+	// BestOf generates this many completions server-side and returns the N with the highest log
+	// probability per token. It must be greater than N and can't be used when streaming.
+	BestOf *int `json:"best_of,omitempty"`
+	// Modify the probability of specific tokens, by token ID, appearing in the completion.
+	LogitBias map[string]float32 `json:"logit_bias,omitempty"`
+	// Can be used to identify an end-user
+	User string `json:"user,omitempty"`
+	// Seed makes sampling deterministic on a best-effort basis: repeated requests with the same
+	// seed and parameters should return the same result. A pointer, as 0 is a valid seed.
+	Seed *int `json:"seed,omitempty"`
 
 	// Whether to stream back results or not. Don't set this value in the request yourself
 	// as it will be overriden depending on if you use CompletionStream or Completion methods.
 	Stream bool `json:"stream,omitempty"`
 }
 
+// MarshalJSON sends PromptTokens as the prompt when they are set.
+func (r CompletionRequest) MarshalJSON() ([]byte, error) {
+	type completionRequest CompletionRequest
+	if r.PromptTokens == nil {
+		return json.Marshal(completionRequest(r))
+	}
+	return json.Marshal(struct {
+		completionRequest
+		Prompt [][]int `json:"prompt"`
+	}{completionRequest(r), r.PromptTokens})
+}
+
+// UnmarshalJSON accepts every form of prompt: a string, an array of strings, a token array, or an
+// array of token arrays.
+func (r *CompletionRequest) UnmarshalJSON(data []byte) error {
+	type completionRequest CompletionRequest
+	var request struct {
+		completionRequest
+		Prompt json.RawMessage `json:"prompt"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return err
+	}
+	*r = CompletionRequest(request.completionRequest)
+	if len(request.Prompt) == 0 || string(request.Prompt) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(request.Prompt, &text); err == nil {
+		r.Prompt = []string{text}
+		return nil
+	}
+	var texts []string
+	if err := json.Unmarshal(request.Prompt, &texts); err == nil {
+		r.Prompt = texts
+		return nil
+	}
+	var tokens []int
+	if err := json.Unmarshal(request.Prompt, &tokens); err == nil {
+		r.PromptTokens = [][]int{tokens}
+		return nil
+	}
+	var tokenArrays [][]int
+	if err := json.Unmarshal(request.Prompt, &tokenArrays); err != nil {
+		return fmt.Errorf("invalid completion prompt: %s", request.Prompt)
+	}
+	r.PromptTokens = tokenArrays
+	return nil
+}
+
 // EditsRequest is a request for the edits API
 type EditsRequest struct {
 	// ID of the model to use. You can use the List models API to see all of your available models, or see our Model overview for descriptions of them.
@@ -175,8 +245,17 @@ type EmbeddingsRequest struct {
 	// for multiple inputs in a single request, pass an array of strings or array of token arrays.
 	// Each input must not exceed 2048 tokens in length.
 	Input []string `json:"input"`
+	// InputTokens are inputs that are already tokenized, one token array per input. When set, they
+	// are sent as the input instead of Input.
+	InputTokens [][]int `json:"-"`
 	// ID of the model to use
 	Model string `json:"model"`
+	// Dimensions is the number of dimensions of the embeddings, for models that support shortening
+	// them such as TextEmbedding3Small. Zero means the model's default.
+	Dimensions int `json:"dimensions,omitempty"`
+	// EncodingFormat is EmbeddingEncodingFloat or EmbeddingEncodingBase64. Either way the results
+	// are decoded into EmbeddingsResult.Embedding. Client.Embeddings defaults to base64.
+	EncodingFormat string `json:"encoding_format,omitempty"`
 	// The request user is an optional parameter meant to be used to trace abusive requests
 	// back to the originating user. OpenAI states:
 	// "The [user] IDs should be a string that uniquely identifies each user. We recommend hashing
@@ -186,6 +265,57 @@ type EmbeddingsRequest struct {
 	User string `json:"user,omitempty"`
 }
 
+// MarshalJSON sends InputTokens as the input when they are set.
+func (r EmbeddingsRequest) MarshalJSON() ([]byte, error) {
+	type embeddingsRequest EmbeddingsRequest
+	if r.InputTokens == nil {
+		return json.Marshal(embeddingsRequest(r))
+	}
+	return json.Marshal(struct {
+		embeddingsRequest
+		Input [][]int `json:"input"`
+	}{embeddingsRequest(r), r.InputTokens})
+}
+
+// UnmarshalJSON accepts every form of input: a string, an array of strings, a token array, or an
+// array of token arrays.
+func (r *EmbeddingsRequest) UnmarshalJSON(data []byte) error {
+	type embeddingsRequest EmbeddingsRequest
+	var request struct {
+		embeddingsRequest
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return err
+	}
+	*r = EmbeddingsRequest(request.embeddingsRequest)
+	if len(request.Input) == 0 || string(request.Input) == "null" {
+		return nil
+	}
+
+	var text string
+	if err := json.Unmarshal(request.Input, &text); err == nil {
+		r.Input = []string{text}
+		return nil
+	}
+	var texts []string
+	if err := json.Unmarshal(request.Input, &texts); err == nil {
+		r.Input = texts
+		return nil
+	}
+	var tokens []int
+	if err := json.Unmarshal(request.Input, &tokens); err == nil {
+		r.InputTokens = [][]int{tokens}
+		return nil
+	}
+	var tokenArrays [][]int
+	if err := json.Unmarshal(request.Input, &tokenArrays); err != nil {
+		return fmt.Errorf("invalid embeddings input: %s", request.Input)
+	}
+	r.InputTokens = tokenArrays
+	return nil
+}
+
 // LogprobResult represents logprob result of Choice
 type LogprobResult struct {
 	Tokens        []string             `json:"tokens"`
@@ -283,10 +413,44 @@ type EmbeddingsResult struct {
 	// The type of object returned (e.g., "list", "object")
 	Object string `json:"object"`
 	// The embedding data for the input
-	Embedding []float64 `json:"embedding"`
+	Embedding []float32 `json:"embedding"`
 	Index     int       `json:"index"`
 }
 
+// UnmarshalJSON decodes the embedding from either an array of floats or a base64 string of
+// little-endian float32 values, as returned for EmbeddingEncodingBase64.
+func (r *EmbeddingsResult) UnmarshalJSON(data []byte) error {
+	type embeddingsResult EmbeddingsResult
+	var result struct {
+		embeddingsResult
+		Embedding json.RawMessage `json:"embedding"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	*r = EmbeddingsResult(result.embeddingsResult)
+	if len(result.Embedding) == 0 || result.Embedding[0] != '"' {
+		return json.Unmarshal(result.Embedding, &r.Embedding)
+	}
+
+	var encoded string
+	if err := json.Unmarshal(result.Embedding, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("invalid base64 embedding: %w", err)
+	}
+	if len(decoded)%4 != 0 {
+		return fmt.Errorf("invalid base64 embedding: %d bytes is not a whole number of float32 values", len(decoded))
+	}
+	r.Embedding = make([]float32, len(decoded)/4)
+	for i := range r.Embedding {
+		r.Embedding[i] = math.Float32frombits(binary.LittleEndian.Uint32(decoded[i*4:]))
+	}
+	return nil
+}
+
 // The usage stats for an embeddings response
 type EmbeddingsUsage struct {
 	// The number of tokens used by the prompt
@@ -338,33 +502,270 @@ type SearchResponse struct {
 
 // ModerationRequest is a request for the moderation API.
 type ModerationRequest struct {
-	// Input is the input text that should be classified. Required.
+	// Input is the input text that should be classified. Required unless Inputs or
+	// MultiModalInput is set.
 	Input string `json:"input"`
+	// Inputs are several texts to classify in a single request, with a result for each. When set,
+	// they are sent as the input instead of Input.
+	Inputs []string `json:"-"`
+	// MultiModalInput is a single input of text and images, classified together, which the omni
+	// moderation models support. When set, it is sent as the input instead of Input and Inputs.
+	MultiModalInput []ModerationInput `json:"-"`
 	// Model is the content moderation model to use. If not specified, will default to OpenAI API defaults, which is
 	// currently "text-moderation-latest".
 	Model string `json:"model,omitempty"`
 }
 
+// ModerationInput is a part of a multi-modal moderation input: either text or an image.
+type ModerationInput struct {
+	// Type is "text" or "image_url".
+	Type string `json:"type"`
+	// Text is the text of a text part.
+	Text string `json:"text,omitempty"`
+	// ImageURL is the image of an image part.
+	ImageURL *ModerationImageURL `json:"image_url,omitempty"`
+}
+
+// ModerationImageURL is an image to classify, by url or as a base64 encoded data url.
+type ModerationImageURL struct {
+	URL string `json:"url"`
+}
+
+// ModerationText returns a text part of a multi-modal moderation input.
+func ModerationText(text string) ModerationInput {
+	return ModerationInput{Type: "text", Text: text}
+}
+
+// ModerationImage returns an image part of a multi-modal moderation input, with url either the
+// url of the image or a data url, e.g. "data:image/jpeg;base64,...".
+func ModerationImage(url string) ModerationInput {
+	return ModerationInput{Type: "image_url", ImageURL: &ModerationImageURL{URL: url}}
+}
+
+// MarshalJSON sends MultiModalInput or Inputs as the input when they are set.
+func (r ModerationRequest) MarshalJSON() ([]byte, error) {
+	type moderationRequest ModerationRequest
+	var input interface{}
+	switch {
+	case r.MultiModalInput != nil:
+		input = r.MultiModalInput
+	case r.Inputs != nil:
+		input = r.Inputs
+	default:
+		return json.Marshal(moderationRequest(r))
+	}
+	return json.Marshal(struct {
+		moderationRequest
+		Input interface{} `json:"input"`
+	}{moderationRequest(r), input})
+}
+
+// UnmarshalJSON accepts every form of input: a string, an array of strings, or an array of
+// multi-modal input parts.
+func (r *ModerationRequest) UnmarshalJSON(data []byte) error {
+	type moderationRequest ModerationRequest
+	var request struct {
+		moderationRequest
+		Input json.RawMessage `json:"input"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return err
+	}
+	*r = ModerationRequest(request.moderationRequest)
+	if len(request.Input) == 0 || string(request.Input) == "null" {
+		return nil
+	}
+
+	if err := json.Unmarshal(request.Input, &r.Input); err == nil {
+		return nil
+	}
+	var texts []string
+	if err := json.Unmarshal(request.Input, &texts); err == nil {
+		r.Inputs = texts
+		return nil
+	}
+	var parts []ModerationInput
+	if err := json.Unmarshal(request.Input, &parts); err != nil {
+		return fmt.Errorf("invalid moderation input: %s", request.Input)
+	}
+	r.MultiModalInput = parts
+	return nil
+}
+
+// Moderation categories, as named in the results of the moderation API.
+const (
+	ModerationHarassment            = "harassment"
+	ModerationHarassmentThreatening = "harassment/threatening"
+	ModerationHate                  = "hate"
+	ModerationHateThreatening       = "hate/threatening"
+	ModerationIllicit               = "illicit"
+	ModerationIllicitViolent        = "illicit/violent"
+	ModerationSelfHarm              = "self-harm"
+	ModerationSelfHarmIntent        = "self-harm/intent"
+	ModerationSelfHarmInstructions  = "self-harm/instructions"
+	ModerationSexual                = "sexual"
+	ModerationSexualMinors          = "sexual/minors"
+	ModerationViolence              = "violence"
+	ModerationViolenceGraphic       = "violence/graphic"
+)
+
 // ModerationCategoryResult shows the categories that the moderation classifier flagged the input text for.
 type ModerationCategoryResult struct {
-	Hate            bool `json:"hate"`
-	HateThreatening bool `json:"hate/threatening"`
-	SelfHarm        bool `json:"self-harm"`
-	Sexual          bool `json:"sexual"`
-	SexualMinors    bool `json:"sexual/minors"`
-	Violence        bool `json:"violence"`
-	ViolenceGraphic bool `json:"violence/graphic"`
+	Harassment            bool `json:"harassment"`
+	HarassmentThreatening bool `json:"harassment/threatening"`
+	Hate                  bool `json:"hate"`
+	HateThreatening       bool `json:"hate/threatening"`
+	Illicit               bool `json:"illicit"`
+	IllicitViolent        bool `json:"illicit/violent"`
+	SelfHarm              bool `json:"self-harm"`
+	SelfHarmIntent        bool `json:"self-harm/intent"`
+	SelfHarmInstructions  bool `json:"self-harm/instructions"`
+	Sexual                bool `json:"sexual"`
+	SexualMinors          bool `json:"sexual/minors"`
+	Violence              bool `json:"violence"`
+	ViolenceGraphic       bool `json:"violence/graphic"`
+	// Other holds the categories of the response that have no field yet.
+	Other map[string]bool `json:"-"`
+}
+
+func (r *ModerationCategoryResult) fields() map[string]*bool {
+	return map[string]*bool{
+		ModerationHarassment:            &r.Harassment,
+		ModerationHarassmentThreatening: &r.HarassmentThreatening,
+		ModerationHate:                  &r.Hate,
+		ModerationHateThreatening:       &r.HateThreatening,
+		ModerationIllicit:               &r.Illicit,
+		ModerationIllicitViolent:        &r.IllicitViolent,
+		ModerationSelfHarm:              &r.SelfHarm,
+		ModerationSelfHarmIntent:        &r.SelfHarmIntent,
+		ModerationSelfHarmInstructions:  &r.SelfHarmInstructions,
+		ModerationSexual:                &r.Sexual,
+		ModerationSexualMinors:          &r.SexualMinors,
+		ModerationViolence:              &r.Violence,
+		ModerationViolenceGraphic:       &r.ViolenceGraphic,
+	}
+}
+
+// Map returns whether the input was flagged for each category, including those in Other.
+func (r ModerationCategoryResult) Map() map[string]bool {
+	fields := r.fields()
+	categories := make(map[string]bool, len(fields)+len(r.Other))
+	for category, flagged := range r.Other {
+		categories[category] = flagged
+	}
+	for category, flagged := range fields {
+		categories[category] = *flagged
+	}
+	return categories
+}
+
+// MarshalJSON encodes the categories of the fields and of Other.
+func (r ModerationCategoryResult) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.Map())
+}
+
+// UnmarshalJSON decodes the categories into their fields, and those without a field into Other.
+// Categories that are null, as the older models report those they don't classify, are false.
+func (r *ModerationCategoryResult) UnmarshalJSON(data []byte) error {
+	var categories map[string]*bool
+	if err := json.Unmarshal(data, &categories); err != nil {
+		return err
+	}
+	*r = ModerationCategoryResult{}
+	fields := r.fields()
+	for category, flagged := range categories {
+		if flagged == nil {
+			continue
+		}
+		if field, ok := fields[category]; ok {
+			*field = *flagged
+			continue
+		}
+		if r.Other == nil {
+			r.Other = make(map[string]bool)
+		}
+		r.Other[category] = *flagged
+	}
+	return nil
 }
 
 // ModerationCategoryScores shows the classifier scores for each moderation category.
 type ModerationCategoryScores struct {
-	Hate            float32 `json:"hate"`
-	HateThreatening float32 `json:"hate/threatening"`
-	SelfHarm        float32 `json:"self-harm"`
-	Sexual          float32 `json:"sexual"`
-	SexualMinors    float32 `json:"sexual/minors"`
-	Violence        float32 `json:"violence"`
-	ViolenceGraphic float32 `json:"violence/graphic"`
+	Harassment            float32 `json:"harassment"`
+	HarassmentThreatening float32 `json:"harassment/threatening"`
+	Hate                  float32 `json:"hate"`
+	HateThreatening       float32 `json:"hate/threatening"`
+	Illicit               float32 `json:"illicit"`
+	IllicitViolent        float32 `json:"illicit/violent"`
+	SelfHarm              float32 `json:"self-harm"`
+	SelfHarmIntent        float32 `json:"self-harm/intent"`
+	SelfHarmInstructions  float32 `json:"self-harm/instructions"`
+	Sexual                float32 `json:"sexual"`
+	SexualMinors          float32 `json:"sexual/minors"`
+	Violence              float32 `json:"violence"`
+	ViolenceGraphic       float32 `json:"violence/graphic"`
+	// Other holds the scores of the categories of the response that have no field yet.
+	Other map[string]float32 `json:"-"`
+}
+
+func (s *ModerationCategoryScores) fields() map[string]*float32 {
+	return map[string]*float32{
+		ModerationHarassment:            &s.Harassment,
+		ModerationHarassmentThreatening: &s.HarassmentThreatening,
+		ModerationHate:                  &s.Hate,
+		ModerationHateThreatening:       &s.HateThreatening,
+		ModerationIllicit:               &s.Illicit,
+		ModerationIllicitViolent:        &s.IllicitViolent,
+		ModerationSelfHarm:              &s.SelfHarm,
+		ModerationSelfHarmIntent:        &s.SelfHarmIntent,
+		ModerationSelfHarmInstructions:  &s.SelfHarmInstructions,
+		ModerationSexual:                &s.Sexual,
+		ModerationSexualMinors:          &s.SexualMinors,
+		ModerationViolence:              &s.Violence,
+		ModerationViolenceGraphic:       &s.ViolenceGraphic,
+	}
+}
+
+// Map returns the score of each category, including those in Other.
+func (s ModerationCategoryScores) Map() map[string]float32 {
+	fields := s.fields()
+	scores := make(map[string]float32, len(fields)+len(s.Other))
+	for category, score := range s.Other {
+		scores[category] = score
+	}
+	for category, score := range fields {
+		scores[category] = *score
+	}
+	return scores
+}
+
+// MarshalJSON encodes the scores of the fields and of Other.
+func (s ModerationCategoryScores) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Map())
+}
+
+// UnmarshalJSON decodes the scores into their fields, and those without a field into Other.
+func (s *ModerationCategoryScores) UnmarshalJSON(data []byte) error {
+	var scores map[string]*float32
+	if err := json.Unmarshal(data, &scores); err != nil {
+		return err
+	}
+	*s = ModerationCategoryScores{}
+	fields := s.fields()
+	for category, score := range scores {
+		if score == nil {
+			continue
+		}
+		if field, ok := fields[category]; ok {
+			*field = *score
+			continue
+		}
+		if s.Other == nil {
+			s.Other = make(map[string]float32)
+		}
+		s.Other[category] = *score
+	}
+	return nil
 }
 
 // ModerationResult represents a single moderation classification result returned by the moderation API.
@@ -372,9 +773,13 @@ type ModerationResult struct {
 	Flagged        bool                     `json:"flagged"`
 	Categories     ModerationCategoryResult `json:"categories"`
 	CategoryScores ModerationCategoryScores `json:"category_scores"`
+	// CategoryAppliedInputTypes lists, for each category, the types of input it was applied to:
+	// "text", "image" or both. Only the omni moderation models report it.
+	CategoryAppliedInputTypes map[string][]string `json:"category_applied_input_types,omitempty"`
 }
 
-// ModerationResponse is the full response from a request to the moderation API.
+// ModerationResponse is the full response from a request to the moderation API. It has a result for
+// each input, in order.
 type ModerationResponse struct {
 	ID      string             `json:"id"`
 	Model   string             `json:"model"`
@@ -432,3 +837,45 @@ func NewRateLimitHeadersFromResponse(resp *http.Response) RateLimitHeaders {
 
 	return rateLimitHeaders
 }
+
+// RawResponse is the HTTP response of a call, captured with the WithRawResponse request option.
+type RawResponse struct {
+	StatusCode int
+	Header     http.Header
+
+	// RequestID is the x-request-id header, which OpenAI support can use to find the request.
+	RequestID string
+
+	// ProcessingTime is the openai-processing-ms header: the time the API spent processing the request.
+	ProcessingTime time.Duration
+
+	RateLimitHeaders RateLimitHeaders
+
+	// Body is the raw response body. For streaming calls it holds the server-sent events read so far.
+	Body []byte
+}
+
+// capture records the response metadata and wraps its body to record the bytes as they are read.
+func (r *RawResponse) capture(resp *http.Response) {
+	r.StatusCode = resp.StatusCode
+	r.Header = resp.Header
+	r.RequestID = resp.Header.Get("X-Request-Id")
+	r.ProcessingTime = 0
+	if ms, err := strconv.Atoi(resp.Header.Get("Openai-Processing-Ms")); err == nil {
+		r.ProcessingTime = time.Duration(ms) * time.Millisecond
+	}
+	r.RateLimitHeaders = NewRateLimitHeadersFromResponse(resp)
+	r.Body = nil
+	resp.Body = &capturingBody{ReadCloser: resp.Body, raw: r}
+}
+
+type capturingBody struct {
+	io.ReadCloser
+	raw *RawResponse
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.raw.Body = append(b.raw.Body, p[:n]...)
+	return n, err
+}
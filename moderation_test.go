@@ -0,0 +1,109 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModerationInputs(t *testing.T) {
+	for name, tc := range map[string]struct {
+		request gpt3.ModerationRequest
+		json    string
+	}{
+		"text": {
+			gpt3.ModerationRequest{Input: "hi"},
+			`{"input":"hi"}`,
+		},
+		"texts": {
+			gpt3.ModerationRequest{Inputs: []string{"a", "b"}, Model: gpt3.TextModerationStable},
+			`{"input":["a","b"],"model":"text-moderation-stable"}`,
+		},
+		"multi-modal": {
+			gpt3.ModerationRequest{
+				MultiModalInput: []gpt3.ModerationInput{
+					gpt3.ModerationText("look at this"),
+					gpt3.ModerationImage("https://example.com/image.png"),
+				},
+				Model: gpt3.OmniModerationLatest,
+			},
+			`{"input":[{"type":"text","text":"look at this"},{"type":"image_url","image_url":{"url":"https://example.com/image.png"}}],"model":"omni-moderation-latest"}`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := json.Marshal(tc.request)
+			assert.NoError(t, err)
+			assert.JSONEq(t, tc.json, string(data))
+
+			var request gpt3.ModerationRequest
+			assert.NoError(t, json.Unmarshal(data, &request))
+			assert.Equal(t, tc.request, request)
+		})
+	}
+
+	var request gpt3.ModerationRequest
+	assert.EqualError(t, json.Unmarshal([]byte(`{"input":[1]}`), &request), "invalid moderation input: [1]")
+}
+
+func TestModerationCategories(t *testing.T) {
+	body := `{
+		"id": "modr-1",
+		"model": "omni-moderation-latest",
+		"results": [{
+			"flagged": true,
+			"categories": {
+				"harassment": true,
+				"illicit": null,
+				"self-harm/intent": true,
+				"violence": false,
+				"new-category": true
+			},
+			"category_scores": {
+				"harassment": 0.9,
+				"self-harm/intent": 0.75,
+				"violence": 0.01,
+				"new-category": 0.5
+			},
+			"category_applied_input_types": {
+				"harassment": ["text"],
+				"violence": ["text", "image"]
+			}
+		}]
+	}`
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{StatusCode: 200, Body: ioutil.NopCloser(bytes.NewBufferString(body))}, nil)
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient))
+
+	rsp, err := client.Moderation(context.Background(), gpt3.ModerationRequest{Input: "hi"})
+	assert.NoError(t, err)
+	result := rsp.Results[0]
+	assert.True(t, result.Categories.Harassment)
+	assert.True(t, result.Categories.SelfHarmIntent)
+	assert.False(t, result.Categories.Illicit)
+	assert.Equal(t, map[string]bool{"new-category": true}, result.Categories.Other)
+	assert.Equal(t, float32(0.75), result.CategoryScores.SelfHarmIntent)
+	assert.Equal(t, map[string]float32{"new-category": 0.5}, result.CategoryScores.Other)
+	assert.Equal(t, []string{"text", "image"}, result.CategoryAppliedInputTypes[gpt3.ModerationViolence])
+
+	categories := result.Categories.Map()
+	assert.Len(t, categories, 14)
+	assert.True(t, categories["new-category"])
+	assert.True(t, categories[gpt3.ModerationHarassment])
+	assert.False(t, categories[gpt3.ModerationViolenceGraphic])
+	scores := result.CategoryScores.Map()
+	assert.Equal(t, float32(0.9), scores[gpt3.ModerationHarassment])
+	assert.Equal(t, float32(0.5), scores["new-category"])
+
+	// categories without a field survive a round trip
+	data, err := json.Marshal(result)
+	assert.NoError(t, err)
+	var decoded gpt3.ModerationResult
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, result, decoded)
+}
@@ -0,0 +1,290 @@
+// Package otel traces go-gpt3 client calls with OpenTelemetry, recording attributes from the
+// OpenTelemetry semantic conventions for generative AI systems.
+//
+// Every call made through a client configured with WithTracing creates a client span named after
+// the operation and model, e.g. "chat gpt-3.5-turbo". Streaming calls are traced for their full
+// duration and additionally record the time to the first streamed chunk.
+package otel
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/PullRequestInc/go-gpt3/otel"
+
+// Attribute keys recorded on spans. The gen_ai keys follow the OpenTelemetry semantic conventions
+// for generative AI systems.
+const (
+	AttrSystem                 = attribute.Key("gen_ai.system")
+	AttrOperationName          = attribute.Key("gen_ai.operation.name")
+	AttrRequestModel           = attribute.Key("gen_ai.request.model")
+	AttrRequestMaxTokens       = attribute.Key("gen_ai.request.max_tokens")
+	AttrRequestTemperature     = attribute.Key("gen_ai.request.temperature")
+	AttrRequestTopP            = attribute.Key("gen_ai.request.top_p")
+	AttrResponseID             = attribute.Key("gen_ai.response.id")
+	AttrResponseModel          = attribute.Key("gen_ai.response.model")
+	AttrResponseFinishReasons  = attribute.Key("gen_ai.response.finish_reasons")
+	AttrUsageInputTokens       = attribute.Key("gen_ai.usage.input_tokens")
+	AttrUsageOutputTokens      = attribute.Key("gen_ai.usage.output_tokens")
+	AttrTimeToFirstToken       = attribute.Key("gen_ai.response.time_to_first_token")
+	AttrErrorType              = attribute.Key("error.type")
+	AttrHTTPStatusCode         = attribute.Key("http.response.status_code")
+	AttrRequestID              = attribute.Key("openai.request.id")
+	AttrRateLimitRemainingReqs = attribute.Key("openai.ratelimit.remaining_requests")
+	AttrRateLimitRemainingToks = attribute.Key("openai.ratelimit.remaining_tokens")
+)
+
+type config struct {
+	tracerProvider trace.TracerProvider
+}
+
+// Option configures the tracing middleware.
+type Option func(*config)
+
+// WithTracerProvider sets the TracerProvider used to create spans. The global provider is used by default.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithTracing is a client option that traces every call made by the client.
+func WithTracing(opts ...Option) gpt3.ClientOption {
+	return gpt3.WithMiddleware(Middleware(opts...))
+}
+
+// Middleware returns a gpt3.Middleware that creates a span for every call.
+func Middleware(opts ...Option) gpt3.Middleware {
+	cfg := config{tracerProvider: otel.GetTracerProvider()}
+	for _, o := range opts {
+		o(&cfg)
+	}
+	tracer := cfg.tracerProvider.Tracer(instrumentationName)
+
+	return func(next gpt3.Handler) gpt3.Handler {
+		return func(ctx context.Context, call *gpt3.Call) error {
+			operation, model, attrs := requestAttributes(call)
+			name := operation
+			if model != "" {
+				name += " " + model
+			}
+			ctx, span := tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+			defer span.End()
+
+			var stream *streamRecorder
+			if call.Stream() {
+				stream = &streamRecorder{span: span, start: time.Now(), onData: call.OnStreamData}
+				call.OnStreamData = stream.record
+			}
+
+			err := next(ctx, call)
+
+			if call.HTTPResponse != nil {
+				span.SetAttributes(AttrHTTPStatusCode.Int(call.HTTPResponse.StatusCode))
+				if id := call.HTTPResponse.Header.Get("X-Request-Id"); id != "" {
+					span.SetAttributes(AttrRequestID.String(id))
+				}
+				span.SetAttributes(rateLimitAttributes(gpt3.NewRateLimitHeadersFromResponse(call.HTTPResponse))...)
+			}
+			if stream != nil {
+				span.SetAttributes(stream.attributes()...)
+			} else if err == nil {
+				span.SetAttributes(responseAttributes(call.Response)...)
+			}
+			if err != nil {
+				var apiErr gpt3.APIError
+				if errors.As(err, &apiErr) {
+					span.SetAttributes(AttrHTTPStatusCode.Int(apiErr.StatusCode))
+					span.SetAttributes(rateLimitAttributes(apiErr.RateLimitHeaders)...)
+				}
+				span.SetAttributes(AttrErrorType.String(errorType(err)))
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		}
+	}
+}
+
+// requestAttributes returns the semantic-convention operation name, the requested model and the
+// span attributes describing the request.
+func requestAttributes(call *gpt3.Call) (string, string, []attribute.KeyValue) {
+	operation, model := call.Operation, ""
+	var attrs []attribute.KeyValue
+
+	switch r := call.Request.(type) {
+	case *gpt3.ChatCompletionRequest:
+		operation, model = "chat", r.Model
+		if r.MaxTokens > 0 {
+			attrs = append(attrs, AttrRequestMaxTokens.Int(r.MaxTokens))
+		}
+		if r.Temperature != nil {
+			attrs = append(attrs, AttrRequestTemperature.Float64(float64(*r.Temperature)))
+		}
+		if r.TopP > 0 {
+			attrs = append(attrs, AttrRequestTopP.Float64(float64(r.TopP)))
+		}
+	case *gpt3.CompletionRequest:
+		operation, model = "text_completion", call.Model()
+		if r.MaxTokens != nil {
+			attrs = append(attrs, AttrRequestMaxTokens.Int(*r.MaxTokens))
+		}
+		if r.Temperature != nil {
+			attrs = append(attrs, AttrRequestTemperature.Float64(float64(*r.Temperature)))
+		}
+		if r.TopP != nil {
+			attrs = append(attrs, AttrRequestTopP.Float64(float64(*r.TopP)))
+		}
+	case *gpt3.EmbeddingsRequest:
+		operation, model = "embeddings", r.Model
+	case *gpt3.ModerationRequest:
+		operation, model = "moderation", r.Model
+	case *gpt3.EditsRequest:
+		operation, model = "edits", r.Model
+	}
+
+	attrs = append(attrs, AttrSystem.String("openai"), AttrOperationName.String(operation))
+	if model != "" {
+		attrs = append(attrs, AttrRequestModel.String(model))
+	}
+	return operation, model, attrs
+}
+
+// responseAttributes returns the span attributes describing a decoded response.
+func responseAttributes(response interface{}) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	switch r := response.(type) {
+	case *gpt3.ChatCompletionResponse:
+		reasons := make([]string, 0, len(r.Choices))
+		for _, choice := range r.Choices {
+			reasons = append(reasons, choice.FinishReason)
+		}
+		attrs = append(attrs,
+			AttrResponseID.String(r.ID),
+			AttrResponseModel.String(r.Model),
+			AttrResponseFinishReasons.StringSlice(reasons),
+			AttrUsageInputTokens.Int(r.Usage.PromptTokens),
+			AttrUsageOutputTokens.Int(r.Usage.CompletionTokens),
+		)
+	case *gpt3.CompletionResponse:
+		reasons := make([]string, 0, len(r.Choices))
+		for _, choice := range r.Choices {
+			reasons = append(reasons, choice.FinishReason)
+		}
+		attrs = append(attrs,
+			AttrResponseID.String(r.ID),
+			AttrResponseModel.String(r.Model),
+			AttrResponseFinishReasons.StringSlice(reasons),
+			AttrUsageInputTokens.Int(r.Usage.PromptTokens),
+			AttrUsageOutputTokens.Int(r.Usage.CompletionTokens),
+		)
+	case *gpt3.EmbeddingsResponse:
+		attrs = append(attrs, AttrUsageInputTokens.Int(r.Usage.PromptTokens))
+	case *gpt3.ModerationResponse:
+		attrs = append(attrs, AttrResponseID.String(r.ID), AttrResponseModel.String(r.Model))
+	}
+	return attrs
+}
+
+// rateLimitAttributes returns the remaining rate limits of a response. Limits the response has no
+// headers for, as with Azure, proxies or local servers, are left out rather than reported as 0.
+func rateLimitAttributes(headers gpt3.RateLimitHeaders) []attribute.KeyValue {
+	var attrs []attribute.KeyValue
+	if headers.LimitRequests > 0 {
+		attrs = append(attrs, AttrRateLimitRemainingReqs.Int(headers.RemainingRequests))
+	}
+	if headers.LimitTokens > 0 {
+		attrs = append(attrs, AttrRateLimitRemainingToks.Int(headers.RemainingTokens))
+	}
+	return attrs
+}
+
+// errorType returns a low-cardinality description of err for the error.type attribute.
+func errorType(err error) string {
+	var apiErr gpt3.APIError
+	switch {
+	case errors.As(err, &apiErr):
+		if apiErr.Type != "" {
+			return apiErr.Type
+		}
+		return strconv.Itoa(apiErr.StatusCode)
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	default:
+		return "_OTHER"
+	}
+}
+
+// streamRecorder observes the chunks of a streaming call to record the time to the first chunk,
+// the finish reasons and the token usage when the API reports it.
+type streamRecorder struct {
+	span   trace.Span
+	start  time.Time
+	onData func(chunk interface{}) error
+
+	chunks  int
+	id      string
+	model   string
+	reasons []string
+	input   int
+	output  int
+}
+
+func (s *streamRecorder) record(chunk interface{}) error {
+	if s.chunks == 0 {
+		ttft := time.Since(s.start)
+		s.span.AddEvent("gen_ai.first_token")
+		s.span.SetAttributes(AttrTimeToFirstToken.Float64(ttft.Seconds()))
+	}
+	s.chunks++
+
+	switch c := chunk.(type) {
+	case *gpt3.ChatCompletionStreamResponse:
+		s.id, s.model = c.ID, c.Model
+		for _, choice := range c.Choices {
+			if choice.FinishReason != "" {
+				s.reasons = append(s.reasons, choice.FinishReason)
+			}
+		}
+		if c.Usage.TotalTokens > 0 {
+			s.input, s.output = c.Usage.PromptTokens, c.Usage.CompletionTokens
+		}
+	case *gpt3.CompletionResponse:
+		s.id, s.model = c.ID, c.Model
+		for _, choice := range c.Choices {
+			if choice.FinishReason != "" {
+				s.reasons = append(s.reasons, choice.FinishReason)
+			}
+		}
+		if c.Usage.TotalTokens > 0 {
+			s.input, s.output = c.Usage.PromptTokens, c.Usage.CompletionTokens
+		}
+	}
+	return s.onData(chunk)
+}
+
+func (s *streamRecorder) attributes() []attribute.KeyValue {
+	if s.chunks == 0 {
+		return nil
+	}
+	attrs := []attribute.KeyValue{
+		AttrResponseID.String(s.id),
+		AttrResponseModel.String(s.model),
+		AttrResponseFinishReasons.StringSlice(s.reasons),
+	}
+	if s.input > 0 || s.output > 0 {
+		attrs = append(attrs, AttrUsageInputTokens.Int(s.input), AttrUsageOutputTokens.Int(s.output))
+	}
+	return attrs
+}
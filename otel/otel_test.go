@@ -0,0 +1,117 @@
+package otel_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	fakes "github.com/PullRequestInc/go-gpt3/go-gpt3fakes"
+	gpt3otel "github.com/PullRequestInc/go-gpt3/otel"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTracedClient(resp *http.Response) (gpt3.Client, *tracetest.InMemoryExporter) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	rt := &fakes.FakeRoundTripper{}
+	rt.RoundTripReturns(resp, nil)
+	client := gpt3.NewClient("test-key",
+		gpt3.WithHTTPClient(&http.Client{Transport: rt}),
+		gpt3otel.WithTracing(gpt3otel.WithTracerProvider(tp)),
+	)
+	return client, exporter
+}
+
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestChatCompletionSpan(t *testing.T) {
+	header := make(http.Header)
+	header.Set("x-request-id", "req-123")
+	header.Set("x-ratelimit-limit-requests", "60")
+	header.Set("x-ratelimit-remaining-requests", "59")
+	header.Set("x-ratelimit-limit-tokens", "150000")
+	header.Set("x-ratelimit-remaining-tokens", "149984")
+	client, exporter := newTracedClient(&http.Response{
+		StatusCode: 200,
+		Header:     header,
+		Body: ioutil.NopCloser(bytes.NewBufferString(`{"id":"chatcmpl-123","model":"gpt-3.5-turbo-0613",
+			"choices":[{"finish_reason":"stop"}],"usage":{"prompt_tokens":5,"completion_tokens":7,"total_tokens":12}}`)),
+	})
+
+	_, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{MaxTokens: 20})
+	assert.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "chat gpt-3.5-turbo", spans[0].Name)
+	attrs := attributes(spans[0])
+	assert.Equal(t, "openai", attrs[gpt3otel.AttrSystem].AsString())
+	assert.Equal(t, "gpt-3.5-turbo", attrs[gpt3otel.AttrRequestModel].AsString())
+	assert.Equal(t, int64(20), attrs[gpt3otel.AttrRequestMaxTokens].AsInt64())
+	assert.Equal(t, "gpt-3.5-turbo-0613", attrs[gpt3otel.AttrResponseModel].AsString())
+	assert.Equal(t, []string{"stop"}, attrs[gpt3otel.AttrResponseFinishReasons].AsStringSlice())
+	assert.Equal(t, int64(5), attrs[gpt3otel.AttrUsageInputTokens].AsInt64())
+	assert.Equal(t, int64(7), attrs[gpt3otel.AttrUsageOutputTokens].AsInt64())
+	assert.Equal(t, "req-123", attrs[gpt3otel.AttrRequestID].AsString())
+	assert.Equal(t, int64(59), attrs[gpt3otel.AttrRateLimitRemainingReqs].AsInt64())
+	assert.Equal(t, int64(149984), attrs[gpt3otel.AttrRateLimitRemainingToks].AsInt64())
+}
+
+func TestErrorSpan(t *testing.T) {
+	client, exporter := newTracedClient(&http.Response{
+		StatusCode: 429,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error":{"type":"rate_limit_exceeded","message":"slow down"}}`)),
+	})
+
+	_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Model: gpt3.TextEmbeddingAda002})
+	assert.Error(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "embeddings text-embedding-ada-002", spans[0].Name)
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	attrs := attributes(spans[0])
+	assert.Equal(t, "rate_limit_exceeded", attrs[gpt3otel.AttrErrorType].AsString())
+	assert.Equal(t, int64(429), attrs[gpt3otel.AttrHTTPStatusCode].AsInt64())
+	// without rate limit headers, no remaining limits are reported
+	assert.NotContains(t, attrs, gpt3otel.AttrRateLimitRemainingReqs)
+	assert.NotContains(t, attrs, gpt3otel.AttrRateLimitRemainingToks)
+}
+
+func TestStreamSpan(t *testing.T) {
+	client, exporter := newTracedClient(&http.Response{
+		StatusCode: 200,
+		Body: ioutil.NopCloser(bytes.NewBufferString(
+			"data: {\"id\":\"cmpl-1\",\"model\":\"ada\",\"choices\":[{\"text\":\"a\"}]}\n\n" +
+				"data: {\"id\":\"cmpl-1\",\"model\":\"ada\",\"choices\":[{\"text\":\"b\",\"finish_reason\":\"length\"}]}\n\n" +
+				"data: [DONE]\n\n")),
+	})
+
+	err := client.CompletionStreamWithEngine(context.Background(), gpt3.AdaEngine, gpt3.CompletionRequest{},
+		func(*gpt3.CompletionResponse) {})
+	assert.NoError(t, err)
+
+	spans := exporter.GetSpans()
+	assert.Len(t, spans, 1)
+	assert.Equal(t, "text_completion ada", spans[0].Name)
+	attrs := attributes(spans[0])
+	assert.Equal(t, []string{"length"}, attrs[gpt3otel.AttrResponseFinishReasons].AsStringSlice())
+	assert.Contains(t, attrs, gpt3otel.AttrTimeToFirstToken)
+	assert.NotContains(t, attrs, gpt3otel.AttrRateLimitRemainingReqs)
+	assert.NotContains(t, attrs, gpt3otel.AttrRateLimitRemainingToks)
+	assert.Len(t, spans[0].Events, 1)
+	assert.Equal(t, "gen_ai.first_token", spans[0].Events[0].Name)
+}
@@ -0,0 +1,334 @@
+// Package rag answers questions with retrieval-augmented generation: the chunks of text most
+// relevant to a question are fetched from a Retriever, packed into the prompt as numbered sources
+// within a token budget, and the model is asked to answer from them citing the sources it used.
+// The answer comes back with the IDs of the chunks it cites:
+//
+//	retriever := &rag.IndexRetriever{Client: client, Model: gpt3.TextEmbedding3Small, Index: index}
+//	assistant, err := rag.New(client, retriever, rag.WithTopK(8))
+//	answer, err := assistant.Ask(ctx, "How do I rotate api keys?")
+//	fmt.Println(answer.Text, answer.ChunkIDs)
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/PullRequestInc/go-gpt3/vectorstore"
+)
+
+// Defaults of an Assistant, see the Option functions.
+const (
+	DefaultModel       = gpt3.GPT3Dot5Turbo
+	DefaultTopK        = 5
+	DefaultTokenBudget = 3000
+)
+
+// DefaultSystemPrompt is the instruction given to the model unless WithSystemPrompt sets another.
+const DefaultSystemPrompt = "Answer the question using only the numbered sources provided. " +
+	"Cite the sources each statement is based on with their numbers in square brackets, like [1] or [2][3]. " +
+	"If the sources don't contain the answer, say that you don't know."
+
+// Document is a chunk of text that an answer can be grounded on.
+type Document struct {
+	// ID identifies the chunk, e.g. in the index it was retrieved from.
+	ID string
+	// Text is the text of the chunk.
+	Text string
+	// Source describes where the chunk is from, e.g. a title or url. It is shown to the model
+	// with the text if it is set.
+	Source string
+	// Score is the relevance of the chunk to the question, as reported by the retriever.
+	Score float32
+	// Metadata is any other information about the chunk.
+	Metadata map[string]string
+}
+
+// Retriever fetches the chunks most relevant to a query.
+type Retriever interface {
+	// Retrieve returns up to k documents relevant to query, from the most to the least relevant.
+	Retrieve(ctx context.Context, query string, k int) ([]Document, error)
+}
+
+// RetrieverFunc is an adapter to use a function as a Retriever.
+type RetrieverFunc func(ctx context.Context, query string, k int) ([]Document, error)
+
+// Retrieve calls f(ctx, query, k).
+func (f RetrieverFunc) Retrieve(ctx context.Context, query string, k int) ([]Document, error) {
+	return f(ctx, query, k)
+}
+
+// IndexRetriever is a Retriever that embeds the query and searches a vector index for the most
+// similar chunks. The text of each chunk must be stored in the metadata of its item.
+type IndexRetriever struct {
+	// Client creates the embedding of the query.
+	Client gpt3.Client
+	// Model is the embedding model the vectors of the index were created with.
+	Model string
+	// Dimensions is the number of dimensions of the vectors of the index, if the model was asked
+	// to shorten them, see gpt3.EmbeddingsRequest.
+	Dimensions int
+	// Index is the index that is searched.
+	Index vectorstore.Index
+	// Filter, if set, restricts the items that may be retrieved.
+	Filter vectorstore.Filter
+	// TextKey is the metadata key of the text of a chunk. Defaults to "text".
+	TextKey string
+	// SourceKey is the metadata key of the source of a chunk. Defaults to "source".
+	SourceKey string
+}
+
+// Retrieve implements Retriever.
+func (r *IndexRetriever) Retrieve(ctx context.Context, query string, k int) ([]Document, error) {
+	rsp, err := r.Client.Embeddings(ctx, gpt3.EmbeddingsRequest{
+		Input:      []string{query},
+		Model:      r.Model,
+		Dimensions: r.Dimensions,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp.Data) != 1 {
+		return nil, fmt.Errorf("embeddings response has %d results for 1 input", len(rsp.Data))
+	}
+	results, err := r.Index.Search(rsp.Data[0].Embedding, k, r.Filter)
+	if err != nil {
+		return nil, err
+	}
+	textKey, sourceKey := r.TextKey, r.SourceKey
+	if textKey == "" {
+		textKey = "text"
+	}
+	if sourceKey == "" {
+		sourceKey = "source"
+	}
+	documents := make([]Document, len(results))
+	for i, result := range results {
+		documents[i] = Document{
+			ID:       result.ID,
+			Text:     result.Metadata[textKey],
+			Source:   result.Metadata[sourceKey],
+			Score:    result.Score,
+			Metadata: result.Metadata,
+		}
+	}
+	return documents, nil
+}
+
+// Option are options that can be passed to New.
+type Option func(*Assistant) error
+
+// WithModel sets the chat model that answers questions. Defaults to DefaultModel.
+func WithModel(model string) Option {
+	return func(a *Assistant) error {
+		if model == "" {
+			return errors.New("model must not be empty")
+		}
+		a.model = model
+		return nil
+	}
+}
+
+// WithTopK sets how many chunks are retrieved for a question, which must be positive. Defaults to
+// DefaultTopK.
+func WithTopK(k int) Option {
+	return func(a *Assistant) error {
+		if k <= 0 {
+			return fmt.Errorf("top k must be positive, got %d", k)
+		}
+		a.topK = k
+		return nil
+	}
+}
+
+// WithTokenBudget sets how many tokens of the prompt the sources may take up, which must be
+// positive. Chunks that don't fit in what is left of the budget are left out. Defaults to
+// DefaultTokenBudget.
+func WithTokenBudget(tokens int) Option {
+	return func(a *Assistant) error {
+		if tokens <= 0 {
+			return fmt.Errorf("token budget must be positive, got %d", tokens)
+		}
+		a.tokenBudget = tokens
+		return nil
+	}
+}
+
+// WithTokenCounter sets the function that counts the tokens of the sources, which should be the
+// tokenizer of the model. Defaults to gpt3.EstimateTokens.
+func WithTokenCounter(countTokens func(text string) int) Option {
+	return func(a *Assistant) error {
+		if countTokens == nil {
+			return errors.New("token counter must not be nil")
+		}
+		a.countTokens = countTokens
+		return nil
+	}
+}
+
+// WithSystemPrompt sets the instruction given to the model, which should ask it to cite the
+// numbers of the sources in square brackets. Defaults to DefaultSystemPrompt.
+func WithSystemPrompt(prompt string) Option {
+	return func(a *Assistant) error {
+		if strings.TrimSpace(prompt) == "" {
+			return errors.New("system prompt must not be empty")
+		}
+		a.systemPrompt = prompt
+		return nil
+	}
+}
+
+// WithRequestOptions sets request options passed to every chat completion request.
+func WithRequestOptions(opts ...gpt3.RequestOption) Option {
+	return func(a *Assistant) error {
+		a.requestOptions = append(a.requestOptions, opts...)
+		return nil
+	}
+}
+
+// Assistant answers questions from the chunks of a Retriever. It is safe for concurrent use if
+// its retriever is.
+type Assistant struct {
+	client         gpt3.Client
+	retriever      Retriever
+	model          string
+	topK           int
+	tokenBudget    int
+	countTokens    func(text string) int
+	systemPrompt   string
+	requestOptions []gpt3.RequestOption
+}
+
+// New returns an Assistant that answers with client from the chunks of retriever. It fails if an
+// option is invalid.
+func New(client gpt3.Client, retriever Retriever, options ...Option) (*Assistant, error) {
+	if client == nil || retriever == nil {
+		return nil, errors.New("client and retriever must not be nil")
+	}
+	a := &Assistant{
+		client:       client,
+		retriever:    retriever,
+		model:        DefaultModel,
+		topK:         DefaultTopK,
+		tokenBudget:  DefaultTokenBudget,
+		countTokens:  gpt3.EstimateTokens,
+		systemPrompt: DefaultSystemPrompt,
+	}
+	for _, o := range options {
+		if err := o(a); err != nil {
+			return nil, err
+		}
+	}
+	return a, nil
+}
+
+// Answer is the answer to a question.
+type Answer struct {
+	// Text is the answer of the model, with the citations of sources as it wrote them.
+	Text string
+	// Sources are the chunks the answer cites, in the order they are first cited.
+	Sources []Document
+	// ChunkIDs are the IDs of the Sources.
+	ChunkIDs []string
+	// Context are all the chunks that were given to the model, numbered from 1 in this order.
+	Context []Document
+	// Response is the chat completion response the answer is from.
+	Response *gpt3.ChatCompletionResponse
+}
+
+// Ask answers question from the most relevant chunks of the retriever. The history, if any, is
+// the earlier messages of the conversation, which are sent between the instruction and the
+// question without sources.
+func (a *Assistant) Ask(ctx context.Context, question string, history ...gpt3.ChatCompletionRequestMessage) (*Answer, error) {
+	if strings.TrimSpace(question) == "" {
+		return nil, errors.New("question must not be empty")
+	}
+	documents, err := a.retriever.Retrieve(ctx, question, a.topK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve sources: %w", err)
+	}
+	sources, packed := a.pack(documents)
+
+	messages := []gpt3.ChatCompletionRequestMessage{{Role: "system", Content: a.systemPrompt}}
+	messages = append(messages, history...)
+	messages = append(messages, gpt3.ChatCompletionRequestMessage{
+		Role:    "user",
+		Content: "Sources:\n\n" + sources + "Question: " + question,
+	})
+	rsp, err := a.client.ChatCompletion(ctx, gpt3.ChatCompletionRequest{
+		Model:    a.model,
+		Messages: messages,
+	}, a.requestOptions...)
+	if err != nil {
+		return nil, err
+	}
+	if len(rsp.Choices) == 0 {
+		return nil, errors.New("chat completion response has no choices")
+	}
+
+	answer := &Answer{
+		Text:     rsp.Choices[0].Message.Content,
+		Context:  packed,
+		Response: rsp,
+	}
+	for _, n := range citations(answer.Text, len(packed)) {
+		answer.Sources = append(answer.Sources, packed[n-1])
+		answer.ChunkIDs = append(answer.ChunkIDs, packed[n-1].ID)
+	}
+	return answer, nil
+}
+
+// pack formats the documents as numbered sources, in order, leaving out those that don't fit in
+// what is left of the token budget. It returns the sources and the documents they are of.
+func (a *Assistant) pack(documents []Document) (string, []Document) {
+	var b strings.Builder
+	var packed []Document
+	budget := a.tokenBudget
+	for _, document := range documents {
+		if strings.TrimSpace(document.Text) == "" {
+			continue
+		}
+		source := formatSource(len(packed)+1, document)
+		tokens := a.countTokens(source)
+		if tokens > budget {
+			continue
+		}
+		budget -= tokens
+		b.WriteString(source)
+		packed = append(packed, document)
+	}
+	return b.String(), packed
+}
+
+func formatSource(n int, document Document) string {
+	header := "[" + strconv.Itoa(n) + "]"
+	if document.Source != "" {
+		header += " " + document.Source
+	}
+	return header + "\n" + strings.TrimSpace(document.Text) + "\n\n"
+}
+
+// citationPattern matches citations like [1] and [1, 2].
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// citations returns the source numbers cited in text, from 1 to count, in the order they are
+// first cited.
+func citations(text string, count int) []int {
+	var cited []int
+	seen := make(map[int]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(text, -1) {
+		for _, number := range strings.Split(match[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(number))
+			if err != nil || n < 1 || n > count || seen[n] {
+				continue
+			}
+			seen[n] = true
+			cited = append(cited, n)
+		}
+	}
+	return cited
+}
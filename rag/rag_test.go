@@ -0,0 +1,158 @@
+package rag_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/PullRequestInc/go-gpt3/gpt3test"
+	"github.com/PullRequestInc/go-gpt3/rag"
+	"github.com/PullRequestInc/go-gpt3/vectorstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func answerWith(content string) gpt3.ChatCompletionResponse {
+	return gpt3.ChatCompletionResponse{
+		Choices: []gpt3.ChatCompletionResponseChoice{{
+			Message: gpt3.ChatCompletionResponseMessage{Role: "assistant", Content: content},
+		}},
+	}
+}
+
+// lastChatRequest returns the last chat completion request received by server.
+func lastChatRequest(t *testing.T, server *gpt3test.Server) gpt3.ChatCompletionRequest {
+	var request gpt3.ChatCompletionRequest
+	for _, r := range server.Requests() {
+		if r.Path == "/v1/chat/completions" {
+			assert.NoError(t, json.Unmarshal(r.Body, &request))
+		}
+	}
+	return request
+}
+
+func TestAsk(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.QueueChatCompletion(answerWith("Keys rotate hourly [2]. Old keys are revoked [1, 2][9]."))
+	client := server.Client()
+
+	documents := []rag.Document{
+		{ID: "a", Text: "Revoked keys stop working at once.", Source: "revocation.md"},
+		{ID: "b", Text: "Api keys are rotated every hour."},
+		{ID: "c", Text: "   "},
+	}
+	retriever := rag.RetrieverFunc(func(ctx context.Context, query string, k int) ([]rag.Document, error) {
+		assert.Equal(t, "How are keys rotated?", query)
+		assert.Equal(t, 3, k)
+		return documents, nil
+	})
+	assistant, err := rag.New(client, retriever, rag.WithTopK(3), rag.WithModel("gpt-4"))
+	assert.NoError(t, err)
+	history := gpt3.ChatCompletionRequestMessage{Role: "user", Content: "Hi"}
+	answer, err := assistant.Ask(context.Background(), "How are keys rotated?", history)
+	assert.NoError(t, err)
+	assert.Equal(t, "Keys rotate hourly [2]. Old keys are revoked [1, 2][9].", answer.Text)
+	assert.Equal(t, []string{"b", "a"}, answer.ChunkIDs)
+	assert.Equal(t, []rag.Document{documents[1], documents[0]}, answer.Sources)
+	// the blank chunk is left out
+	assert.Equal(t, documents[:2], answer.Context)
+
+	request := lastChatRequest(t, server)
+	assert.Equal(t, "gpt-4", request.Model)
+	assert.Len(t, request.Messages, 3)
+	assert.Equal(t, rag.DefaultSystemPrompt, request.Messages[0].Content)
+	assert.Equal(t, history, request.Messages[1])
+	assert.Equal(t, "Sources:\n\n"+
+		"[1] revocation.md\nRevoked keys stop working at once.\n\n"+
+		"[2]\nApi keys are rotated every hour.\n\n"+
+		"Question: How are keys rotated?", request.Messages[2].Content)
+}
+
+func TestAskTokenBudget(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.QueueChatCompletion(answerWith("I don't know."))
+
+	documents := []rag.Document{
+		{ID: "long", Text: strings.Repeat("word ", 100)},
+		{ID: "short", Text: "Short."},
+	}
+	retriever := rag.RetrieverFunc(func(ctx context.Context, query string, k int) ([]rag.Document, error) {
+		return documents, nil
+	})
+	assistant, err := rag.New(server.Client(), retriever, rag.WithTokenBudget(20))
+	assert.NoError(t, err)
+	answer, err := assistant.Ask(context.Background(), "Question?")
+	assert.NoError(t, err)
+	assert.Empty(t, answer.ChunkIDs)
+	assert.Equal(t, documents[1:], answer.Context)
+	assert.Contains(t, lastChatRequest(t, server).Messages[1].Content, "[1]\nShort.")
+}
+
+func TestAskErrors(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	retriever := rag.RetrieverFunc(func(ctx context.Context, query string, k int) ([]rag.Document, error) {
+		return nil, errors.New("index unavailable")
+	})
+	assistant, err := rag.New(server.Client(), retriever)
+	assert.NoError(t, err)
+
+	_, err = assistant.Ask(context.Background(), " ")
+	assert.EqualError(t, err, "question must not be empty")
+	_, err = assistant.Ask(context.Background(), "Question?")
+	assert.EqualError(t, err, "failed to retrieve sources: index unavailable")
+}
+
+func TestOptionErrors(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	retriever := rag.RetrieverFunc(func(ctx context.Context, query string, k int) ([]rag.Document, error) {
+		return nil, nil
+	})
+
+	_, err := rag.New(server.Client(), retriever, rag.WithTopK(-1))
+	assert.EqualError(t, err, "top k must be positive, got -1")
+	_, err = rag.New(server.Client(), retriever, rag.WithTokenBudget(0))
+	assert.EqualError(t, err, "token budget must be positive, got 0")
+	_, err = rag.New(server.Client(), retriever, rag.WithModel(""))
+	assert.EqualError(t, err, "model must not be empty")
+	_, err = rag.New(server.Client(), nil)
+	assert.EqualError(t, err, "client and retriever must not be nil")
+}
+
+func TestIndexRetriever(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	server.SetEmbeddingDimensions(16)
+
+	index := vectorstore.NewFlat(16, vectorstore.Cosine)
+	for _, item := range []struct{ id, text, lang string }{
+		{"1", "cats purr", "en"},
+		{"2", "dogs bark", "en"},
+		{"3", "cats purr", "fr"},
+	} {
+		assert.NoError(t, index.Add(vectorstore.Item{
+			ID:       item.id,
+			Vector:   gpt3test.FakeEmbedding(item.text, 16),
+			Metadata: map[string]string{"body": item.text, "source": item.lang},
+		}))
+	}
+	retriever := &rag.IndexRetriever{
+		Client:  server.Client(),
+		Model:   gpt3.TextEmbedding3Small,
+		Index:   index,
+		Filter:  vectorstore.MetadataEquals("source", "en"),
+		TextKey: "body",
+	}
+	documents, err := retriever.Retrieve(context.Background(), "cats purr", 1)
+	assert.NoError(t, err)
+	assert.Len(t, documents, 1)
+	assert.Equal(t, "1", documents[0].ID)
+	assert.Equal(t, "cats purr", documents[0].Text)
+	assert.Equal(t, "en", documents[0].Source)
+	assert.InDelta(t, 1, documents[0].Score, 1e-5)
+}
@@ -0,0 +1,397 @@
+// Package recorder provides a cassette-style http.RoundTripper that records real API interactions
+// to a file and replays them offline in tests.
+//
+// In record mode requests are forwarded to a real transport and each interaction is kept, with
+// credentials scrubbed, until Save writes them to the cassette file. Streamed server-sent event
+// bodies are recorded chunk by chunk along with the delay before each chunk. In replay mode the
+// cassette is loaded and every request must match a recorded interaction on its method, path,
+// query and JSON body, otherwise the round trip fails with an error describing the request.
+package recorder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mode selects whether a Recorder records or replays interactions.
+type Mode int
+
+const (
+	// ModeReplay serves responses from the cassette and never touches the network.
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests to the real transport and records the interactions.
+	ModeRecord
+)
+
+// Redacted replaces scrubbed secrets in recorded interactions.
+const Redacted = "[REDACTED]"
+
+// Interaction is a single recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is the recorded part of an HTTP request.
+type Request struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Query  string      `json:"query,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+}
+
+// Response is the recorded part of an HTTP response. Streamed responses are recorded as Chunks
+// instead of a Body.
+type Response struct {
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	Chunks     []Chunk     `json:"chunks,omitempty"`
+}
+
+// Chunk is a piece of a streamed response body along with the delay before it was received.
+type Chunk struct {
+	Delay time.Duration `json:"delay"`
+	Data  string        `json:"data"`
+}
+
+type cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithTransport sets the transport used to perform real requests in record mode. The default is
+// http.DefaultTransport.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = transport
+	}
+}
+
+// WithScrubbedHeaders adds request and response headers that are removed before an interaction is
+// recorded. Authorization, Api-Key, Cookie and Set-Cookie are always removed.
+func WithScrubbedHeaders(headers ...string) Option {
+	return func(r *Recorder) {
+		for _, header := range headers {
+			r.scrubbedHeaders = append(r.scrubbedHeaders, http.CanonicalHeaderKey(header))
+		}
+	}
+}
+
+// WithScrubber adds a function that is run on every interaction before it is saved, to remove
+// secrets the recorder does not know about.
+func WithScrubber(scrubber func(*Interaction)) Option {
+	return func(r *Recorder) {
+		r.scrubbers = append(r.scrubbers, scrubber)
+	}
+}
+
+// WithRealTiming replays streamed chunks with the delays they were recorded with, instead of as
+// fast as they are read.
+func WithRealTiming() Option {
+	return func(r *Recorder) {
+		r.realTiming = true
+	}
+}
+
+// Recorder is an http.RoundTripper that records or replays interactions.
+type Recorder struct {
+	path            string
+	mode            Mode
+	transport       http.RoundTripper
+	scrubbedHeaders []string
+	scrubbers       []func(*Interaction)
+	realTiming      bool
+
+	mu           sync.Mutex
+	interactions []*Interaction
+	used         []bool
+	secrets      []string
+}
+
+// New returns a Recorder for the cassette at path. In replay mode the cassette is loaded immediately
+// and must exist.
+func New(path string, mode Mode, options ...Option) (*Recorder, error) {
+	r := &Recorder{
+		path:            path,
+		mode:            mode,
+		transport:       http.DefaultTransport,
+		scrubbedHeaders: []string{"Authorization", "Api-Key", "Cookie", "Set-Cookie"},
+	}
+	for _, o := range options {
+		o(r)
+	}
+
+	if mode == ModeReplay {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cassette: %w", err)
+		}
+		var c cassette
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+		}
+		r.interactions = c.Interactions
+		r.used = make([]bool, len(c.Interactions))
+	}
+	return r, nil
+}
+
+// HTTPClient returns an http.Client using the recorder as its transport, for use with gpt3.WithHTTPClient.
+func (r *Recorder) HTTPClient() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+// RoundTrip records or replays a single request.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+	if r.mode == ModeReplay {
+		return r.replay(req, body)
+	}
+	return r.record(req, body)
+}
+
+// Unused returns the recorded interactions that have not been replayed yet. It always returns nil
+// in record mode.
+func (r *Recorder) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Interaction
+	for i, interaction := range r.interactions {
+		if r.mode == ModeReplay && !r.used[i] {
+			unused = append(unused, *interaction)
+		}
+	}
+	return unused
+}
+
+// Save writes the recorded interactions to the cassette file. It does nothing in replay mode.
+func (r *Recorder) Save() error {
+	if r.mode == ModeReplay {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, interaction := range r.interactions {
+		r.scrub(interaction)
+	}
+	data, err := json.MarshalIndent(cassette{Interactions: r.interactions}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed encoding cassette: %w", err)
+	}
+	return ioutil.WriteFile(r.path, data, 0644)
+}
+
+func (r *Recorder) record(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	r.secrets = appendSecrets(r.secrets, req.Header)
+	r.mu.Unlock()
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	interaction := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			Path:   req.URL.Path,
+			Query:  req.URL.RawQuery,
+			Header: req.Header.Clone(),
+			Body:   string(body),
+		},
+		Response: Response{
+			StatusCode: resp.StatusCode,
+			Header:     resp.Header.Clone(),
+		},
+	}
+
+	if isStream(resp.Header) {
+		resp.Body = &recordingBody{
+			ReadCloser: resp.Body,
+			mu:         &r.mu,
+			response:   &interaction.Response,
+			last:       time.Now(),
+		}
+	} else {
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		interaction.Response.Body = string(data)
+		resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *Recorder) replay(req *http.Request, body []byte) (*http.Response, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	normalized := normalizeBody(body)
+	for i, interaction := range r.interactions {
+		recorded := interaction.Request
+		if r.used[i] || recorded.Method != req.Method || recorded.Path != req.URL.Path ||
+			recorded.Query != req.URL.RawQuery || normalizeBody([]byte(recorded.Body)) != normalized {
+			continue
+		}
+		r.used[i] = true
+
+		resp := &http.Response{
+			Status:     fmt.Sprintf("%d %s", interaction.Response.StatusCode, http.StatusText(interaction.Response.StatusCode)),
+			StatusCode: interaction.Response.StatusCode,
+			Proto:      "HTTP/1.1",
+			ProtoMajor: 1,
+			ProtoMinor: 1,
+			Header:     interaction.Response.Header.Clone(),
+			Request:    req,
+		}
+		if resp.Header == nil {
+			resp.Header = make(http.Header)
+		}
+		if interaction.Response.Chunks != nil {
+			resp.Body = &replayingBody{chunks: interaction.Response.Chunks, realTiming: r.realTiming}
+		} else {
+			resp.Body = ioutil.NopCloser(strings.NewReader(interaction.Response.Body))
+		}
+		return resp, nil
+	}
+	return nil, fmt.Errorf("recorder: no unused interaction in %s matches %s %s with body %s",
+		r.path, req.Method, req.URL.RequestURI(), normalized)
+}
+
+// scrub removes credentials from an interaction before it is saved.
+func (r *Recorder) scrub(interaction *Interaction) {
+	for _, header := range r.scrubbedHeaders {
+		interaction.Request.Header.Del(header)
+		interaction.Response.Header.Del(header)
+	}
+	for _, secret := range r.secrets {
+		interaction.Request.Body = strings.ReplaceAll(interaction.Request.Body, secret, Redacted)
+		interaction.Response.Body = strings.ReplaceAll(interaction.Response.Body, secret, Redacted)
+		for i := range interaction.Response.Chunks {
+			interaction.Response.Chunks[i].Data = strings.ReplaceAll(interaction.Response.Chunks[i].Data, secret, Redacted)
+		}
+	}
+	for _, scrubber := range r.scrubbers {
+		scrubber(interaction)
+	}
+}
+
+// appendSecrets adds the credentials sent in the request headers to secrets.
+func appendSecrets(secrets []string, header http.Header) []string {
+	candidates := []string{header.Get("Api-Key")}
+	if auth := header.Get("Authorization"); auth != "" {
+		candidates = append(candidates, strings.TrimSpace(strings.TrimPrefix(auth, "Bearer")))
+	}
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		known := false
+		for _, secret := range secrets {
+			known = known || secret == candidate
+		}
+		if !known {
+			secrets = append(secrets, candidate)
+		}
+	}
+	return secrets
+}
+
+// readRequestBody reads the request body and restores it so it can be sent.
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	data, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %w", err)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return data, nil
+}
+
+// normalizeBody re-encodes JSON bodies so that requests match regardless of key order and whitespace.
+func normalizeBody(body []byte) string {
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return string(bytes.TrimSpace(body))
+	}
+	normalized, err := json.Marshal(decoded)
+	if err != nil {
+		return string(body)
+	}
+	return string(normalized)
+}
+
+func isStream(header http.Header) bool {
+	return strings.HasPrefix(header.Get("Content-Type"), "text/event-stream")
+}
+
+// recordingBody records the chunks of a streamed body as they are read.
+type recordingBody struct {
+	io.ReadCloser
+	mu       *sync.Mutex
+	response *Response
+	last     time.Time
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		now := time.Now()
+		b.mu.Lock()
+		b.response.Chunks = append(b.response.Chunks, Chunk{Delay: now.Sub(b.last), Data: string(p[:n])})
+		b.mu.Unlock()
+		b.last = now
+	}
+	return n, err
+}
+
+// replayingBody serves recorded chunks one at a time.
+type replayingBody struct {
+	chunks     []Chunk
+	current    []byte
+	realTiming bool
+}
+
+func (b *replayingBody) Read(p []byte) (int, error) {
+	if len(b.current) == 0 {
+		if len(b.chunks) == 0 {
+			return 0, io.EOF
+		}
+		if b.realTiming {
+			time.Sleep(b.chunks[0].Delay)
+		}
+		b.current = []byte(b.chunks[0].Data)
+		b.chunks = b.chunks[1:]
+	}
+	n := copy(p, b.current)
+	b.current = b.current[n:]
+	return n, nil
+}
+
+func (b *replayingBody) Close() error {
+	return nil
+}
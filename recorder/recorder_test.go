@@ -0,0 +1,92 @@
+package recorder_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	fakes "github.com/PullRequestInc/go-gpt3/go-gpt3fakes"
+	"github.com/PullRequestInc/go-gpt3/recorder"
+	"github.com/stretchr/testify/assert"
+)
+
+func upstream() *fakes.FakeRoundTripper {
+	rt := &fakes.FakeRoundTripper{}
+	rt.RoundTripReturnsOnCall(0, &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"id":"chatcmpl-123","choices":[{"message":{"content":"hi"}}]}`)),
+	}, nil)
+	rt.RoundTripReturnsOnCall(1, &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+		Body: ioutil.NopCloser(bytes.NewBufferString(
+			"data: {\"choices\":[{\"text\":\"a\"}]}\n\n" +
+				"data: {\"choices\":[{\"text\":\"b\"}]}\n\n" +
+				"data: [DONE]\n\n")),
+	}, nil)
+	return rt
+}
+
+func runCalls(t *testing.T, client gpt3.Client) {
+	ctx := context.Background()
+	rsp, err := client.ChatCompletion(ctx, gpt3.ChatCompletionRequest{
+		Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "hello"}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "hi", rsp.Choices[0].Message.Content)
+
+	var text string
+	err = client.CompletionStream(ctx, gpt3.CompletionRequest{Prompt: []string{"count"}}, func(rsp *gpt3.CompletionResponse) {
+		text += rsp.Choices[0].Text
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "ab", text)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+
+	rec, err := recorder.New(path, recorder.ModeRecord, recorder.WithTransport(upstream()))
+	assert.NoError(t, err)
+	runCalls(t, gpt3.NewClient("sk-secret", gpt3.WithHTTPClient(rec.HTTPClient())))
+	assert.NoError(t, rec.Save())
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "sk-secret")
+	assert.Contains(t, string(data), `"chunks"`)
+
+	rep, err := recorder.New(path, recorder.ModeReplay)
+	assert.NoError(t, err)
+	runCalls(t, gpt3.NewClient("other-key", gpt3.WithHTTPClient(rep.HTTPClient()), gpt3.WithBaseURL("http://localhost/v1")))
+	assert.Empty(t, rep.Unused())
+}
+
+func TestReplayFailsOnUnmatchedRequest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := recorder.New(path, recorder.ModeRecord, recorder.WithTransport(upstream()))
+	assert.NoError(t, err)
+	runCalls(t, gpt3.NewClient("sk-secret", gpt3.WithHTTPClient(rec.HTTPClient())))
+	assert.NoError(t, rec.Save())
+
+	rep, err := recorder.New(path, recorder.ModeReplay)
+	assert.NoError(t, err)
+	client := gpt3.NewClient("sk-secret", gpt3.WithHTTPClient(rep.HTTPClient()))
+	_, err = client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{
+		Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "something else"}},
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "recorder: no unused interaction")
+	assert.Contains(t, err.Error(), "POST /v1/chat/completions")
+	assert.Len(t, rep.Unused(), 2)
+}
+
+func TestReplayMissingCassette(t *testing.T) {
+	_, err := recorder.New(filepath.Join(t.TempDir(), "missing.json"), recorder.ModeReplay)
+	assert.Error(t, err)
+}
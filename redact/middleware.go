@@ -0,0 +1,166 @@
+package redact
+
+import (
+	"context"
+	"sort"
+
+	"github.com/PullRequestInc/go-gpt3"
+)
+
+// Middleware returns a middleware that redacts the messages of chat completions, the prompts of
+// completions and the inputs of embeddings with redactor, and restores the placeholders in the
+// text of the responses, streamed or not. Each call has its own Session, so placeholders are
+// only restored in the response to the request they were made for. Prompts and inputs sent as
+// tokens are not redacted.
+func Middleware(redactor *Redactor) gpt3.Middleware {
+	return func(next gpt3.Handler) gpt3.Handler {
+		return func(ctx context.Context, call *gpt3.Call) error {
+			session := redactor.NewSession()
+			if !redactRequest(session, call.Request) {
+				return next(ctx, call)
+			}
+
+			if call.Stream() {
+				s := &restoringStream{session: session, onData: call.OnStreamData, held: make(map[int]string)}
+				call.OnStreamData = s.restore
+				if err := next(ctx, call); err != nil {
+					return err
+				}
+				return s.flush()
+			}
+
+			if err := next(ctx, call); err != nil {
+				return err
+			}
+			restoreResponse(session, call.Response)
+			return nil
+		}
+	}
+}
+
+// redactRequest redacts the texts of a request, copying its slices as they are shared with the
+// caller. It reports whether the request is of a kind that is redacted.
+func redactRequest(session *Session, request interface{}) bool {
+	switch r := request.(type) {
+	case *gpt3.ChatCompletionRequest:
+		messages := make([]gpt3.ChatCompletionRequestMessage, len(r.Messages))
+		for i, message := range r.Messages {
+			message.Content = session.Redact(message.Content)
+			messages[i] = message
+		}
+		r.Messages = messages
+	case *gpt3.CompletionRequest:
+		r.Prompt = redactAll(session, r.Prompt)
+	case *gpt3.EmbeddingsRequest:
+		r.Input = redactAll(session, r.Input)
+	default:
+		return false
+	}
+	return true
+}
+
+func redactAll(session *Session, texts []string) []string {
+	if texts == nil {
+		return nil
+	}
+	redacted := make([]string, len(texts))
+	for i, text := range texts {
+		redacted[i] = session.Redact(text)
+	}
+	return redacted
+}
+
+// restoreResponse restores the placeholders in the texts of a response.
+func restoreResponse(session *Session, response interface{}) {
+	switch r := response.(type) {
+	case *gpt3.ChatCompletionResponse:
+		for i := range r.Choices {
+			message := &r.Choices[i].Message
+			message.Content = session.Restore(message.Content)
+			if message.FunctionCall != nil {
+				message.FunctionCall.Arguments = session.Restore(message.FunctionCall.Arguments)
+			}
+		}
+	case *gpt3.CompletionResponse:
+		for i := range r.Choices {
+			r.Choices[i].Text = session.Restore(r.Choices[i].Text)
+		}
+	}
+}
+
+// restoringStream restores the placeholders in streamed text. A placeholder can be split over
+// chunks, so text that may be the start of one is held back until the next chunk of its choice.
+type restoringStream struct {
+	session *Session
+	onData  func(chunk interface{}) error
+	held    map[int]string
+	// last is the last chunk, which the held back text is sent with if the stream ends first
+	last interface{}
+}
+
+func (s *restoringStream) restore(chunk interface{}) error {
+	switch c := chunk.(type) {
+	case *gpt3.ChatCompletionStreamResponse:
+		for i := range c.Choices {
+			choice := &c.Choices[i]
+			choice.Delta.Content = s.text(choice.Index, choice.Delta.Content, choice.FinishReason != "")
+		}
+	case *gpt3.CompletionResponse:
+		for i := range c.Choices {
+			choice := &c.Choices[i]
+			choice.Text = s.text(choice.Index, choice.Text, choice.FinishReason != "")
+		}
+	}
+	s.last = chunk
+	return s.onData(chunk)
+}
+
+// text returns the restored text of a chunk of a choice, holding back the end of it if it may be
+// the start of a placeholder, unless the choice is finished.
+func (s *restoringStream) text(index int, text string, finished bool) string {
+	text = s.held[index] + text
+	delete(s.held, index)
+	if !finished {
+		if n := s.session.partial(text); n > 0 {
+			s.held[index] = text[len(text)-n:]
+			text = text[:len(text)-n]
+		}
+	}
+	return s.session.Restore(text)
+}
+
+// flush sends the text that is still held back when the stream ends, in a copy of the last chunk.
+func (s *restoringStream) flush() error {
+	if len(s.held) == 0 {
+		return nil
+	}
+	indexes := make([]int, 0, len(s.held))
+	for index := range s.held {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	var chunk interface{}
+	switch last := s.last.(type) {
+	case *gpt3.ChatCompletionStreamResponse:
+		c := *last
+		c.Choices = nil
+		for _, index := range indexes {
+			c.Choices = append(c.Choices, gpt3.ChatCompletionStreamResponseChoice{
+				Index: index,
+				Delta: gpt3.ChatCompletionResponseMessage{Content: s.session.Restore(s.held[index])},
+			})
+		}
+		chunk = &c
+	case *gpt3.CompletionResponse:
+		c := *last
+		c.Choices = nil
+		for _, index := range indexes {
+			c.Choices = append(c.Choices, gpt3.CompletionResponseChoice{Index: index, Text: s.session.Restore(s.held[index])})
+		}
+		chunk = &c
+	default:
+		return nil
+	}
+	s.held = make(map[int]string)
+	return s.onData(chunk)
+}
@@ -0,0 +1,276 @@
+// Package redact masks personal data in the text sent to the API with placeholders, and puts the
+// original values back into the text the API returns. The values never leave the process:
+//
+//	client := gpt3.NewClient(apiKey, gpt3.WithMiddleware(redact.Middleware(redact.New())))
+//
+// turns "Mail jane@example.com" into "Mail [EMAIL_1]" in the request, and "[EMAIL_1]" in the
+// answer back into "jane@example.com". Emails, phone numbers, credit card numbers and IBANs are
+// detected by default, and patterns of other data can be added with Custom.
+package redact
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Pattern detects one kind of personal data.
+type Pattern struct {
+	// Name names the placeholders of the pattern, e.g. "EMAIL" for "[EMAIL_1]".
+	Name string
+	// Regexp matches candidates of the data.
+	Regexp *regexp.Regexp
+	// Validate, if set, reports whether a match is really the data, e.g. by a checksum.
+	Validate func(match string) bool
+}
+
+// The patterns detected by default.
+var (
+	// Email matches email addresses.
+	Email = Pattern{
+		Name:   "EMAIL",
+		Regexp: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+	// IBAN matches international bank account numbers with a valid checksum, with or without
+	// spaces between the groups of four characters.
+	IBAN = Pattern{
+		Name:     "IBAN",
+		Regexp:   regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`),
+		Validate: validIBAN,
+	}
+	// CreditCard matches card numbers of 13 to 19 digits with a valid Luhn checksum, with or
+	// without spaces or dashes between the digits.
+	CreditCard = Pattern{
+		Name:     "CREDIT_CARD",
+		Regexp:   regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Validate: validLuhn,
+	}
+	// Phone matches phone numbers of 9 to 15 digits that are shaped like one: starting with a
+	// country code such as "+1" or an area code in parentheses, starting with a trunk prefix 0 in
+	// groups with the same separator throughout, e.g. "030 12345678", or grouped 3-3-4 like
+	// "555-123-4567". Bare runs of digits, lists of numbers, dates, timestamps and IP addresses are
+	// not matched.
+	Phone = Pattern{
+		Name: "PHONE",
+		Regexp: regexp.MustCompile(`\+\d{1,3}(?:[ .-]?\(\d{1,4}\))?(?:[ .-]?\d{1,5}){1,5}\b` +
+			`|\(\d{1,4}\)[ .-]?\d{2,5}(?:[ .-]?\d{2,5}){1,3}\b` +
+			`|\b\d+(?:[ .-]\d+)+\b`),
+		Validate: validPhone,
+	}
+)
+
+// DefaultPatterns are the patterns a Redactor detects when New is called without patterns. The
+// order matters, as the text matched by a pattern isn't matched by those after it.
+var DefaultPatterns = []Pattern{Email, IBAN, CreditCard, Phone}
+
+// Custom returns a pattern of other data, matched by expr, with placeholders named name. It
+// panics if expr is not a valid regular expression, like regexp.MustCompile.
+func Custom(name, expr string) Pattern {
+	return Pattern{Name: name, Regexp: regexp.MustCompile(expr)}
+}
+
+// Redactor detects personal data in text. It is safe for concurrent use.
+type Redactor struct {
+	patterns []Pattern
+}
+
+// New returns a Redactor of the given patterns, in order, or of DefaultPatterns if there are none.
+func New(patterns ...Pattern) *Redactor {
+	if len(patterns) == 0 {
+		patterns = DefaultPatterns
+	}
+	return &Redactor{patterns: append([]Pattern(nil), patterns...)}
+}
+
+// NewSession returns a Session that redacts text with the patterns of the Redactor.
+func (r *Redactor) NewSession() *Session {
+	return &Session{
+		redactor:     r,
+		values:       make(map[string]string),
+		placeholders: make(map[string]string),
+		counts:       make(map[string]int),
+	}
+}
+
+// Session redacts the texts of a single exchange with the API and restores them in its answer.
+// The same value gets the same placeholder throughout a session. It is safe for concurrent use.
+type Session struct {
+	redactor *Redactor
+
+	mu sync.Mutex
+	// values maps placeholders to the values they replace, placeholders the other way around
+	values       map[string]string
+	placeholders map[string]string
+	counts       map[string]int
+	replacer     *strings.Replacer
+}
+
+// Redact returns text with the personal data replaced by placeholders.
+func (s *Session) Redact(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, pattern := range s.redactor.patterns {
+		text = pattern.Regexp.ReplaceAllStringFunc(text, func(match string) string {
+			if isPlaceholder(match) || (pattern.Validate != nil && !pattern.Validate(match)) {
+				return match
+			}
+			return s.placeholder(pattern.Name, match)
+		})
+	}
+	return text
+}
+
+// placeholder returns the placeholder of value, creating it if it is new. s.mu must be held.
+func (s *Session) placeholder(name, value string) string {
+	key := name + "\x00" + value
+	if placeholder, ok := s.placeholders[key]; ok {
+		return placeholder
+	}
+	s.counts[name]++
+	placeholder := "[" + name + "_" + strconv.Itoa(s.counts[name]) + "]"
+	s.placeholders[key] = placeholder
+	s.values[placeholder] = value
+	s.replacer = nil
+	return placeholder
+}
+
+// Values returns the values redacted so far by their placeholders.
+func (s *Session) Values() map[string]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	values := make(map[string]string, len(s.values))
+	for placeholder, value := range s.values {
+		values[placeholder] = value
+	}
+	return values
+}
+
+// Restore returns text with the placeholders of the session replaced by the values they stand for.
+func (s *Session) Restore(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.values) == 0 {
+		return text
+	}
+	if s.replacer == nil {
+		placeholders := make([]string, 0, len(s.values))
+		for placeholder := range s.values {
+			placeholders = append(placeholders, placeholder)
+		}
+		sort.Strings(placeholders)
+		pairs := make([]string, 0, 2*len(placeholders))
+		for _, placeholder := range placeholders {
+			pairs = append(pairs, placeholder, s.values[placeholder])
+		}
+		s.replacer = strings.NewReplacer(pairs...)
+	}
+	return s.replacer.Replace(text)
+}
+
+// partial returns the length of the end of text that may be the start of a placeholder, which
+// has to wait for more text before it can be restored.
+func (s *Session) partial(text string) int {
+	i := strings.LastIndexByte(text, '[')
+	if i < 0 || strings.IndexByte(text[i:], ']') >= 0 {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for placeholder := range s.values {
+		if strings.HasPrefix(placeholder, text[i:]) {
+			return len(text) - i
+		}
+	}
+	return 0
+}
+
+var placeholderPattern = regexp.MustCompile(`^\[[A-Z0-9_]+_\d+\]$`)
+
+func isPlaceholder(text string) bool {
+	return placeholderPattern.MatchString(text)
+}
+
+// digits returns the digits of text.
+func digits(text string) []int {
+	var ds []int
+	for _, r := range text {
+		if r >= '0' && r <= '9' {
+			ds = append(ds, int(r-'0'))
+		}
+	}
+	return ds
+}
+
+func validLuhn(match string) bool {
+	ds := digits(match)
+	if len(ds) < 13 || len(ds) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range ds {
+		d := ds[len(ds)-1-i]
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validPhone checks the digit count of a phone number, and the groups of one without a country
+// code or an area code in parentheses. These are matched as whole runs of digit groups, so a
+// number within a longer list of numbers is not taken for a phone number.
+func validPhone(match string) bool {
+	n := len(digits(match))
+	if n < 9 || n > 15 {
+		return false
+	}
+	if match[0] == '+' || match[0] == '(' {
+		return true
+	}
+	groups := strings.FieldsFunc(match, func(r rune) bool { return r < '0' || r > '9' })
+	if strings.Count(match, match[len(groups[0]):len(groups[0])+1]) != len(groups)-1 {
+		// the separators differ
+		return false
+	}
+	if len(groups) == 3 && len(groups[0]) == 3 && len(groups[1]) == 3 && len(groups[2]) == 4 {
+		return true
+	}
+	// a trunk prefix 0, but not the international prefix 00
+	if len(groups[0]) < 2 || len(groups[0]) > 5 || groups[0][0] != '0' || groups[0][1] == '0' {
+		return false
+	}
+	for _, g := range groups[1:] {
+		if len(g) < 2 || len(g) > 8 {
+			return false
+		}
+	}
+	return true
+}
+
+// validIBAN checks the length and the ISO 13616 mod 97 checksum of an IBAN.
+func validIBAN(match string) bool {
+	iban := strings.Replace(match, " ", "", -1)
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	// the check moves the first four characters to the end and reads letters as 10 to 35
+	remainder := 0
+	for _, r := range iban[4:] + iban[:4] {
+		switch {
+		case unicode.IsDigit(r):
+			remainder = (remainder*10 + int(r-'0')) % 97
+		case r >= 'A' && r <= 'Z':
+			remainder = (remainder*100 + int(r-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
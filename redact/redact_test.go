@@ -0,0 +1,122 @@
+package redact_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	fakes "github.com/PullRequestInc/go-gpt3/go-gpt3fakes"
+	"github.com/PullRequestInc/go-gpt3/gpt3test"
+	"github.com/PullRequestInc/go-gpt3/redact"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedact(t *testing.T) {
+	session := redact.New().NewSession()
+	for _, test := range []struct{ text, redacted string }{
+		{"Mail jane.doe+work@example.co.uk now", "Mail [EMAIL_1] now"},
+		{"Card 4111 1111 1111 1111, or 4111111111111112", "Card [CREDIT_CARD_1], or 4111111111111112"},
+		{"Pay to DE89 3704 0044 0532 0130 00 today", "Pay to [IBAN_1] today"},
+		{"Pay to GB82WEST12345698765432", "Pay to [IBAN_2]"},
+		{"Not an IBAN: DE00 3704 0044 0532 0130 00", "Not an IBAN: DE00 3704 0044 0532 0130 00"},
+		{"Call +1 (555) 123-4567 or 030 12345678", "Call [PHONE_1] or [PHONE_2]"},
+		{"On 2024-01-31 at 10:30, order 12345", "On 2024-01-31 at 10:30, order 12345"},
+	} {
+		assert.Equal(t, test.redacted, session.Redact(test.text), test.text)
+	}
+	// the same value keeps its placeholder
+	assert.Equal(t, "[EMAIL_1] and [EMAIL_2]", session.Redact("jane.doe+work@example.co.uk and bob@example.com"))
+
+	values := session.Values()
+	assert.Equal(t, "4111 1111 1111 1111", values["[CREDIT_CARD_1]"])
+	assert.Equal(t, "+1 (555) 123-4567", values["[PHONE_1]"])
+	assert.Equal(t, "Write to bob@example.com or call 030 12345678.", session.Restore("Write to [EMAIL_2] or call [PHONE_2]."))
+	assert.Equal(t, "Unknown [EMAIL_9] stays", session.Restore("Unknown [EMAIL_9] stays"))
+}
+
+func TestRedactPhones(t *testing.T) {
+	session := redact.New().NewSession()
+	assert.Equal(t, "Call [PHONE_1], [PHONE_2], [PHONE_3], [PHONE_4] or [PHONE_5]",
+		session.Redact("Call (030) 1234-5678, 555.123.4567, 555 123 4567, 0176-1234-5678 or +4930123456"))
+
+	session = redact.New().NewSession()
+	for _, text := range []string{
+		"Logged at 2024-01-15 10:30 by the job",
+		"Logged at 2024-01-15 10:30:45.123",
+		"Logged at 2024-01-15T10:30:00Z",
+		"Logged at 2024 01 15 10 30",
+		"Logged at 20240115 103000",
+		"Logged at 15.01.2024 10.30",
+		"Epoch 1705314600 and order 5551234567",
+		"Version 10.15.7 and 1.22.333",
+		"Host 192.168.100.200",
+		"Ports 8080 9090 3000",
+		"Pay 100 200 300 400 now",
+		"Invoice no. 2023 4567 8901",
+	} {
+		assert.Equal(t, text, session.Redact(text))
+	}
+}
+
+func TestRedactCustom(t *testing.T) {
+	session := redact.New(redact.Custom("EMPLOYEE", `\bE\d{6}\b`), redact.Email).NewSession()
+	assert.Equal(t, "[EMPLOYEE_1] is [EMAIL_1], call 030 12345678",
+		session.Redact("E123456 is e@example.com, call 030 12345678"))
+}
+
+func TestMiddleware(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	client := server.Client(gpt3.WithMiddleware(redact.Middleware(redact.New())))
+
+	messages := []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "My email is jane@example.com"}}
+	rsp, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{Messages: messages})
+	assert.NoError(t, err)
+	// the fake server echoes the redacted message, which is restored in the response
+	assert.Equal(t, "This is a fake response to: My email is jane@example.com", rsp.Choices[0].Message.Content)
+	assert.Equal(t, "My email is jane@example.com", messages[0].Content)
+
+	inputs := []string{"jane@example.com"}
+	_, err = client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{Input: inputs, Model: gpt3.TextEmbedding3Small})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"jane@example.com"}, inputs)
+
+	for _, r := range server.Requests() {
+		assert.NotContains(t, string(r.Body), "jane@example.com")
+	}
+	var request gpt3.EmbeddingsRequest
+	assert.NoError(t, json.Unmarshal(server.Requests()[1].Body, &request))
+	assert.Equal(t, []string{"[EMAIL_1]"}, request.Input)
+}
+
+func TestMiddlewareStream(t *testing.T) {
+	rt := &fakes.FakeRoundTripper{}
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Body: ioutil.NopCloser(bytes.NewBufferString(
+			"data: {\"choices\":[{\"delta\":{\"content\":\"Sent to [EMA\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"IL_1] and [\"}}]}\n\n" +
+				"data: {\"choices\":[{\"delta\":{\"content\":\"others] [EMAIL_1\"}}]}\n\n" +
+				"data: [DONE]\n\n")),
+	}, nil)
+	client := gpt3.NewClient("test-key",
+		gpt3.WithHTTPClient(&http.Client{Transport: rt}),
+		gpt3.WithMiddleware(redact.Middleware(redact.New())),
+	)
+
+	var chunks []string
+	err := client.ChatCompletionStream(context.Background(), gpt3.ChatCompletionRequest{
+		Messages: []gpt3.ChatCompletionRequestMessage{{Role: "user", Content: "Send to jane@example.com"}},
+	}, func(chunk *gpt3.ChatCompletionStreamResponse) error {
+		chunks = append(chunks, chunk.Choices[0].Delta.Content)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Sent to ", "jane@example.com and ", "[others] ", "[EMAIL_1"}, chunks)
+	assert.Equal(t, "Sent to jane@example.com and [others] [EMAIL_1", strings.Join(chunks, ""))
+}
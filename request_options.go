@@ -0,0 +1,147 @@
+package gpt3
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// RequestOption are options that can be passed to a single API call to customize it
+type RequestOption func(*requestOptions) error
+
+type requestOptions struct {
+	header      http.Header
+	query       url.Values
+	extraBody   map[string]interface{}
+	baseURL     string
+	apiKey      string
+	timeout     time.Duration
+	org         string
+	project     string
+	rawResponse *RawResponse
+}
+
+// WithHeader is a request option that sets an extra header on the request, overriding any header
+// of the same name set by the client.
+func WithHeader(key, value string) RequestOption {
+	return func(o *requestOptions) error {
+		if err := validateHeaderValue(fmt.Sprintf("header %s", key), value); err != nil {
+			return err
+		}
+		if o.header == nil {
+			o.header = make(http.Header)
+		}
+		o.header.Set(key, value)
+		return nil
+	}
+}
+
+// WithQueryParam is a request option that adds a query parameter to the request url.
+func WithQueryParam(key, value string) RequestOption {
+	return func(o *requestOptions) error {
+		if o.query == nil {
+			o.query = make(url.Values)
+		}
+		o.query.Add(key, value)
+		return nil
+	}
+}
+
+// WithExtraBody is a request option that adds a field to the JSON request body. It can be used to
+// send API parameters this library doesn't model yet, and overrides a modelled field of the same name.
+func WithExtraBody(key string, value interface{}) RequestOption {
+	return func(o *requestOptions) error {
+		if key == "" {
+			return errors.New("extra body field name must not be empty")
+		}
+		if o.extraBody == nil {
+			o.extraBody = map[string]interface{}{}
+		}
+		o.extraBody[key] = value
+		return nil
+	}
+}
+
+// WithRequestBaseURL is a request option that overrides the base url of the client for a single request.
+func WithRequestBaseURL(baseURL string) RequestOption {
+	return func(o *requestOptions) error {
+		u, err := url.Parse(baseURL)
+		if err != nil {
+			return fmt.Errorf("invalid base url %q: %w", baseURL, err)
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid base url %q: must be an absolute http or https url", baseURL)
+		}
+		o.baseURL = strings.TrimSuffix(baseURL, "/")
+		return nil
+	}
+}
+
+// WithRequestAPIKey is a request option that overrides the api key of the client for a single request.
+func WithRequestAPIKey(apiKey string) RequestOption {
+	return func(o *requestOptions) error {
+		if err := validateHeaderValue("api key", apiKey); err != nil {
+			return err
+		}
+		o.apiKey = apiKey
+		return nil
+	}
+}
+
+// WithRequestOrg is a request option that overrides the organization of the client for a single
+// request, for services that make calls on behalf of several tenants.
+func WithRequestOrg(id string) RequestOption {
+	return func(o *requestOptions) error {
+		if err := validateHeaderValue("organization", id); err != nil {
+			return err
+		}
+		o.org = id
+		return nil
+	}
+}
+
+// WithRequestProject is a request option that overrides the project of the client for a single request.
+func WithRequestProject(id string) RequestOption {
+	return func(o *requestOptions) error {
+		if err := validateHeaderValue("project", id); err != nil {
+			return err
+		}
+		o.project = id
+		return nil
+	}
+}
+
+// WithIdempotencyKey is a request option that sets the Idempotency-Key header, so that retries of
+// the same logical request can be recognized.
+func WithIdempotencyKey(key string) RequestOption {
+	return WithHeader("Idempotency-Key", key)
+}
+
+// WithRequestTimeout is a request option that limits the duration of a single call, including
+// reading the whole stream of streaming calls. It takes precedence over the timeout of the client,
+// so it can also give a long completion or stream more time than WithTimeout allows.
+func WithRequestTimeout(timeout time.Duration) RequestOption {
+	return func(o *requestOptions) error {
+		if timeout <= 0 {
+			return fmt.Errorf("request timeout must be positive, got %s", timeout)
+		}
+		o.timeout = timeout
+		return nil
+	}
+}
+
+// WithRawResponse is a request option that fills raw with the HTTP response of the call once it
+// completes, including for error responses. The body is captured as it is decoded, so it is not
+// parsed twice. raw is left empty if no response was received.
+func WithRawResponse(raw *RawResponse) RequestOption {
+	return func(o *requestOptions) error {
+		if raw == nil {
+			return errors.New("raw response must not be nil")
+		}
+		o.rawResponse = raw
+		return nil
+	}
+}
@@ -0,0 +1,134 @@
+package gpt3_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestOptions(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{}`)),
+	}, nil)
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient), gpt3.WithOrg("org-default"))
+
+	_, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{User: "user"},
+		gpt3.WithHeader("OpenAI-Organization", "org-override"),
+		gpt3.WithHeader("X-Custom", "custom"),
+		gpt3.WithIdempotencyKey("idem-123"),
+		gpt3.WithQueryParam("api-version", "2023-05-15"),
+		gpt3.WithExtraBody("seed", 42),
+		gpt3.WithExtraBody("user", "overridden"),
+		gpt3.WithRequestBaseURL("https://example.com/openai/"),
+		gpt3.WithRequestAPIKey("other-key"),
+	)
+	assert.NoError(t, err)
+
+	req := rt.RoundTripArgsForCall(0)
+	assert.Equal(t, "https://example.com/openai/chat/completions?api-version=2023-05-15", req.URL.String())
+	assert.Equal(t, "org-override", req.Header.Get("OpenAI-Organization"))
+	assert.Equal(t, "custom", req.Header.Get("X-Custom"))
+	assert.Equal(t, "idem-123", req.Header.Get("Idempotency-Key"))
+	assert.Equal(t, "Bearer other-key", req.Header.Get("Authorization"))
+
+	var body map[string]interface{}
+	assert.NoError(t, json.NewDecoder(req.Body).Decode(&body))
+	assert.Equal(t, float64(42), body["seed"])
+	assert.Equal(t, "overridden", body["user"])
+	assert.Equal(t, gpt3.GPT3Dot5Turbo, body["model"])
+}
+
+func TestRequestTimeout(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient))
+
+	start := time.Now()
+	_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{}, gpt3.WithRequestTimeout(10*time.Millisecond))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "context deadline exceeded")
+	assert.True(t, time.Since(start) < time.Second)
+}
+
+func TestRequestTimeoutExtendsClientTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write([]byte(`{"results": []}`))
+	}))
+	defer server.Close()
+	client := gpt3.NewClient("test-key", gpt3.WithBaseURL(server.URL), gpt3.WithTimeout(50*time.Millisecond))
+
+	_, err := client.Moderation(context.Background(), gpt3.ModerationRequest{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Client.Timeout exceeded")
+
+	_, err = client.Moderation(context.Background(), gpt3.ModerationRequest{}, gpt3.WithRequestTimeout(2*time.Second))
+	assert.NoError(t, err)
+}
+
+func TestInvalidRequestOption(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient))
+
+	_, err := client.Moderation(context.Background(), gpt3.ModerationRequest{}, gpt3.WithRequestTimeout(0))
+	assert.EqualError(t, err, "request timeout must be positive, got 0s")
+	_, err = client.Engines(context.Background(), gpt3.WithHeader("X-Bad", "a\nb"))
+	assert.EqualError(t, err, "invalid header X-Bad \"a\\nb\": contains control characters")
+	assert.Equal(t, 0, rt.RoundTripCallCount())
+}
+
+func TestRawResponse(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripStub = func(req *http.Request) (*http.Response, error) {
+		header := make(http.Header)
+		header.Set("X-Request-Id", "req-123")
+		header.Set("Openai-Processing-Ms", "250")
+		header.Set("X-Ratelimit-Remaining-Requests", "99")
+		return &http.Response{
+			StatusCode: 200,
+			Header:     header,
+			Body:       ioutil.NopCloser(bytes.NewBufferString(`{"id": "chatcmpl-1", "unknown_field": true}` + "\n")),
+		}, nil
+	}
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient))
+
+	var raw gpt3.RawResponse
+	rsp, err := client.ChatCompletion(context.Background(), gpt3.ChatCompletionRequest{}, gpt3.WithRawResponse(&raw))
+	assert.NoError(t, err)
+	assert.Equal(t, "chatcmpl-1", rsp.ID)
+	assert.Equal(t, 200, raw.StatusCode)
+	assert.Equal(t, "req-123", raw.RequestID)
+	assert.Equal(t, 250*time.Millisecond, raw.ProcessingTime)
+	assert.Equal(t, 99, raw.RateLimitHeaders.RemainingRequests)
+	assert.Equal(t, `{"id": "chatcmpl-1", "unknown_field": true}`+"\n", string(raw.Body))
+}
+
+func TestRawResponseOnError(t *testing.T) {
+	rt, httpClient := fakeHttpClient()
+	rt.RoundTripReturns(&http.Response{
+		StatusCode: 429,
+		Header:     http.Header{"X-Request-Id": {"req-456"}},
+		Body:       ioutil.NopCloser(bytes.NewBufferString(`{"error": {"message": "slow down", "type": "rate_limit"}}`)),
+	}, nil)
+	client := gpt3.NewClient("test-key", gpt3.WithHTTPClient(httpClient))
+
+	var raw gpt3.RawResponse
+	_, err := client.Embeddings(context.Background(), gpt3.EmbeddingsRequest{}, gpt3.WithRawResponse(&raw))
+	assert.Error(t, err)
+	assert.Equal(t, 429, raw.StatusCode)
+	assert.Equal(t, "req-456", raw.RequestID)
+	assert.Contains(t, string(raw.Body), "slow down")
+}
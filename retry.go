@@ -0,0 +1,81 @@
+package gpt3
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"time"
+)
+
+const (
+	retryBaseDelay = 200 * time.Millisecond
+	retryMaxDelay  = 10 * time.Second
+)
+
+// WithMaxRetries is a client option that retries requests failing with a network error or a 408,
+// 409, 429 or 5xx response up to maxRetries times, with exponential backoff. Only sending the
+// request is retried: a stream that fails after it started is not sent again. The default is 0.
+func WithMaxRetries(maxRetries int) ClientOption {
+	return func(c *client) error {
+		if maxRetries < 0 {
+			return errors.New("max retries must not be negative")
+		}
+		c.maxRetries = maxRetries
+		return nil
+	}
+}
+
+// isRetryable reports whether a request that failed with err may succeed if sent again.
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	var apiErr APIError
+	if !errors.As(err, &apiErr) {
+		// the request didn't get a response, e.g. the connection was reset
+		return true
+	}
+	switch apiErr.StatusCode {
+	case http.StatusRequestTimeout, http.StatusConflict, http.StatusTooManyRequests:
+		return true
+	}
+	return apiErr.StatusCode >= 500
+}
+
+// retryDelay returns how long to wait before the given retry, doubling with every retry and
+// waiting at least until the rate limit resets when the response says so.
+func retryDelay(retry int, err error) time.Duration {
+	delay := retryBaseDelay << (retry - 1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	// add jitter so that clients rate limited together don't retry together
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	var apiErr APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusTooManyRequests {
+		reset := apiErr.RateLimitHeaders.ResetRequests
+		if apiErr.RateLimitHeaders.ResetTokens > reset {
+			reset = apiErr.RateLimitHeaders.ResetTokens
+		}
+		if reset > delay {
+			delay = reset
+		}
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+	}
+	return delay
+}
+
+// sleep waits for d, returning early with the context's error if it is done first.
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+package gpt3
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+)
+
+// DefaultSearchModel is the embedding model Search uses unless WithSearchModel sets another.
+const DefaultSearchModel = TextEmbedding3Small
+
+// WithSearchModel is a client option that sets the embedding model used by Search, and by
+// SearchWithEngine when its engine is not an embedding model. Defaults to DefaultSearchModel.
+func WithSearchModel(model string) ClientOption {
+	return func(c *client) error {
+		if model == "" {
+			return errors.New("search model must not be empty")
+		}
+		c.searchModel = model
+		return nil
+	}
+}
+
+// WithSearchCache is a client option that keeps the embeddings of the documents searched in
+// cache, so that searching the same documents again only embeds the query.
+func WithSearchCache(cache EmbeddingCache) ClientOption {
+	return func(c *client) error {
+		if cache == nil {
+			return errors.New("search cache must not be nil")
+		}
+		c.searchCache = cache
+		return nil
+	}
+}
+
+// EmbeddingCache stores embeddings by the model and the text they were created from. It must be
+// safe for concurrent use.
+type EmbeddingCache interface {
+	// Get returns the embedding of text created with model, if it is cached.
+	Get(model, text string) ([]float32, bool)
+	// Put caches the embedding of text created with model.
+	Put(model, text string, embedding []float32)
+}
+
+// NewEmbeddingCache returns an in-memory EmbeddingCache that holds up to size embeddings,
+// evicting the least recently used ones once it is full.
+func NewEmbeddingCache(size int) EmbeddingCache {
+	return &lruEmbeddingCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+type lruEmbeddingCache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type cachedEmbedding struct {
+	key       string
+	embedding []float32
+}
+
+func (c *lruEmbeddingCache) Get(model, text string) ([]float32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[model+"\x00"+text]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*cachedEmbedding).embedding, true
+}
+
+func (c *lruEmbeddingCache) Put(model, text string, embedding []float32) {
+	if c.size <= 0 {
+		return
+	}
+	key := model + "\x00" + text
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cachedEmbedding).embedding = embedding
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cachedEmbedding{key: key, embedding: embedding})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedEmbedding).key)
+	}
+}
+
+// search embeds the query and the documents of request with model and scores each document by
+// the cosine similarity of its embedding to the query's.
+func (c *client) search(ctx context.Context, model string, request SearchRequest, opts []RequestOption) (*SearchResponse, error) {
+	output := &SearchResponse{Object: "list", Data: []SearchData{}}
+	if len(request.Documents) == 0 {
+		return output, nil
+	}
+
+	// the query is always embedded, and documents only if they aren't cached
+	embeddings := make([][]float32, len(request.Documents))
+	texts := []string{request.Query}
+	var missing []int
+	for i, document := range request.Documents {
+		if c.searchCache != nil {
+			if embedding, ok := c.searchCache.Get(model, document); ok {
+				embeddings[i] = embedding
+				continue
+			}
+		}
+		texts = append(texts, document)
+		missing = append(missing, i)
+	}
+	// retries are left to the client, as configured by WithMaxRetries
+	embedded, err := EmbedAll(ctx, c, model, texts, WithEmbedRetries(0), WithEmbedRequestOptions(opts...))
+	if err != nil {
+		return nil, err
+	}
+	query := embedded[0]
+	for j, i := range missing {
+		embeddings[i] = embedded[j+1]
+		if c.searchCache != nil {
+			c.searchCache.Put(model, request.Documents[i], embeddings[i])
+		}
+	}
+
+	for i, embedding := range embeddings {
+		if len(embedding) != len(query) {
+			return nil, fmt.Errorf("embedding of document %d has %d dimensions, the query has %d", i, len(embedding), len(query))
+		}
+		output.Data = append(output.Data, SearchData{
+			Document: i,
+			Object:   "search_result",
+			Score:    cosineSimilarity(query, embedding),
+		})
+	}
+	return output, nil
+}
+
+// isEmbeddingModel reports whether model is an OpenAI embedding model, rather than the name of a
+// completion engine.
+func isEmbeddingModel(model string) bool {
+	return strings.HasPrefix(model, "text-embedding-")
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
@@ -0,0 +1,101 @@
+package gpt3_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3"
+	"github.com/PullRequestInc/go-gpt3/gpt3test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	client := server.Client()
+
+	rsp, err := client.Search(context.Background(), gpt3.SearchRequest{
+		Documents: []string{"a blue sky", "a red apple", "a green field"},
+		Query:     "a red apple",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "list", rsp.Object)
+	assert.Len(t, rsp.Data, 3)
+	for i, data := range rsp.Data {
+		assert.Equal(t, i, data.Document)
+		assert.Equal(t, "search_result", data.Object)
+	}
+	assert.InDelta(t, 1, rsp.Data[1].Score, 1e-6)
+	assert.Less(t, rsp.Data[0].Score, 0.5)
+	assert.Less(t, rsp.Data[2].Score, 0.5)
+
+	requests := server.Requests()
+	assert.Len(t, requests, 1)
+	var request gpt3.EmbeddingsRequest
+	assert.NoError(t, json.Unmarshal(requests[0].Body, &request))
+	assert.Equal(t, gpt3.DefaultSearchModel, request.Model)
+	assert.Equal(t, []string{"a red apple", "a blue sky", "a red apple", "a green field"}, request.Input)
+}
+
+func TestSearchWithEngine(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	client := server.Client(gpt3.WithSearchModel(gpt3.TextEmbeddingAda002))
+
+	for engine, model := range map[string]string{
+		gpt3.AdaEngine:           gpt3.TextEmbeddingAda002,
+		gpt3.TextEmbedding3Large: gpt3.TextEmbedding3Large,
+	} {
+		_, err := client.SearchWithEngine(context.Background(), engine, gpt3.SearchRequest{
+			Documents: []string{"document"},
+			Query:     "query",
+		})
+		assert.NoError(t, err)
+		requests := server.Requests()
+		var request gpt3.EmbeddingsRequest
+		assert.NoError(t, json.Unmarshal(requests[len(requests)-1].Body, &request))
+		assert.Equal(t, model, request.Model, engine)
+	}
+}
+
+func TestSearchCache(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+	client := server.Client(gpt3.WithSearchCache(gpt3.NewEmbeddingCache(2)))
+	ctx := context.Background()
+
+	first, err := client.Search(ctx, gpt3.SearchRequest{Documents: []string{"one", "two"}, Query: "query"})
+	assert.NoError(t, err)
+	second, err := client.Search(ctx, gpt3.SearchRequest{Documents: []string{"one", "two"}, Query: "query"})
+	assert.NoError(t, err)
+	assert.Equal(t, first, second)
+	// "two" is the least recently used, so it is evicted to make room for "three"
+	_, err = client.Search(ctx, gpt3.SearchRequest{Documents: []string{"three", "two", "one"}, Query: "query"})
+	assert.NoError(t, err)
+	_, err = client.Search(ctx, gpt3.SearchRequest{Documents: []string{"two"}, Query: "query"})
+	assert.NoError(t, err)
+
+	var inputs [][]string
+	for _, r := range server.Requests() {
+		var request gpt3.EmbeddingsRequest
+		assert.NoError(t, json.Unmarshal(r.Body, &request))
+		inputs = append(inputs, request.Input)
+	}
+	assert.Equal(t, [][]string{
+		{"query", "one", "two"},
+		{"query"},
+		{"query", "three"},
+		{"query", "two"},
+	}, inputs)
+}
+
+func TestSearchWithoutDocuments(t *testing.T) {
+	server := gpt3test.NewServer()
+	defer server.Close()
+
+	rsp, err := server.Client().Search(context.Background(), gpt3.SearchRequest{Query: "query"})
+	assert.NoError(t, err)
+	assert.Empty(t, rsp.Data)
+	assert.Empty(t, server.Requests())
+}
@@ -0,0 +1,180 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"io"
+	"sync"
+)
+
+// Flat is an exact index that compares the query with every item.
+type Flat struct {
+	space
+
+	mu    sync.RWMutex
+	items []Item
+	ids   map[string]int
+}
+
+var _ Index = (*Flat)(nil)
+
+// NewFlat returns an empty Flat index of vectors with dims dimensions compared with metric.
+func NewFlat(dims int, metric Metric) *Flat {
+	return &Flat{space: space{dims: dims, metric: metric}, ids: map[string]int{}}
+}
+
+// Add adds items to the index, replacing items with the same ID. Vectors and metadata are copied.
+func (f *Flat) Add(items ...Item) error {
+	prepared := make([]Item, len(items))
+	for i, item := range items {
+		vector, err := f.prepare(item.Vector)
+		if err != nil {
+			return err
+		}
+		prepared[i] = copyItem(item)
+		prepared[i].Vector = vector
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, item := range prepared {
+		if i, ok := f.ids[item.ID]; ok {
+			f.items[i] = item
+			continue
+		}
+		f.ids[item.ID] = len(f.items)
+		f.items = append(f.items, item)
+	}
+	return nil
+}
+
+// Delete removes the items with the given IDs, returning how many were found.
+func (f *Flat) Delete(ids ...string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	deleted := 0
+	for _, id := range ids {
+		i, ok := f.ids[id]
+		if !ok {
+			continue
+		}
+		// move the last item into the gap
+		last := len(f.items) - 1
+		f.items[i] = f.items[last]
+		f.ids[f.items[i].ID] = i
+		f.items[last] = Item{}
+		f.items = f.items[:last]
+		delete(f.ids, id)
+		deleted++
+	}
+	return deleted
+}
+
+// Get returns the item with the given ID. For Cosine its vector is normalized.
+func (f *Flat) Get(id string) (Item, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	i, ok := f.ids[id]
+	if !ok {
+		return Item{}, false
+	}
+	return copyItem(f.items[i]), true
+}
+
+// Len returns the number of items in the index.
+func (f *Flat) Len() int {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.items)
+}
+
+// Search returns up to k items most similar to query that pass filter, which may be nil.
+func (f *Flat) Search(query []float32, k int, filter Filter) ([]Result, error) {
+	q, err := f.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	// keep the k closest items in a max heap, so the furthest of them is the one to replace
+	best := &maxHeap{}
+	for i, item := range f.items {
+		if filter != nil && !filter(item) {
+			continue
+		}
+		d := f.distance(q, item.Vector)
+		if best.Len() < k {
+			heap.Push(best, candidate{id: int32(i), distance: d})
+		} else if d < (*best)[0].distance {
+			(*best)[0] = candidate{id: int32(i), distance: d}
+			heap.Fix(best, 0)
+		}
+	}
+
+	results := make([]Result, best.Len())
+	for i, c := range *best {
+		results[i] = Result{Item: copyItem(f.items[c.id]), Score: f.score(c.distance)}
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// Save writes the index in the binary format read by Load.
+func (f *Flat) Save(w io.Writer) error {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	e := newEncoder(w, kindFlat, f.space)
+	e.uvarint(uint64(len(f.items)))
+	for _, item := range f.items {
+		e.item(item)
+	}
+	return e.err
+}
+
+func loadFlat(d *decoder, s space) *Flat {
+	f := &Flat{space: s, ids: map[string]int{}}
+	n := d.count(1 << 40)
+	for i := 0; i < n && d.err == nil; i++ {
+		item := d.item(s.dims)
+		f.ids[item.ID] = len(f.items)
+		f.items = append(f.items, item)
+	}
+	return f
+}
+
+// candidate is an item found while searching, by its position in the index.
+type candidate struct {
+	id       int32
+	distance float32
+}
+
+// minHeap pops the closest candidate first.
+type minHeap []candidate
+
+func (h minHeap) Len() int            { return len(h) }
+func (h minHeap) Less(i, j int) bool  { return h[i].distance < h[j].distance }
+func (h minHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *minHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// maxHeap pops the furthest candidate first.
+type maxHeap []candidate
+
+func (h maxHeap) Len() int            { return len(h) }
+func (h maxHeap) Less(i, j int) bool  { return h[i].distance > h[j].distance }
+func (h maxHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *maxHeap) Push(x interface{}) { *h = append(*h, x.(candidate)) }
+func (h *maxHeap) Pop() interface{} {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
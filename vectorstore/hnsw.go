@@ -0,0 +1,536 @@
+package vectorstore
+
+import (
+	"container/heap"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+)
+
+// Defaults of the HNSW parameters, see the HNSWOption functions.
+const (
+	DefaultM              = 16
+	DefaultEfConstruction = 200
+	DefaultEfSearch       = 64
+)
+
+// HNSWOption are options that can be passed to NewHNSW.
+type HNSWOption func(*HNSW) error
+
+// WithM sets the number of neighbors of each node on the upper layers of the graph, twice that on
+// the bottom layer, at least 2. Higher values improve recall at the cost of memory and insertion
+// time.
+func WithM(m int) HNSWOption {
+	return func(h *HNSW) error {
+		if m < 2 {
+			return fmt.Errorf("M must be at least 2, got %d", m)
+		}
+		h.m = m
+		return nil
+	}
+}
+
+// WithEfConstruction sets the number of candidates considered when inserting a node. Higher
+// values build a better graph more slowly.
+func WithEfConstruction(ef int) HNSWOption {
+	return func(h *HNSW) error {
+		if ef <= 0 {
+			return fmt.Errorf("ef construction must be positive, got %d", ef)
+		}
+		h.efConstruction = ef
+		return nil
+	}
+}
+
+// WithEfSearch sets the number of candidates considered by a search, at least k. Higher values
+// improve recall at the cost of search time.
+func WithEfSearch(ef int) HNSWOption {
+	return func(h *HNSW) error {
+		if ef <= 0 {
+			return fmt.Errorf("ef search must be positive, got %d", ef)
+		}
+		h.efSearch = ef
+		return nil
+	}
+}
+
+// WithSeed seeds the random levels of nodes, so that the same inserts build the same graph.
+func WithSeed(seed int64) HNSWOption {
+	return func(h *HNSW) error {
+		h.rng = rand.New(rand.NewSource(seed))
+		return nil
+	}
+}
+
+// HNSW is an approximate index that searches a hierarchical navigable small world graph.
+//
+// Deleted items are only marked as deleted, as the graph still needs them to be navigable. Their
+// space is reclaimed by Compact, or when the index is saved and loaded.
+type HNSW struct {
+	space
+	m              int
+	efConstruction int
+	efSearch       int
+
+	mu         sync.RWMutex
+	rng        *rand.Rand
+	nodes      []*hnswNode
+	ids        map[string]int32
+	entry      int32
+	maxLevel   int
+	deleted    int
+	levelScale float64
+	// visited holds *visitedSets reused by searches
+	visited sync.Pool
+}
+
+type hnswNode struct {
+	item    Item
+	deleted bool
+	// neighbors holds the neighbors of the node on each layer it is on, from the bottom up
+	neighbors [][]int32
+}
+
+var _ Index = (*HNSW)(nil)
+
+// NewHNSW returns an empty HNSW index of vectors with dims dimensions compared with metric. It
+// fails if an option is invalid.
+func NewHNSW(dims int, metric Metric, options ...HNSWOption) (*HNSW, error) {
+	h := &HNSW{
+		space:          space{dims: dims, metric: metric},
+		m:              DefaultM,
+		efConstruction: DefaultEfConstruction,
+		efSearch:       DefaultEfSearch,
+		rng:            rand.New(rand.NewSource(rand.Int63())),
+		ids:            map[string]int32{},
+		entry:          -1,
+	}
+	for _, o := range options {
+		if err := o(h); err != nil {
+			return nil, err
+		}
+	}
+	h.levelScale = 1 / math.Log(float64(h.m))
+	return h, nil
+}
+
+// Add adds items to the index, replacing items with the same ID. Vectors and metadata are copied.
+func (h *HNSW) Add(items ...Item) error {
+	prepared := make([]Item, len(items))
+	for i, item := range items {
+		vector, err := h.prepare(item.Vector)
+		if err != nil {
+			return err
+		}
+		prepared[i] = copyItem(item)
+		prepared[i].Vector = vector
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, item := range prepared {
+		if id, ok := h.ids[item.ID]; ok {
+			h.nodes[id].deleted = true
+			h.deleted++
+		}
+		h.insert(item)
+	}
+	return nil
+}
+
+// insert adds a node to the graph. h.mu must be held.
+func (h *HNSW) insert(item Item) {
+	id := int32(len(h.nodes))
+	level := int(-math.Log(1-h.rng.Float64()) * h.levelScale)
+	node := &hnswNode{item: item, neighbors: make([][]int32, level+1)}
+	h.nodes = append(h.nodes, node)
+	h.ids[item.ID] = id
+	if h.entry < 0 {
+		h.entry, h.maxLevel = id, level
+		return
+	}
+
+	// descend greedily to the top layer of the new node, then link it on each layer below
+	entry := h.entry
+	for l := h.maxLevel; l > level; l-- {
+		entry = h.closest(item.Vector, entry, l)
+	}
+	entries := []int32{entry}
+	for l := minInt(level, h.maxLevel); l >= 0; l-- {
+		found := h.searchLayer(item.Vector, entries, h.efConstruction, l)
+		neighbors := h.selectNeighbors(found, h.maxNeighbors(l))
+		node.neighbors[l] = neighbors
+		for _, n := range neighbors {
+			h.link(n, id, l)
+		}
+		entries = entries[:0]
+		for _, c := range found {
+			entries = append(entries, c.id)
+		}
+	}
+	if level > h.maxLevel {
+		h.entry, h.maxLevel = id, level
+	}
+}
+
+func (h *HNSW) maxNeighbors(level int) int {
+	if level == 0 {
+		return 2 * h.m
+	}
+	return h.m
+}
+
+// link adds to as a neighbor of from on a layer, dropping from's furthest neighbors if it has too many.
+func (h *HNSW) link(from, to int32, level int) {
+	node := h.nodes[from]
+	node.neighbors[level] = append(node.neighbors[level], to)
+	if len(node.neighbors[level]) <= h.maxNeighbors(level) {
+		return
+	}
+	candidates := make([]candidate, len(node.neighbors[level]))
+	for i, n := range node.neighbors[level] {
+		candidates[i] = candidate{id: n, distance: h.distance(node.item.Vector, h.nodes[n].item.Vector)}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].distance < candidates[j].distance })
+	node.neighbors[level] = h.selectNeighbors(candidates, h.maxNeighbors(level))
+}
+
+// selectNeighbors picks up to max neighbors from candidates sorted by distance with the heuristic
+// of the HNSW paper: a candidate is skipped if it is closer to an already selected neighbor than
+// to the node, which keeps links spread in every direction. Skipped candidates fill any room left.
+func (h *HNSW) selectNeighbors(candidates []candidate, max int) []int32 {
+	selected := make([]int32, 0, max)
+	var skipped []int32
+	for _, c := range candidates {
+		if len(selected) == max {
+			break
+		}
+		diverse := true
+		for _, s := range selected {
+			if h.distance(h.nodes[c.id].item.Vector, h.nodes[s].item.Vector) < c.distance {
+				diverse = false
+				break
+			}
+		}
+		if diverse {
+			selected = append(selected, c.id)
+		} else {
+			skipped = append(skipped, c.id)
+		}
+	}
+	for _, id := range skipped {
+		if len(selected) == max {
+			break
+		}
+		selected = append(selected, id)
+	}
+	return selected
+}
+
+// closest greedily walks a layer from entry to the node closest to query.
+func (h *HNSW) closest(query []float32, entry int32, level int) int32 {
+	best := h.distance(query, h.nodes[entry].item.Vector)
+	for changed := true; changed; {
+		changed = false
+		for _, n := range h.nodes[entry].neighbors[level] {
+			if d := h.distance(query, h.nodes[n].item.Vector); d < best {
+				best, entry, changed = d, n, true
+			}
+		}
+	}
+	return entry
+}
+
+// searchLayer returns the ef nodes closest to query found on a layer from the entries, sorted
+// from the closest. Deleted nodes are included, as they still connect the graph.
+func (h *HNSW) searchLayer(query []float32, entries []int32, ef int, level int) []candidate {
+	visited, _ := h.visited.Get().(*visitedSet)
+	if visited == nil {
+		visited = &visitedSet{}
+	}
+	defer h.visited.Put(visited)
+	visited.reset(len(h.nodes))
+	candidates := &minHeap{}
+	found := &maxHeap{}
+	for _, e := range entries {
+		visited.visit(e)
+		c := candidate{id: e, distance: h.distance(query, h.nodes[e].item.Vector)}
+		heap.Push(candidates, c)
+		heap.Push(found, c)
+	}
+	for candidates.Len() > 0 {
+		c := heap.Pop(candidates).(candidate)
+		if found.Len() >= ef && c.distance > (*found)[0].distance {
+			break
+		}
+		for _, n := range h.nodes[c.id].neighbors[level] {
+			if visited.visit(n) {
+				continue
+			}
+			d := h.distance(query, h.nodes[n].item.Vector)
+			if found.Len() < ef || d < (*found)[0].distance {
+				heap.Push(candidates, candidate{id: n, distance: d})
+				heap.Push(found, candidate{id: n, distance: d})
+				if found.Len() > ef {
+					heap.Pop(found)
+				}
+			}
+		}
+	}
+	result := make([]candidate, found.Len())
+	for i := len(result) - 1; i >= 0; i-- {
+		result[i] = heap.Pop(found).(candidate)
+	}
+	return result
+}
+
+// Delete removes the items with the given IDs, returning how many were found.
+func (h *HNSW) Delete(ids ...string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	deleted := 0
+	for _, id := range ids {
+		if n, ok := h.ids[id]; ok {
+			h.nodes[n].deleted = true
+			delete(h.ids, id)
+			h.deleted++
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Get returns the item with the given ID. For Cosine its vector is normalized.
+func (h *HNSW) Get(id string) (Item, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	n, ok := h.ids[id]
+	if !ok {
+		return Item{}, false
+	}
+	return copyItem(h.nodes[n].item), true
+}
+
+// Len returns the number of items in the index.
+func (h *HNSW) Len() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.ids)
+}
+
+// Search returns up to k items most similar to query that pass filter, which may be nil. If the
+// graph search finds fewer than k items that pass a filter, the items are searched exhaustively,
+// so that selective filters still return every match.
+func (h *HNSW) Search(query []float32, k int, filter Filter) ([]Result, error) {
+	q, err := h.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	if k <= 0 {
+		return nil, nil
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.entry < 0 {
+		return nil, nil
+	}
+	entry := h.entry
+	for l := h.maxLevel; l > 0; l-- {
+		entry = h.closest(q, entry, l)
+	}
+	found := h.searchLayer(q, []int32{entry}, maxInt(h.efSearch, k), 0)
+
+	results := make([]Result, 0, k)
+	for _, c := range found {
+		node := h.nodes[c.id]
+		if node.deleted || (filter != nil && !filter(node.item)) {
+			continue
+		}
+		results = append(results, Result{Item: copyItem(node.item), Score: h.score(c.distance)})
+		if len(results) == k {
+			break
+		}
+	}
+	if len(results) < k && len(results) < len(h.ids) && (filter != nil || h.deleted > 0) {
+		results = h.exhaustive(q, k, filter)
+	}
+	sortResults(results)
+	return results, nil
+}
+
+// exhaustive compares the query with every node. h.mu must be held.
+func (h *HNSW) exhaustive(query []float32, k int, filter Filter) []Result {
+	best := &maxHeap{}
+	for i, node := range h.nodes {
+		if node.deleted || (filter != nil && !filter(node.item)) {
+			continue
+		}
+		d := h.distance(query, node.item.Vector)
+		if best.Len() < k {
+			heap.Push(best, candidate{id: int32(i), distance: d})
+		} else if d < (*best)[0].distance {
+			(*best)[0] = candidate{id: int32(i), distance: d}
+			heap.Fix(best, 0)
+		}
+	}
+	results := make([]Result, best.Len())
+	for i, c := range *best {
+		results[i] = Result{Item: copyItem(h.nodes[c.id].item), Score: h.score(c.distance)}
+	}
+	return results
+}
+
+// Compact rebuilds the graph without the deleted items, reclaiming their memory.
+func (h *HNSW) Compact() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.deleted == 0 {
+		return
+	}
+	nodes := h.nodes
+	h.nodes, h.ids, h.entry, h.maxLevel, h.deleted = nil, map[string]int32{}, -1, 0, 0
+	for _, node := range nodes {
+		if !node.deleted {
+			h.insert(node.item)
+		}
+	}
+}
+
+// Save writes the index in the binary format read by Load. Deleted items are left out, along
+// with the links to them.
+func (h *HNSW) Save(w io.Writer) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	// number the live nodes consecutively
+	live := make([]int32, len(h.nodes))
+	count := 0
+	for i, node := range h.nodes {
+		live[i] = -1
+		if !node.deleted {
+			live[i] = int32(count)
+			count++
+		}
+	}
+
+	e := newEncoder(w, kindHNSW, h.space)
+	e.uvarint(uint64(h.m))
+	e.uvarint(uint64(h.efConstruction))
+	e.uvarint(uint64(h.efSearch))
+	e.uvarint(uint64(count))
+	for _, node := range h.nodes {
+		if node.deleted {
+			continue
+		}
+		e.item(node.item)
+		e.uvarint(uint64(len(node.neighbors)))
+		for _, neighbors := range node.neighbors {
+			links := make([]int32, 0, len(neighbors))
+			for _, n := range neighbors {
+				if live[n] >= 0 {
+					links = append(links, live[n])
+				}
+			}
+			e.uvarint(uint64(len(links)))
+			for _, n := range links {
+				e.uvarint(uint64(n))
+			}
+		}
+	}
+	return e.err
+}
+
+func loadHNSW(d *decoder, s space) *HNSW {
+	h, err := NewHNSW(s.dims, s.metric,
+		WithM(d.count(1<<16)), WithEfConstruction(d.count(1<<20)), WithEfSearch(d.count(1<<20)))
+	if err != nil {
+		if d.err == nil {
+			d.err = err
+		}
+		return nil
+	}
+	n := d.count(math.MaxInt32)
+	for i := 0; i < n && d.err == nil; i++ {
+		node := &hnswNode{item: d.item(s.dims)}
+		node.neighbors = make([][]int32, d.count(64))
+		for l := range node.neighbors {
+			node.neighbors[l] = make([]int32, d.count(1<<16))
+			for j := range node.neighbors[l] {
+				node.neighbors[l][j] = int32(d.count(uint64(n - 1)))
+			}
+		}
+		if d.err != nil {
+			break
+		}
+		id := int32(len(h.nodes))
+		h.nodes = append(h.nodes, node)
+		h.ids[node.item.ID] = id
+		if level := len(node.neighbors) - 1; h.entry < 0 || level > h.maxLevel {
+			h.entry, h.maxLevel = id, level
+		}
+	}
+	// check the links, so that a corrupt file can't make searches panic
+	for _, node := range h.nodes {
+		if d.err != nil {
+			break
+		}
+		if len(node.neighbors) == 0 {
+			d.err = errors.New("node without layers")
+		}
+		for l, neighbors := range node.neighbors {
+			for _, n := range neighbors {
+				if len(h.nodes[n].neighbors) <= l {
+					d.err = fmt.Errorf("link to node %d on layer %d it isn't on", n, l)
+				}
+			}
+		}
+	}
+	return h
+}
+
+// visitedSet records the nodes visited by a search. Marking nodes with the number of the search
+// makes resetting it for the next search free.
+type visitedSet struct {
+	marks []uint32
+	mark  uint32
+}
+
+func (v *visitedSet) reset(nodes int) {
+	if len(v.marks) < nodes {
+		v.marks = append(v.marks, make([]uint32, nodes-len(v.marks))...)
+	}
+	v.mark++
+	if v.mark == 0 {
+		for i := range v.marks {
+			v.marks[i] = 0
+		}
+		v.mark = 1
+	}
+}
+
+// visit marks a node as visited and reports whether it already was.
+func (v *visitedSet) visit(id int32) bool {
+	if v.marks[id] == v.mark {
+		return true
+	}
+	v.marks[id] = v.mark
+	return false
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,391 @@
+// Package vectorstore provides in-memory indexes of embedding vectors with similarity search.
+//
+// Flat is an exact index that compares the query with every vector, which is fast enough for up
+// to about a hundred thousand vectors. HNSW is an approximate index, a hierarchical navigable
+// small world graph, that answers queries over millions of vectors in well under a millisecond
+// with a small loss of recall. Both support cosine, dot product and euclidean similarity, top-k
+// search with metadata filters, adding and deleting items at any time, and saving to a compact
+// binary file:
+//
+//	index, err := vectorstore.NewHNSW(1536, vectorstore.Cosine)
+//	err = index.Add(vectorstore.Item{ID: "doc-1", Vector: embedding, Metadata: map[string]string{"lang": "en"}})
+//	results, err := index.Search(query, 10, vectorstore.MetadataEquals("lang", "en"))
+package vectorstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Metric is the similarity measure used by an index.
+type Metric int
+
+const (
+	// Cosine is the cosine of the angle between vectors. Vectors are normalized when they are
+	// added, so they don't have to be normalized beforehand.
+	Cosine Metric = iota
+	// DotProduct is the dot product of the vectors.
+	DotProduct
+	// Euclidean is the euclidean distance between vectors. Scores are the negative distance, so
+	// that higher scores are more similar for every metric.
+	Euclidean
+)
+
+func (m Metric) String() string {
+	switch m {
+	case Cosine:
+		return "cosine"
+	case DotProduct:
+		return "dot"
+	case Euclidean:
+		return "euclidean"
+	}
+	return fmt.Sprintf("Metric(%d)", int(m))
+}
+
+// Item is a vector stored in an index, identified by its ID.
+type Item struct {
+	ID       string
+	Vector   []float32
+	Metadata map[string]string
+}
+
+// Result is an item found by a search, with its similarity to the query.
+type Result struct {
+	Item
+	// Score is the similarity of the item to the query; higher is more similar.
+	Score float32
+}
+
+// Filter reports whether an item may be returned by a search.
+type Filter func(item Item) bool
+
+// MetadataEquals returns a Filter that matches items whose metadata has key set to value.
+func MetadataEquals(key, value string) Filter {
+	return func(item Item) bool {
+		v, ok := item.Metadata[key]
+		return ok && v == value
+	}
+}
+
+// Index is a searchable collection of vectors. It is implemented by Flat and HNSW, which are
+// safe for concurrent use.
+type Index interface {
+	// Add adds items to the index, replacing items with the same ID.
+	Add(items ...Item) error
+	// Delete removes the items with the given IDs, returning how many were found.
+	Delete(ids ...string) int
+	// Get returns the item with the given ID.
+	Get(id string) (Item, bool)
+	// Len returns the number of items in the index.
+	Len() int
+	// Search returns up to k items most similar to query that pass filter, which may be nil,
+	// from the most to the least similar.
+	Search(query []float32, k int, filter Filter) ([]Result, error)
+	// Save writes the index in the binary format read by Load.
+	Save(w io.Writer) error
+}
+
+// Similarity returns the similarity of two vectors of the same length with metric, as reported
+// in Result.Score.
+func Similarity(metric Metric, a, b []float32) float32 {
+	switch metric {
+	case Cosine:
+		na, nb := norm(a), norm(b)
+		if na == 0 || nb == 0 {
+			return 0
+		}
+		return dot(a, b) / (na * nb)
+	case Euclidean:
+		return -float32(math.Sqrt(float64(squaredDistance(a, b))))
+	}
+	return dot(a, b)
+}
+
+func dot(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+func squaredDistance(a, b []float32) float32 {
+	var sum float32
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return sum
+}
+
+func norm(v []float32) float32 {
+	return float32(math.Sqrt(float64(dot(v, v))))
+}
+
+// normalized returns a unit length copy of v.
+func normalized(v []float32) []float32 {
+	out := make([]float32, len(v))
+	n := norm(v)
+	if n == 0 {
+		return out
+	}
+	for i := range v {
+		out[i] = v[i] / n
+	}
+	return out
+}
+
+// space holds what both indexes need to compare vectors with a metric.
+type space struct {
+	dims   int
+	metric Metric
+}
+
+// prepare validates a vector and returns the copy of it that is stored, normalized for Cosine.
+func (s space) prepare(v []float32) ([]float32, error) {
+	if len(v) != s.dims {
+		return nil, fmt.Errorf("vector has %d dimensions, the index has %d", len(v), s.dims)
+	}
+	if s.metric == Cosine {
+		return normalized(v), nil
+	}
+	return append([]float32(nil), v...), nil
+}
+
+// distance compares prepared vectors, with lower being more similar.
+func (s space) distance(a, b []float32) float32 {
+	if s.metric == Euclidean {
+		return squaredDistance(a, b)
+	}
+	return -dot(a, b)
+}
+
+// score converts a distance into the similarity reported in Result.Score.
+func (s space) score(distance float32) float32 {
+	if s.metric == Euclidean {
+		return -float32(math.Sqrt(float64(distance)))
+	}
+	return -distance
+}
+
+func copyItem(item Item) Item {
+	item.Vector = append([]float32(nil), item.Vector...)
+	if item.Metadata != nil {
+		metadata := make(map[string]string, len(item.Metadata))
+		for k, v := range item.Metadata {
+			metadata[k] = v
+		}
+		item.Metadata = metadata
+	}
+	return item
+}
+
+// sortResults orders results from the most to the least similar, by ID for equal scores.
+func sortResults(results []Result) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].ID < results[j].ID
+	})
+}
+
+// The binary format starts with a header: the magic, the format version, the index kind, the
+// metric and the number of dimensions. Integers are uvarints unless noted, strings are a length
+// followed by bytes, and vectors are little-endian float32 values.
+var magic = []byte("GVS")
+
+const formatVersion = 1
+
+// maxDims bounds the number of dimensions read from a file, which sets the size of every vector.
+const maxDims = 1 << 20
+
+const (
+	kindFlat = 1
+	kindHNSW = 2
+)
+
+// Load reads an index written by the Save method of Flat or HNSW.
+func Load(r io.Reader) (Index, error) {
+	d := &decoder{r: bufio.NewReader(r)}
+	header := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return nil, fmt.Errorf("vectorstore: failed to read header: %w", err)
+	}
+	if string(header[:len(magic)]) != string(magic) {
+		return nil, errors.New("vectorstore: not a vector index file")
+	}
+	if header[len(magic)] != formatVersion {
+		return nil, fmt.Errorf("vectorstore: unsupported format version %d", header[len(magic)])
+	}
+	kind, metric, dims := d.uvarint(), d.uvarint(), d.count(maxDims)
+	if d.err != nil {
+		return nil, fmt.Errorf("vectorstore: failed to read header: %w", d.err)
+	}
+	if metric > uint64(Euclidean) {
+		return nil, fmt.Errorf("vectorstore: unknown metric %d", metric)
+	}
+	s := space{metric: Metric(metric), dims: dims}
+
+	var index Index
+	switch kind {
+	case kindFlat:
+		index = loadFlat(d, s)
+	case kindHNSW:
+		index = loadHNSW(d, s)
+	default:
+		return nil, fmt.Errorf("vectorstore: unknown index kind %d", kind)
+	}
+	if d.err != nil {
+		return nil, fmt.Errorf("vectorstore: invalid index: %w", d.err)
+	}
+	return index, nil
+}
+
+// SaveFile saves index to the file at path, replacing it atomically.
+func SaveFile(index Index, path string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), ".vectorstore-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	w := bufio.NewWriter(f)
+	if err := index.Save(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// LoadFile loads an index from the file at path.
+func LoadFile(path string) (Index, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
+
+type encoder struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func newEncoder(w io.Writer, kind int, s space) *encoder {
+	e := &encoder{w: w}
+	e.write(append(append([]byte(nil), magic...), formatVersion))
+	e.uvarint(uint64(kind))
+	e.uvarint(uint64(s.metric))
+	e.uvarint(uint64(s.dims))
+	return e
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+func (e *encoder) uvarint(v uint64) {
+	n := binary.PutUvarint(e.buf[:], v)
+	e.write(e.buf[:n])
+}
+
+func (e *encoder) string(s string) {
+	e.uvarint(uint64(len(s)))
+	e.write([]byte(s))
+}
+
+func (e *encoder) item(item Item) {
+	e.string(item.ID)
+	keys := make([]string, 0, len(item.Metadata))
+	for k := range item.Metadata {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	e.uvarint(uint64(len(keys)))
+	for _, k := range keys {
+		e.string(k)
+		e.string(item.Metadata[k])
+	}
+	data := make([]byte, 4*len(item.Vector))
+	for i, v := range item.Vector {
+		binary.LittleEndian.PutUint32(data[i*4:], math.Float32bits(v))
+	}
+	e.write(data)
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var v uint64
+	v, d.err = binary.ReadUvarint(d.r)
+	return v
+}
+
+// count reads a length, rejecting values that can't be right so corrupt files don't cause huge allocations.
+func (d *decoder) count(max uint64) int {
+	v := d.uvarint()
+	if d.err == nil && v > max {
+		d.err = fmt.Errorf("length %d exceeds %d", v, max)
+		return 0
+	}
+	return int(v)
+}
+
+func (d *decoder) string() string {
+	n := d.count(1 << 30)
+	if d.err != nil {
+		return ""
+	}
+	buf := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, buf)
+	return string(buf)
+}
+
+func (d *decoder) item(dims int) Item {
+	item := Item{ID: d.string()}
+	if n := d.count(1 << 20); n > 0 {
+		item.Metadata = make(map[string]string, n)
+		for i := 0; i < n && d.err == nil; i++ {
+			k := d.string()
+			item.Metadata[k] = d.string()
+		}
+	}
+	if d.err != nil {
+		return item
+	}
+	data := make([]byte, 4*dims)
+	if _, d.err = io.ReadFull(d.r, data); d.err != nil {
+		return item
+	}
+	item.Vector = make([]float32, dims)
+	for i := range item.Vector {
+		item.Vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))
+	}
+	return item
+}
@@ -0,0 +1,229 @@
+package vectorstore_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/PullRequestInc/go-gpt3/vectorstore"
+	"github.com/stretchr/testify/assert"
+)
+
+func randomItems(rng *rand.Rand, n, dims int) []vectorstore.Item {
+	items := make([]vectorstore.Item, n)
+	for i := range items {
+		vector := make([]float32, dims)
+		for j := range vector {
+			vector[j] = rng.Float32()*2 - 1
+		}
+		items[i] = vectorstore.Item{
+			ID:       fmt.Sprintf("item-%d", i),
+			Vector:   vector,
+			Metadata: map[string]string{"parity": []string{"even", "odd"}[i%2]},
+		}
+	}
+	return items
+}
+
+func ids(results []vectorstore.Result) []string {
+	var ids []string
+	for _, r := range results {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestFlatMetrics(t *testing.T) {
+	items := []vectorstore.Item{
+		{ID: "x", Vector: []float32{1, 0}},
+		{ID: "long-x", Vector: []float32{5, 0.5}},
+		{ID: "y", Vector: []float32{0, 1}},
+	}
+	for metric, expected := range map[vectorstore.Metric][]string{
+		vectorstore.Cosine:     {"x", "long-x", "y"},
+		vectorstore.DotProduct: {"long-x", "x", "y"},
+		vectorstore.Euclidean:  {"x", "y", "long-x"},
+	} {
+		index := vectorstore.NewFlat(2, metric)
+		assert.NoError(t, index.Add(items...))
+		results, err := index.Search([]float32{2, 0}, 3, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, ids(results), metric.String())
+		for _, r := range results {
+			original := items[map[string]int{"x": 0, "long-x": 1, "y": 2}[r.ID]]
+			assert.InDelta(t, vectorstore.Similarity(metric, []float32{2, 0}, original.Vector), r.Score, 1e-5, metric.String())
+		}
+	}
+}
+
+func newHNSW(t *testing.T, dims int, metric vectorstore.Metric, options ...vectorstore.HNSWOption) *vectorstore.HNSW {
+	index, err := vectorstore.NewHNSW(dims, metric, options...)
+	assert.NoError(t, err)
+	return index
+}
+
+func TestHNSWOptionErrors(t *testing.T) {
+	_, err := vectorstore.NewHNSW(3, vectorstore.Cosine, vectorstore.WithM(1))
+	assert.EqualError(t, err, "M must be at least 2, got 1")
+	_, err = vectorstore.NewHNSW(3, vectorstore.Cosine, vectorstore.WithEfConstruction(0))
+	assert.EqualError(t, err, "ef construction must be positive, got 0")
+	_, err = vectorstore.NewHNSW(3, vectorstore.Cosine, vectorstore.WithEfSearch(-1))
+	assert.EqualError(t, err, "ef search must be positive, got -1")
+}
+
+func TestIndexes(t *testing.T) {
+	for name, newIndex := range map[string]func() vectorstore.Index{
+		"flat": func() vectorstore.Index { return vectorstore.NewFlat(3, vectorstore.Cosine) },
+		"hnsw": func() vectorstore.Index { return newHNSW(t, 3, vectorstore.Cosine, vectorstore.WithSeed(1)) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			index := newIndex()
+			err := index.Add(vectorstore.Item{ID: "bad", Vector: []float32{1}})
+			assert.EqualError(t, err, "vector has 1 dimensions, the index has 3")
+
+			assert.NoError(t, index.Add(
+				vectorstore.Item{ID: "a", Vector: []float32{1, 0, 0}, Metadata: map[string]string{"lang": "en"}},
+				vectorstore.Item{ID: "b", Vector: []float32{0.9, 0.1, 0}, Metadata: map[string]string{"lang": "fr"}},
+				vectorstore.Item{ID: "c", Vector: []float32{0, 1, 0}, Metadata: map[string]string{"lang": "en"}},
+			))
+			assert.Equal(t, 3, index.Len())
+
+			results, err := index.Search([]float32{1, 0, 0}, 2, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"a", "b"}, ids(results))
+			assert.InDelta(t, 1, results[0].Score, 1e-6)
+
+			results, err = index.Search([]float32{1, 0, 0}, 2, vectorstore.MetadataEquals("lang", "en"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"a", "c"}, ids(results))
+
+			// replacing and deleting
+			assert.NoError(t, index.Add(vectorstore.Item{ID: "c", Vector: []float32{1, 0.05, 0}}))
+			assert.Equal(t, 1, index.Delete("a", "missing"))
+			assert.Equal(t, 2, index.Len())
+			_, ok := index.Get("a")
+			assert.False(t, ok)
+			results, err = index.Search([]float32{1, 0, 0}, 5, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"c", "b"}, ids(results))
+
+			// saving and loading
+			var buf bytes.Buffer
+			assert.NoError(t, index.Save(&buf))
+			loaded, err := vectorstore.Load(&buf)
+			assert.NoError(t, err)
+			assert.IsType(t, index, loaded)
+			assert.Equal(t, 2, loaded.Len())
+			loadedResults, err := loaded.Search([]float32{1, 0, 0}, 5, nil)
+			assert.NoError(t, err)
+			assert.Equal(t, results, loadedResults)
+			item, ok := loaded.Get("b")
+			assert.True(t, ok)
+			assert.Equal(t, map[string]string{"lang": "fr"}, item.Metadata)
+		})
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	items := randomItems(rng, 2000, 32)
+	flat := vectorstore.NewFlat(32, vectorstore.Euclidean)
+	hnsw := newHNSW(t, 32, vectorstore.Euclidean, vectorstore.WithSeed(42))
+	assert.NoError(t, flat.Add(items...))
+	assert.NoError(t, hnsw.Add(items...))
+
+	hits, total := 0, 0
+	for _, query := range randomItems(rng, 50, 32) {
+		exact, err := flat.Search(query.Vector, 10, nil)
+		assert.NoError(t, err)
+		approximate, err := hnsw.Search(query.Vector, 10, nil)
+		assert.NoError(t, err)
+		found := map[string]bool{}
+		for _, id := range ids(approximate) {
+			found[id] = true
+		}
+		for _, id := range ids(exact) {
+			if found[id] {
+				hits++
+			}
+			total++
+		}
+	}
+	recall := float64(hits) / float64(total)
+	assert.True(t, recall > 0.95, "recall %.3f", recall)
+
+	// filters return every match even when few items pass
+	results, err := hnsw.Search(items[0].Vector, 5, func(item vectorstore.Item) bool { return item.ID == "item-1234" })
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"item-1234"}, ids(results))
+	results, err = hnsw.Search(items[0].Vector, 3, vectorstore.MetadataEquals("parity", "odd"))
+	assert.NoError(t, err)
+	exact, _ := flat.Search(items[0].Vector, 3, vectorstore.MetadataEquals("parity", "odd"))
+	assert.Equal(t, ids(exact), ids(results))
+}
+
+func TestHNSWCompact(t *testing.T) {
+	rng := rand.New(rand.NewSource(7))
+	items := randomItems(rng, 200, 8)
+	index := newHNSW(t, 8, vectorstore.DotProduct, vectorstore.WithSeed(7))
+	assert.NoError(t, index.Add(items...))
+	for i := 0; i < 200; i += 2 {
+		index.Delete(items[i].ID)
+	}
+	index.Compact()
+	assert.Equal(t, 100, index.Len())
+	results, err := index.Search(items[1].Vector, 100, nil)
+	assert.NoError(t, err)
+	assert.Len(t, results, 100)
+	for _, r := range results {
+		assert.Equal(t, "odd", r.Metadata["parity"])
+	}
+}
+
+func TestSaveFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.bin")
+	index := vectorstore.NewFlat(2, vectorstore.DotProduct)
+	assert.NoError(t, index.Add(vectorstore.Item{ID: "a", Vector: []float32{1, 2}}))
+	assert.NoError(t, vectorstore.SaveFile(index, path))
+
+	loaded, err := vectorstore.LoadFile(path)
+	assert.NoError(t, err)
+	item, ok := loaded.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, []float32{1, 2}, item.Vector)
+
+	_, err = vectorstore.Load(bytes.NewBufferString("not an index"))
+	assert.EqualError(t, err, "vectorstore: not a vector index file")
+	var buf bytes.Buffer
+	assert.NoError(t, index.Save(&buf))
+	_, err = vectorstore.Load(bytes.NewReader(buf.Bytes()[:buf.Len()-3]))
+	assert.EqualError(t, err, "vectorstore: invalid index: unexpected EOF")
+}
+
+func TestLoadCorruptHeader(t *testing.T) {
+	header := func(values ...uint64) []byte {
+		b := []byte("GVS\x01")
+		for _, v := range values {
+			var buf [binary.MaxVarintLen64]byte
+			b = append(b, buf[:binary.PutUvarint(buf[:], v)]...)
+		}
+		return b
+	}
+	for _, test := range []struct {
+		data []byte
+		err  string
+	}{
+		{header(1, 0), "vectorstore: failed to read header: EOF"},
+		{header(1, 0, 1<<30), "vectorstore: failed to read header: length 1073741824 exceeds 1048576"},
+		{header(1, 0, 1<<63, 0), "vectorstore: failed to read header: length 9223372036854775808 exceeds 1048576"},
+		{header(1, 7, 2, 0), "vectorstore: unknown metric 7"},
+		{header(3, 0, 2, 0), "vectorstore: unknown index kind 3"},
+		{header(1, 0, 1<<20, 1), "vectorstore: invalid index: EOF"},
+	} {
+		_, err := vectorstore.Load(bytes.NewReader(test.data))
+		assert.EqualError(t, err, test.err)
+	}
+}